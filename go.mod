@@ -6,7 +6,8 @@ require (
 	github.com/Graylog2/go-gelf v0.0.0-20170811154226-7ebf4f536d8f // indirect
 	github.com/Microsoft/go-winio v0.5.0 // indirect
 	github.com/RackSec/srslog v0.0.0-20180709174129-a4725f04ec91 // indirect
-	github.com/aws/aws-sdk-go v1.39.0 // indirect
+	github.com/Shopify/sarama v1.29.1
+	github.com/aws/aws-sdk-go v1.39.0
 	github.com/bsphere/le_go v0.0.0-20200109081728-fc06dab2caa8 // indirect
 	github.com/containerd/containerd v1.5.2 // indirect
 	github.com/containerd/fifo v1.0.0
@@ -19,20 +20,23 @@ require (
 	github.com/fluent/fluent-logger-golang v1.6.1 // indirect
 	github.com/gogo/protobuf v1.3.2
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
+	github.com/golang/snappy v0.0.3
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1
 	github.com/moby/term v0.0.0-20210619224110-3f7ff695adc6 // indirect
 	github.com/morikuni/aec v1.0.0 // indirect
+	github.com/nats-io/nats-server/v2 v2.4.0
+	github.com/nats-io/nats.go v1.12.0
 	github.com/prometheus/common v0.29.0 // indirect
 	github.com/prometheus/procfs v0.7.0 // indirect
 	github.com/sirupsen/logrus v1.8.1
-	github.com/stretchr/testify v1.6.1
-	github.com/tinylib/msgp v1.1.6 // indirect
-	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
+	github.com/stretchr/testify v1.7.0
+	github.com/tinylib/msgp v1.1.6
+	github.com/xdg/scram v1.0.3
 	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
-	golang.org/x/time v0.0.0-20210611083556-38a9dc6acbc6 // indirect
+	golang.org/x/time v0.0.0-20210611083556-38a9dc6acbc6
 	google.golang.org/genproto v0.0.0-20210701191553-46259e63a0a9 // indirect
-	google.golang.org/grpc v1.39.0 // indirect
+	google.golang.org/grpc v1.39.0
 )
 
 replace github.com/Graylog2/go-gelf => gopkg.in/Graylog2/go-gelf.v2 v2.0.0-20191017102106-1550ee647df0
@@ -0,0 +1,173 @@
+// Package batcher queues the items logged by a driver and hands them in
+// batches to a background goroutine, which sends them retrying the failures
+// with an exponential backoff. It also has the helpers shared by the drivers
+// sending their batches over HTTP.
+package batcher
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// QueueSize is the maximum number of items waiting to be batched before
+// Push blocks
+const QueueSize = 1024
+
+// Default delays between retries, see Retry
+const (
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// ErrClosed is returned when pushing items after closing the batcher
+var ErrClosed = errors.New("logger is closed")
+
+// Config holds the batching and retry settings
+type Config struct {
+	// Wait is the maximum time an item waits before its batch is flushed
+	Wait time.Duration
+	// MaxItems flushes the batch once it has that many items, if positive
+	MaxItems int
+	// MaxSize flushes the batch once the size of its items adds up to it,
+	// if positive. Size must be set too.
+	MaxSize int
+	Size    func(item interface{}) int
+	// MinBackoff and MaxBackoff bound the delay between retries, the
+	// defaults are used if they are zero
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Batcher batches the pushed items and flushes them from a background
+// goroutine.
+type Batcher struct {
+	cfg   Config
+	flush func(items []interface{})
+
+	// mu is held by Push while queueing, so items isn't closed meanwhile
+	mu     sync.RWMutex
+	closed bool
+	items  chan interface{}
+
+	// closed when the batcher is closed, so failures are not retried and
+	// blocked calls to Push return
+	quit     chan struct{}
+	quitOnce sync.Once
+	done     chan struct{}
+}
+
+// New starts a batcher calling flush with every batch. Flush is always called
+// from the same goroutine.
+func New(cfg Config, flush func(items []interface{})) *Batcher {
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+
+	b := &Batcher{
+		cfg:   cfg,
+		flush: flush,
+		items: make(chan interface{}, QueueSize),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Push queues an item, blocking if the queue is full until there's room or
+// the batcher is closed.
+func (b *Batcher) Push(item interface{}) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrClosed
+	}
+	select {
+	case b.items <- item:
+		return nil
+	case <-b.quit:
+		return ErrClosed
+	}
+}
+
+// Close stops accepting items and waits until the queued ones are flushed,
+// without retrying failures.
+func (b *Batcher) Close() {
+	// quit is closed before taking the lock, so the calls to Push blocked
+	// while the queue is full release it, and the retries stop
+	b.quitOnce.Do(func() { close(b.quit) })
+
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.items)
+	}
+	b.mu.Unlock()
+
+	<-b.done
+}
+
+// run batches the items until the batch is large or old enough, and flushes
+// it.
+func (b *Batcher) run() {
+	defer close(b.done)
+
+	var (
+		items  []interface{}
+		size   int
+		ticker = time.NewTicker(b.cfg.Wait)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item, ok := <-b.items:
+			if !ok {
+				if len(items) > 0 {
+					b.flush(items)
+				}
+				return
+			}
+			items = append(items, item)
+			if b.cfg.MaxSize > 0 {
+				size += b.cfg.Size(item)
+			}
+			if (b.cfg.MaxItems > 0 && len(items) >= b.cfg.MaxItems) || (b.cfg.MaxSize > 0 && size >= b.cfg.MaxSize) {
+				b.flush(items)
+				items, size = nil, 0
+			}
+		case <-ticker.C:
+			if len(items) > 0 {
+				b.flush(items)
+				items, size = nil, 0
+			}
+		}
+	}
+}
+
+// Retry calls fn until it succeeds or fails with retry false, waiting with an
+// exponential backoff between the attempts. It gives up after retrying that
+// many times, or once the batcher is closed, and returns the last error. It
+// must be called from flush.
+func (b *Batcher) Retry(retries int, fn func() (retry bool, err error)) error {
+	backoff := b.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := fn()
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-b.quit:
+			return err
+		}
+		if backoff *= 2; backoff > b.cfg.MaxBackoff {
+			backoff = b.cfg.MaxBackoff
+		}
+	}
+}
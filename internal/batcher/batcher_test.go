@@ -0,0 +1,159 @@
+package batcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchLimits(t *testing.T) {
+	batches := make(chan []interface{}, 10)
+	b := New(Config{
+		Wait:     time.Hour,
+		MaxItems: 3,
+		MaxSize:  10,
+		Size:     func(item interface{}) int { return len(item.(string)) },
+	}, func(items []interface{}) {
+		batches <- items
+	})
+
+	for _, item := range []string{"a", "b", "c", "0123456789", "d"} {
+		require.Nil(t, b.Push(item))
+	}
+	b.Close()
+	assert.Equal(t, ErrClosed, b.Push("e"))
+
+	close(batches)
+	var got [][]interface{}
+	for batch := range batches {
+		got = append(got, batch)
+	}
+	assert.Equal(t, [][]interface{}{{"a", "b", "c"}, {"0123456789"}, {"d"}}, got)
+}
+
+func TestBatchWait(t *testing.T) {
+	batches := make(chan []interface{}, 10)
+	b := New(Config{Wait: 10 * time.Millisecond}, func(items []interface{}) {
+		batches <- items
+	})
+	defer b.Close()
+
+	require.Nil(t, b.Push("a"))
+	select {
+	case batch := <-batches:
+		assert.Equal(t, []interface{}{"a"}, batch)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the batch wasn't flushed")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var (
+		b        = New(Config{Wait: time.Hour, MinBackoff: time.Millisecond}, func([]interface{}) {})
+		attempts int
+		errFail  = errors.New("fail")
+	)
+
+	err := b.Retry(2, func() (bool, error) {
+		attempts++
+		return true, errFail
+	})
+	assert.Equal(t, errFail, err)
+	assert.Equal(t, 3, attempts, "should retry twice")
+
+	attempts = 0
+	err = b.Retry(2, func() (bool, error) {
+		attempts++
+		return false, errFail
+	})
+	assert.Equal(t, errFail, err)
+	assert.Equal(t, 1, attempts, "should not retry")
+
+	b.Close()
+	attempts = 0
+	b.Retry(2, func() (bool, error) {
+		attempts++
+		return true, errFail
+	})
+	assert.Equal(t, 1, attempts, "should not retry after closing")
+}
+
+func TestCloseWhilePushBlocked(t *testing.T) {
+	var (
+		flushing = make(chan struct{}, QueueSize+2)
+		b        *Batcher
+	)
+	b = New(Config{Wait: time.Hour, MaxItems: 1, MinBackoff: time.Hour}, func([]interface{}) {
+		flushing <- struct{}{}
+		// the first batch is retried until the batcher is closed
+		b.Retry(10, func() (bool, error) {
+			return true, errors.New("fail")
+		})
+	})
+
+	require.Nil(t, b.Push(0))
+	<-flushing
+	// fill the queue, so the last push blocks
+	pushed := make(chan error, QueueSize+1)
+	go func() {
+		for i := 0; i <= QueueSize; i++ {
+			pushed <- b.Push(i)
+		}
+	}()
+	for i := 0; i < QueueSize; i++ {
+		require.Nil(t, <-pushed)
+	}
+	select {
+	case <-pushed:
+		t.Fatal("push didn't block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waited for the retries")
+	}
+	assert.Equal(t, ErrClosed, <-pushed)
+}
+
+func TestRetryHTTP(t *testing.T) {
+	var (
+		b        = New(Config{Wait: time.Hour, MinBackoff: time.Millisecond}, func([]interface{}) {})
+		statuses = []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusBadRequest}
+		requests int
+	)
+	defer b.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[requests])
+		requests++
+	}))
+	defer srv.Close()
+
+	newRequest := func() (*http.Request, error) {
+		return http.NewRequest(http.MethodPost, srv.URL, nil)
+	}
+
+	// the server error is retried
+	status, err := b.RetryHTTP(srv.Client(), 2, newRequest)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, requests)
+
+	// the client error isn't
+	status, err = b.RetryHTTP(srv.Client(), 2, newRequest)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, 3, requests)
+}
@@ -0,0 +1,53 @@
+package batcher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Retriable tells if an HTTP request, or an item of a bulk request, failed
+// with this status could succeed later: network errors, with no status, rate
+// limiting and server errors.
+func Retriable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status/100 == 5
+}
+
+// Do sends an HTTP request, returning the response status if there is one.
+// Responses other than 2xx fail with the beginning of their body. The body of
+// the other ones is passed to read, or discarded if read is nil.
+func Do(hc *http.Client, req *http.Request, read func(body io.Reader) error) (int, error) {
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if read != nil {
+		return resp.StatusCode, read(resp.Body)
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// RetryHTTP sends the requests built by newRequest with Retry, until one
+// succeeds or fails with a status which isn't Retriable. It returns the
+// status of the last response, if there is one. It must be called from flush.
+func (b *Batcher) RetryHTTP(hc *http.Client, retries int, newRequest func() (*http.Request, error)) (status int, err error) {
+	err = b.Retry(retries, func() (bool, error) {
+		req, err := newRequest()
+		if err != nil {
+			status = 0
+			return false, err
+		}
+		status, err = Do(hc, req, nil)
+		return Retriable(status), err
+	})
+	return status, err
+}
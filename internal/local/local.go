@@ -0,0 +1,59 @@
+package local
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/local"
+)
+
+const (
+	defaultLogDir = "/var/log/docker-local"
+	logDirKey     = "local-log-dir"
+	optPrefix     = "local-"
+)
+
+// New returns the generic local log driver after parsing
+// our custom options
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, logDir := driverConfig(info.Config)
+	if logDir == "" {
+		logDir = defaultLogDir
+	}
+	info.Config = cfg
+	info.LogPath = filepath.Join(logDir, info.ContainerID, "container.log")
+
+	if err := os.MkdirAll(filepath.Dir(info.LogPath), 0755); err != nil {
+		return nil, fmt.Errorf("error setting up logger dir: %v", err)
+	}
+
+	return local.New(info)
+}
+
+// ValidateLogOpt takes care of translating our custom local options
+// before executing the real validator
+func ValidateLogOpt(cfg map[string]string) error {
+	drvcfg, _ := driverConfig(cfg)
+	return local.ValidateLogOpt(drvcfg)
+}
+
+// driverConfig strips the prefix of our options, as the local driver shares
+// its option names with the json-file one, and returns the log directory
+// apart
+func driverConfig(cfg map[string]string) (map[string]string, string) {
+	var (
+		drvcfg = make(map[string]string, len(cfg))
+		logDir string
+	)
+	for k, v := range cfg {
+		if k == logDirKey {
+			logDir = v
+			continue
+		}
+		drvcfg[strings.TrimPrefix(k, optPrefix)] = v
+	}
+	return drvcfg, logDir
+}
@@ -0,0 +1,72 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(ValidateLogOpt(map[string]string{}))
+	assert.Nil(ValidateLogOpt(map[string]string{
+		"local-max-size": "10m",
+		"local-max-file": "3",
+		"local-compress": "false",
+		"local-log-dir":  "/tmp",
+	}))
+	assert.NotNil(ValidateLogOpt(map[string]string{
+		"local-labels": "foo",
+	}))
+}
+
+func TestReadLogs(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	logDir, err := ioutil.TempDir("", "local")
+	require.Nil(err)
+	defer os.RemoveAll(logDir)
+
+	l, err := New(logger.Info{
+		ContainerID: "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		Config: map[string]string{
+			"local-max-size": "1m",
+			"local-log-dir":  logDir,
+		},
+	})
+	require.Nil(err)
+	defer l.Close()
+
+	msg := logger.NewMessage()
+	msg.Line = []byte("hello")
+	msg.Source = "stdout"
+	msg.Timestamp = time.Now()
+	require.Nil(l.Log(msg))
+
+	lr, ok := l.(logger.LogReader)
+	require.True(ok, "the local driver should support reading logs")
+
+	watcher := lr.ReadLogs(logger.ReadConfig{Tail: -1})
+	defer watcher.ConsumerGone()
+
+	select {
+	case msg := <-watcher.Msg:
+		require.NotNil(msg)
+		// the driver restores the newline removed by the daemon
+		assert.Equal("hello\n", string(msg.Line))
+		assert.Equal("stdout", msg.Source)
+	case err := <-watcher.Err:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout reading logs")
+	}
+}
@@ -0,0 +1,63 @@
+// Package loggertest holds the fixtures shared by the tests of the logging
+// drivers.
+package loggertest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// ContainerID is the ID of the container returned by Info
+const ContainerID = "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e"
+
+// Timeout is how long Receive waits
+const Timeout = 5 * time.Second
+
+// Info returns the info of a container named web with the given options
+func Info(cfg map[string]string) logger.Info {
+	return logger.Info{
+		ContainerID:   ContainerID,
+		ContainerName: "/web",
+		Config:        cfg,
+	}
+}
+
+// New creates a logger for the Info container, failing the test on errors
+func New(t *testing.T, create logger.Creator, cfg map[string]string) logger.Logger {
+	l, err := create(Info(cfg))
+	require.Nil(t, err)
+	return l
+}
+
+// Log logs a line written to stdout now, failing the test on errors
+func Log(t *testing.T, l logger.Logger, line string) {
+	LogAt(t, l, line, "stdout", time.Now())
+}
+
+// LogAt logs a line with the given source and timestamp, failing the test on
+// errors
+func LogAt(t *testing.T, l logger.Logger, line, source string, ts time.Time) {
+	msg := logger.NewMessage()
+	msg.Line = []byte(line)
+	msg.Source = source
+	msg.Timestamp = ts
+	require.Nil(t, l.Log(msg))
+}
+
+// Receive returns the next value received from ch, which must be a channel,
+// failing the test if nothing is received before the Timeout.
+func Receive(t *testing.T, ch interface{}) interface{} {
+	chosen, v, ok := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(time.After(Timeout))},
+	})
+	if chosen == 1 {
+		t.Fatalf("timeout waiting for a %s", reflect.TypeOf(ch).Elem())
+	}
+	require.True(t, ok, "channel closed")
+	return v.Interface()
+}
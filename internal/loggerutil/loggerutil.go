@@ -0,0 +1,132 @@
+// Package loggerutil holds the helpers shared by the logging drivers to parse
+// their options and describe the container in their messages.
+package loggerutil
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+// ParseBool parses an optional boolean option, which is false by default
+func ParseBool(cfg map[string]string, key string) (bool, error) {
+	v := cfg[key]
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errdefs.InvalidParameter(err)
+	}
+	return b, nil
+}
+
+// ParseInt parses an optional integer option, which must be at least min
+func ParseInt(cfg map[string]string, key string, def, min int) (int, error) {
+	v := cfg[key]
+	if v == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errdefs.InvalidParameter(err)
+	}
+	if i < min {
+		return 0, fmt.Errorf("%s must be at least %d", key, min)
+	}
+	return i, nil
+}
+
+// ParsePositiveDuration parses an optional duration option, which must be
+// positive
+func ParsePositiveDuration(cfg map[string]string, key string, def time.Duration) (time.Duration, error) {
+	v := cfg[key]
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errdefs.InvalidParameter(err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration", key)
+	}
+	return d, nil
+}
+
+// TLSKeys holds the names of the TLS options of a driver
+type TLSKeys struct {
+	// Enable is the boolean option enabling TLS. If empty, TLS is always
+	// configured, for the drivers choosing it by the address scheme.
+	Enable     string
+	CACert     string
+	Cert       string
+	Key        string
+	SkipVerify string
+}
+
+// ParseTLS returns the client TLS configuration, or nil if TLS isn't enabled
+func ParseTLS(cfg map[string]string, keys TLSKeys) (*tls.Config, error) {
+	if keys.Enable != "" {
+		enabled, err := ParseBool(cfg, keys.Enable)
+		if err != nil || !enabled {
+			return nil, err
+		}
+	}
+
+	skipVerify, err := ParseBool(cfg, keys.SkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	certFile, keyFile := cfg[keys.Cert], cfg[keys.Key]
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("both TLS certificate and key must be provided")
+	}
+	return tlsconfig.Client(tlsconfig.Options{
+		CAFile:             cfg[keys.CACert],
+		CertFile:           certFile,
+		KeyFile:            keyFile,
+		InsecureSkipVerify: skipVerify,
+	})
+}
+
+// ContainerFields returns the fields describing the container in structured
+// messages: its ID and name, its image ID and name, and the labels and
+// environment variables selected by the options.
+func ContainerFields(info logger.Info) (map[string]interface{}, error) {
+	extra, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+
+	fields := make(map[string]interface{}, len(extra)+4)
+	for k, v := range extra {
+		fields[k] = v
+	}
+	fields["container_id"] = info.ContainerID
+	fields["container_name"] = info.Name()
+	fields["image_id"] = info.ContainerImageID
+	fields["image_name"] = info.ContainerImageName
+	return fields, nil
+}
+
+// TemplateData is the data the templates of the drivers formatting messages
+// are executed with. The container info fields and methods are available
+// too, like {{.Name}}.
+type TemplateData struct {
+	*logger.Info
+	Timestamp time.Time
+	Message   string
+	Source    string
+	// the labels and environment variables selected by the options
+	Attrs map[string]string
+}
@@ -0,0 +1,100 @@
+package loggerutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		cfg     = map[string]string{
+			"bool":     "true",
+			"int":      "3",
+			"duration": "2s",
+			"invalid":  "foo",
+			"zero":     "0",
+			"negative": "-1s",
+		}
+	)
+
+	b, err := ParseBool(cfg, "bool")
+	require.Nil(err)
+	assert.True(b)
+	b, err = ParseBool(cfg, "missing")
+	require.Nil(err)
+	assert.False(b)
+	_, err = ParseBool(cfg, "invalid")
+	assert.NotNil(err)
+
+	i, err := ParseInt(cfg, "int", 1, 1)
+	require.Nil(err)
+	assert.Equal(3, i)
+	i, err = ParseInt(cfg, "missing", 1, 1)
+	require.Nil(err)
+	assert.Equal(1, i)
+	_, err = ParseInt(cfg, "zero", 1, 1)
+	assert.NotNil(err)
+	_, err = ParseInt(cfg, "invalid", 1, 1)
+	assert.NotNil(err)
+
+	d, err := ParsePositiveDuration(cfg, "duration", time.Second)
+	require.Nil(err)
+	assert.Equal(2*time.Second, d)
+	d, err = ParsePositiveDuration(cfg, "missing", time.Second)
+	require.Nil(err)
+	assert.Equal(time.Second, d)
+	_, err = ParsePositiveDuration(cfg, "negative", time.Second)
+	assert.NotNil(err)
+}
+
+func TestParseTLS(t *testing.T) {
+	keys := TLSKeys{
+		Enable:     "tls",
+		CACert:     "tls-ca-cert",
+		Cert:       "tls-cert",
+		Key:        "tls-key",
+		SkipVerify: "tls-skip-verify",
+	}
+
+	c, err := ParseTLS(map[string]string{}, keys)
+	require.Nil(t, err)
+	assert.Nil(t, c, "TLS should be disabled by default")
+
+	c, err = ParseTLS(map[string]string{"tls": "true", "tls-skip-verify": "true"}, keys)
+	require.Nil(t, err)
+	require.NotNil(t, c)
+	assert.True(t, c.InsecureSkipVerify)
+
+	_, err = ParseTLS(map[string]string{"tls": "true", "tls-cert": "/cert.pem"}, keys)
+	assert.NotNil(t, err, "Expected error with a certificate without key")
+
+	keys.Enable = ""
+	c, err = ParseTLS(map[string]string{}, keys)
+	require.Nil(t, err)
+	assert.NotNil(t, c, "TLS should always be configured without an enable option")
+}
+
+func TestContainerFields(t *testing.T) {
+	fields, err := ContainerFields(logger.Info{
+		ContainerID:        "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		ContainerName:      "/web",
+		ContainerImageID:   "sha256:0123",
+		ContainerImageName: "nginx",
+		ContainerLabels:    map[string]string{"team": "core"},
+		Config:             map[string]string{"labels": "team"},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"container_id":   "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		"container_name": "web",
+		"image_id":       "sha256:0123",
+		"image_name":     "nginx",
+		"team":           "core",
+	}, fields)
+}
@@ -0,0 +1,87 @@
+// Package protowire encodes protobuf fields by hand, for the drivers sending
+// messages simple enough not to need generated code.
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Wire types
+const (
+	VarintType  = 0
+	Fixed64Type = 1
+	BytesType   = 2
+)
+
+// AppendVarint appends v as a varint
+func AppendVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// AppendVarintField appends a varint field
+func AppendVarintField(b []byte, field int, v uint64) []byte {
+	b = AppendVarint(b, uint64(field<<3|VarintType))
+	return AppendVarint(b, v)
+}
+
+// AppendFixed64Field appends a fixed64 field
+func AppendFixed64Field(b []byte, field int, v uint64) []byte {
+	b = AppendVarint(b, uint64(field<<3|Fixed64Type))
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// AppendBytesField appends a length-delimited field: a string, bytes or an
+// embedded message
+func AppendBytesField(b []byte, field int, v []byte) []byte {
+	b = AppendVarint(b, uint64(field<<3|BytesType))
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+var errInvalid = errors.New("protowire: invalid message")
+
+// Fields decodes the fields of a message by number. Varint and fixed64
+// values are returned as uint64, and length-delimited ones as []byte.
+func Fields(b []byte) (map[int][]interface{}, error) {
+	fields := make(map[int][]interface{})
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errInvalid
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+
+		switch tag & 7 {
+		case VarintType:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errInvalid
+			}
+			fields[field] = append(fields[field], v)
+			b = b[n:]
+		case Fixed64Type:
+			if len(b) < 8 {
+				return nil, errInvalid
+			}
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case BytesType:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errInvalid
+			}
+			b = b[n:]
+			fields[field] = append(fields[field], b[:l])
+			b = b[l:]
+		default:
+			return nil, errInvalid
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,26 @@
+package protowire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFields(t *testing.T) {
+	b := AppendVarintField(nil, 1, 300)
+	b = AppendFixed64Field(b, 2, 1<<40)
+	b = AppendBytesField(b, 3, []byte("hello"))
+	b = AppendBytesField(b, 3, nil)
+
+	fields, err := Fields(b)
+	require.Nil(t, err)
+	assert.Equal(t, map[int][]interface{}{
+		1: {uint64(300)},
+		2: {uint64(1 << 40)},
+		3: {[]byte("hello"), []byte{}},
+	}, fields)
+
+	_, err = Fields(b[:len(b)-3])
+	assert.NotNil(t, err, "Expected error with a truncated message")
+}
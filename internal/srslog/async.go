@@ -0,0 +1,162 @@
+package srslog
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// maxBatchMessages limits how many queued messages are coalesced into a
+// single write by the background sender.
+const maxBatchMessages = 256
+
+// ErrWriterClosed is returned when writing to an asynchronous Writer that
+// has already been closed.
+var ErrWriterClosed = errors.New("srslog: write on closed writer")
+
+// asyncSender holds the state of a Writer running in asynchronous mode.
+type asyncSender struct {
+	queue chan []byte
+	done  chan struct{}
+}
+
+// SetAsync switches the Writer to asynchronous mode. Messages are formatted
+// by the caller, queued on a channel of bufferSize elements and
+// written by a background goroutine, which coalesces every message waiting in
+// the queue into a single write. Messages are framed by the connection that
+// sends them, as the members of a pool may use different transports. Once the queue is full, writers block until
+// the sender catches up.
+//
+// Errors found by the background sender can't be returned to the caller that
+// queued the message, so the last one is reported by the next write or by
+// Close. Close flushes every queued message before closing the connection.
+func (w *Writer) SetAsync(bufferSize int) {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+
+	w.amu.Lock()
+	defer w.amu.Unlock()
+	if w.async != nil || w.closed {
+		return
+	}
+
+	w.async = &asyncSender{
+		queue: make(chan []byte, bufferSize),
+		done:  make(chan struct{}),
+	}
+	go w.runAsync(w.async)
+}
+
+// enqueue formats and queues a message for the background sender.
+func (w *Writer) enqueue(timestamp time.Time, p Priority, msg []byte) (int, error) {
+	// ensure it ends in a \n
+	if !bytes.HasSuffix(msg, []byte("\n")) {
+		msg = append(msg, byte('\n'))
+	}
+
+	formatter := w.formatter
+	if formatter == nil {
+		formatter = DefaultFormatter
+		if w.network == "" {
+			formatter = UnixFormatter
+		}
+	}
+
+	// formatters are allowed to reuse their output buffer between calls, so
+	// the formatted message must be copied before handing it to the sender
+	qmsg := append([]byte(nil), formatter(timestamp, p, w.getHostname(), w.tag, msg)...)
+
+	w.amu.RLock()
+	defer w.amu.RUnlock()
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	w.async.queue <- qmsg
+
+	return len(msg), w.takeAsyncErr()
+}
+
+// runAsync is the background sender loop. It exits once the queue is closed
+// and every pending message has been written.
+func (w *Writer) runAsync(as *asyncSender) {
+	defer close(as.done)
+
+	batch := make([][]byte, 0, maxBatchMessages)
+	for msg := range as.queue {
+		batch = append(batch[:0], msg)
+	drain:
+		for len(batch) < maxBatchMessages {
+			select {
+			case msg, ok := <-as.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, msg)
+			default:
+				break drain
+			}
+		}
+
+		if err := w.sendBatch(batch); err != nil {
+			w.setAsyncErr(err)
+		}
+	}
+}
+
+// sendBatch writes a batch of formatted messages, reconnecting once if needed.
+// Only the messages the broken connection didn't take are written again, as
+// RELP sends the ones in its window again by itself.
+func (w *Writer) sendBatch(batch [][]byte) error {
+	w.maybeRecycle()
+	conn := w.acquireConn()
+	if conn != nil {
+		n, err := conn.writeBatch(w.framer, batch)
+		w.releaseConn(conn)
+		if err == nil || errors.Is(err, ErrMessageTooLarge) {
+			return err
+		}
+		batch = batch[n:]
+	}
+
+	conn, err := w.reconnect(conn)
+	if err != nil {
+		return err
+	}
+	defer w.releaseConn(conn)
+	_, err = conn.writeBatch(w.framer, batch)
+	return err
+}
+
+// closeAsync stops accepting new messages and waits until the background
+// sender has flushed the queued ones.
+func (w *Writer) closeAsync() error {
+	w.amu.Lock()
+	as := w.async
+	if as == nil {
+		w.amu.Unlock()
+		return nil
+	}
+	if !w.closed {
+		w.closed = true
+		close(as.queue)
+	}
+	w.amu.Unlock()
+
+	<-as.done
+	return w.takeAsyncErr()
+}
+
+func (w *Writer) setAsyncErr(err error) {
+	w.emu.Lock()
+	w.asyncErr = err
+	w.emu.Unlock()
+}
+
+func (w *Writer) takeAsyncErr() error {
+	w.emu.Lock()
+	err := w.asyncErr
+	w.asyncErr = nil
+	w.emu.Unlock()
+	return err
+}
@@ -0,0 +1,94 @@
+package srslog
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncWrite(t *testing.T) {
+	const N = 100
+
+	for _, tr := range []string{"tcp", "unix"} {
+		if !testableNetwork(tr) {
+			continue
+		}
+
+		t.Run(tr, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				done    = make(chan string, N)
+			)
+
+			addr, sock, srvWG := startServer(tr, "", done)
+			defer srvWG.Wait()
+			defer sock.Close()
+			if tr == "unix" {
+				defer os.Remove(addr)
+			}
+
+			w, err := Dial(tr, addr, LOG_USER|LOG_INFO, "syslog_test")
+			require.NoError(err, "Dial() failed")
+			w.SetAsync(10)
+
+			for i := 0; i < N; i++ {
+				err := w.Info(fmt.Sprintf("message %d", i))
+				require.NoError(err, "Info() failed")
+			}
+			require.NoError(w.Close(), "Close() should flush the queue")
+
+			for i := 0; i < N; i++ {
+				check(t, fmt.Sprintf("message %d", i), <-done)
+			}
+
+			err = w.Info("too late")
+			assert.Equal(ErrWriterClosed, err)
+		})
+	}
+}
+
+func TestAsyncCopiesReusedBuffers(t *testing.T) {
+	var (
+		require = require.New(t)
+		done    = make(chan string, 2)
+		buf     []byte
+	)
+
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	w, err := Dial("tcp", addr, LOG_USER|LOG_INFO, "syslog_test")
+	require.NoError(err, "Dial() failed")
+
+	// a formatter that overwrites the same buffer on every call, like the
+	// cached headers used by the syslog5424 driver
+	w.SetFormatter(func(_ time.Time, _ Priority, _, _ string, content []byte) []byte {
+		buf = append(buf[:0], content...)
+		return buf
+	})
+	w.SetAsync(10)
+
+	_, err = w.Write([]byte("first"))
+	require.NoError(err)
+	_, err = w.Write([]byte("second"))
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	assert.Equal(t, "first\n", <-done)
+	assert.Equal(t, "second\n", <-done)
+}
+
+func TestAsyncWriteFails(t *testing.T) {
+	w := &Writer{network: "udp", raddr: "fakehost"}
+	w.SetAsync(1)
+
+	_, err := w.Write([]byte("nope"))
+	assert.NoError(t, err, "async writes are just queued")
+	assert.Error(t, w.Close(), "close should report the send error")
+}
@@ -0,0 +1,91 @@
+package srslog
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrReconnectBackoff is returned, wrapping the last dial error, when a write
+// is attempted while the Writer is waiting before dialing again.
+var ErrReconnectBackoff = errors.New("srslog: waiting to reconnect")
+
+// backoff keeps track of consecutive dial failures and computes when the
+// next dial may be attempted, using exponential backoff with jitter.
+// A zero value backoff never delays a dial.
+type backoff struct {
+	mu       sync.Mutex
+	initial  time.Duration
+	max      time.Duration
+	failures int
+	next     time.Time
+	lastErr  error
+}
+
+// set configures the initial and maximum delays between dial attempts.
+func (b *backoff) set(initial, max time.Duration) {
+	if max < initial {
+		max = initial
+	}
+
+	b.mu.Lock()
+	b.initial = initial
+	b.max = max
+	b.mu.Unlock()
+}
+
+// config returns the initial and maximum delays between dial attempts.
+func (b *backoff) config() (initial, max time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.initial, b.max
+}
+
+// check returns an error if we are still waiting before dialing again.
+func (b *backoff) check(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures > 0 && now.Before(b.next) {
+		return fmt.Errorf("%w: %v", ErrReconnectBackoff, b.lastErr)
+	}
+	return nil
+}
+
+// fail registers a dial failure and schedules the next attempt.
+func (b *backoff) fail(now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.lastErr = err
+	b.next = now.Add(b.delay())
+}
+
+// reset forgets every previous dial failure.
+func (b *backoff) reset() {
+	b.mu.Lock()
+	b.failures = 0
+	b.lastErr = nil
+	b.mu.Unlock()
+}
+
+// delay returns the time to wait after the current number of failures. Half
+// of the delay is fixed and the other half is random, so that many writers
+// don't hammer a recovering server at the same time.
+func (b *backoff) delay() time.Duration {
+	if b.initial <= 0 {
+		return 0
+	}
+
+	d := b.initial
+	for i := 1; i < b.failures && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
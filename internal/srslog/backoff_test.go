@@ -0,0 +1,91 @@
+package srslog
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		b      backoff
+		now    = time.Now()
+	)
+
+	assert.Nil(b.check(now), "a zero backoff never waits")
+	b.fail(now, errors.New("boom"))
+	assert.Nil(b.check(now), "a zero backoff never waits")
+	b.reset()
+
+	b.set(100*time.Millisecond, time.Second)
+	for _, max := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		b.fail(now, errors.New("boom"))
+		delay := b.next.Sub(now)
+		assert.True(delay >= max/2 && delay <= max, "delay %v out of [%v, %v]", delay, max/2, max)
+
+		err := b.check(now)
+		assert.True(errors.Is(err, ErrReconnectBackoff))
+		assert.Nil(b.check(now.Add(max)))
+	}
+
+	b.reset()
+	assert.Nil(b.check(now))
+}
+
+func TestWriterReconnectBackoff(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	// get an address where nobody is listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := l.Addr().String()
+	l.Close()
+
+	w, err := NewWriter("tcp", addr, LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err, "NewWriter() should not dial")
+	w.SetReconnectBackoff(time.Hour, time.Hour)
+
+	err = w.Info("first")
+	assert.Error(err, "should fail to dial")
+	assert.False(errors.Is(err, ErrReconnectBackoff), "first attempt must dial")
+
+	err = w.Info("second")
+	assert.True(errors.Is(err, ErrReconnectBackoff), "should not dial again before the backoff expires")
+
+	err = w.Connect()
+	assert.True(errors.Is(err, ErrReconnectBackoff), "should not dial again before the backoff expires")
+}
+
+func TestNewWriterConnectsOnWrite(t *testing.T) {
+	var (
+		require = require.New(t)
+		done    = make(chan string)
+	)
+
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	w, err := NewWriter("tcp", addr, LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err, "NewWriter() failed")
+	require.Nil(w.getConn(), "should not be connected yet")
+	defer w.Close()
+
+	require.NoError(w.Info("lazy"))
+	check(t, "lazy", <-done)
+}
@@ -35,9 +35,12 @@ func (df dialerFunctionWrapper) Call() (serverConn, string, error) {
 // function and adding it to the map.
 func (w *Writer) getDialer() dialerFunctionWrapper {
 	dialers := map[string]dialerFunctionWrapper{
-		"":        dialerFunctionWrapper{"unixDialer", w.unixDialer},
-		"tcp+tls": dialerFunctionWrapper{"tlsDialer", w.tlsDialer},
-		"custom":  dialerFunctionWrapper{"customDialer", w.customDialer},
+		"":         dialerFunctionWrapper{"unixDialer", w.unixDialer},
+		"tcp+tls":  dialerFunctionWrapper{"tlsDialer", w.tlsDialer},
+		"custom":   dialerFunctionWrapper{"customDialer", w.customDialer},
+		"pool":     dialerFunctionWrapper{"poolDialer", w.poolDialer},
+		"relp":     dialerFunctionWrapper{"relpDialer", w.relpDialer},
+		"relp+tls": dialerFunctionWrapper{"relpDialer", w.relpDialer},
 	}
 	dialer, ok := dialers[w.network]
 	if !ok {
@@ -47,24 +50,34 @@ func (w *Writer) getDialer() dialerFunctionWrapper {
 }
 
 // unixDialer uses the unixSyslog method to open a connection to the syslog
-// daemon running on the local machine.
+// daemon running on the local machine, through the socket at raddr if it's
+// set.
 func (w *Writer) unixDialer() (serverConn, string, error) {
-	sc, err := unixSyslog()
-	hostname := w.hostname
+	sc, err := unixSyslog(w.raddr)
+	hostname := w.getHostname()
 	if hostname == "" {
 		hostname = "localhost"
 	}
 	return sc, hostname, err
 }
 
+// netDialer returns the net.Dialer used by the network dialers, honoring the
+// configured dial timeout and TCP keep-alive period.
+func (w *Writer) netDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   w.dialTimeout,
+		KeepAlive: w.keepAlive,
+	}
+}
+
 // tlsDialer connects to TLS over TCP, and is used for the "tcp+tls" network
 // type.
 func (w *Writer) tlsDialer() (serverConn, string, error) {
-	c, err := tls.Dial("tcp", w.raddr, w.tlsConfig)
+	c, err := tls.DialWithDialer(w.netDialer(), "tcp", w.raddr, w.tlsConfig)
 	var sc serverConn
-	hostname := w.hostname
+	hostname := w.getHostname()
 	if err == nil {
-		sc = &netConn{conn: c}
+		sc = &netConn{conn: c, writeTimeout: w.writeTimeout}
 		if hostname == "" {
 			hostname = c.LocalAddr().String()
 		}
@@ -75,11 +88,11 @@ func (w *Writer) tlsDialer() (serverConn, string, error) {
 // basicDialer is the most common dialer for syslog, and supports both TCP and
 // UDP connections.
 func (w *Writer) basicDialer() (serverConn, string, error) {
-	c, err := net.Dial(w.network, w.raddr)
+	c, err := w.netDialer().Dial(w.network, w.raddr)
 	var sc serverConn
-	hostname := w.hostname
+	hostname := w.getHostname()
 	if err == nil {
-		sc = &netConn{conn: c}
+		sc = &netConn{conn: c, writeTimeout: w.writeTimeout}
 		if hostname == "" {
 			hostname = c.LocalAddr().String()
 		}
@@ -93,9 +106,9 @@ func (w *Writer) basicDialer() (serverConn, string, error) {
 func (w *Writer) customDialer() (serverConn, string, error) {
 	c, err := w.customDial(w.network, w.raddr)
 	var sc serverConn
-	hostname := w.hostname
+	hostname := w.getHostname()
 	if err == nil {
-		sc = &netConn{conn: c}
+		sc = &netConn{conn: c, writeTimeout: w.writeTimeout}
 		if hostname == "" {
 			hostname = c.LocalAddr().String()
 		}
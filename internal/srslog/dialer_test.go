@@ -33,6 +33,9 @@ func TestGetDialer(t *testing.T) {
 		{"tcp+tls", "tlsDialer"},
 		{"tcp", "basicDialer"},
 		{"udp", "basicDialer"},
+		{"pool", "poolDialer"},
+		{"relp", "relpDialer"},
+		{"relp+tls", "relpDialer"},
 		{"something else entirely", "basicDialer"},
 	} {
 		w.network = tc.Network
@@ -2,6 +2,7 @@ package srslog
 
 import (
 	"bytes"
+	"crypto/tls"
 	"net"
 	"time"
 )
@@ -9,7 +10,8 @@ import (
 // netConn has an internal net.Conn and adheres to the serverConn interface,
 // allowing us to send syslog messages over the network.
 type netConn struct {
-	conn net.Conn
+	conn         net.Conn
+	writeTimeout time.Duration
 }
 
 // write formats syslog messages using time.RFC3339 and includes the
@@ -31,6 +33,10 @@ func (n *netConn) write(
 
 	fmsg := framer(formatter(timestamp, p, hostname, tag, msg))
 
+	if err := n.setWriteDeadline(); err != nil {
+		return err
+	}
+
 	var err error
 	switch conn := n.conn.(type) {
 	case *net.TCPConn:
@@ -50,6 +56,58 @@ func (n *netConn) write(
 	return err
 }
 
+// writeBatch frames and sends several already formatted messages at once.
+// Stream connections coalesce them into a single write, while datagram
+// connections must send every message on its own.
+func (n *netConn) writeBatch(framer Framer, msgs [][]byte) (int, error) {
+	if framer == nil {
+		framer = DefaultFramer
+	}
+
+	if err := n.setWriteDeadline(); err != nil {
+		return 0, err
+	}
+
+	var err error
+	switch conn := n.conn.(type) {
+	case *net.TCPConn:
+		nb := make(net.Buffers, 0, len(msgs))
+		for _, msg := range msgs {
+			nb = append(nb, framer(msg)...)
+		}
+		_, err = nb.WriteTo(conn)
+	case *tls.Conn:
+		// net.Buffers would produce a TLS record per message
+		var buf []byte
+		for _, msg := range msgs {
+			buf = append(buf, bytes.Join(framer(msg), nil)...)
+		}
+		_, err = conn.Write(buf)
+	default:
+		for i, msg := range msgs {
+			if _, err = conn.Write(bytes.Join(framer(msg), nil)); err != nil {
+				return i, err
+			}
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+	return len(msgs), nil
+}
+
+// setWriteDeadline makes the next write fail if it doesn't complete within
+// the configured timeout, so a peer that stops reading can't block us
+// forever. The caller reconnects after any failed write, so a timed out
+// connection is always replaced.
+func (n *netConn) setWriteDeadline() error {
+	if n.writeTimeout <= 0 {
+		return nil
+	}
+	return n.conn.SetWriteDeadline(time.Now().Add(n.writeTimeout))
+}
+
 // close the network connection
 func (n *netConn) close() error {
 	return n.conn.Close()
@@ -0,0 +1,97 @@
+package srslog
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startStalledServer accepts TCP connections but never reads from them, so
+// writers eventually block once the socket buffers are full.
+func startStalledServer(t *testing.T) (addr string, accepted func() int, stop func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+		wg    sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+		}
+	}()
+
+	accepted = func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(conns)
+	}
+	stop = func() {
+		l.Close()
+		wg.Wait()
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+	return l.Addr().String(), accepted, stop
+}
+
+func TestNetConnWriteTimeout(t *testing.T) {
+	addr, _, stop := startStalledServer(t)
+	defer stop()
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	var (
+		nc    = netConn{conn: c, writeTimeout: 50 * time.Millisecond}
+		chunk = bytes.Repeat([]byte("x"), 1<<20)
+	)
+	defer nc.close()
+
+	for i := 0; i < 1024; i++ {
+		if _, err = nc.writeBatch(nil, [][]byte{chunk}); err != nil {
+			break
+		}
+	}
+
+	require.Error(t, err, "write should time out")
+	nerr, ok := err.(net.Error)
+	require.True(t, ok, "expected a net.Error, got %T", err)
+	assert.True(t, nerr.Timeout(), "expected a timeout error")
+}
+
+func TestWriterReconnectsAfterWriteTimeout(t *testing.T) {
+	addr, accepted, stop := startStalledServer(t)
+	defer stop()
+
+	w, err := NewWriter("tcp", addr, LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(t, err)
+	w.SetDialTimeout(time.Second)
+	w.SetWriteTimeout(50 * time.Millisecond)
+	defer w.Close()
+
+	msg := bytes.Repeat([]byte("x"), 1<<20)
+	for i := 0; i < 1024 && accepted() < 2; i++ {
+		_, err := w.Write(msg)
+		require.NoError(t, err, "a timed out write should be retried on a new connection")
+	}
+
+	assert.True(t, accepted() >= 2, "should have reconnected after a write timeout")
+}
@@ -0,0 +1,224 @@
+package srslog
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PoolNetwork is the network used by writers that distribute messages among
+// several syslog servers, see SetTargets and SetSRVTargets.
+const PoolNetwork = "pool"
+
+// ErrNoTargets is returned when dialing a pool without any target.
+var ErrNoTargets = errors.New("srslog: no syslog targets available")
+
+// Target is one of the syslog servers used by a pool Writer.
+type Target struct {
+	Network string
+	Raddr   string
+}
+
+// TargetsFunc returns the syslog servers to be used by a pool Writer. It's
+// called every time the pool is dialed.
+type TargetsFunc func() ([]Target, error)
+
+// SetTargets makes a Writer created with the PoolNetwork network distribute
+// messages among the given syslog servers.
+func (w *Writer) SetTargets(targets []Target) {
+	w.targets = func() ([]Target, error) {
+		return targets, nil
+	}
+}
+
+// SetSRVTargets makes a Writer created with the PoolNetwork network distribute
+// messages among the syslog servers published in the DNS SRV record name,
+// connecting to them through network. The record is resolved every time the
+// pool is dialed.
+func (w *Writer) SetSRVTargets(network, name string) {
+	w.targets = func() ([]Target, error) {
+		return LookupSRVTargets(network, name)
+	}
+}
+
+// SetBalanceKey changes how a pool Writer chooses a syslog server. By default,
+// messages are distributed round-robin among the healthy servers. With a
+// non-empty key, every message goes to the server chosen by hashing the key,
+// as long as it's healthy, so all the messages of a given source end up in
+// the same server.
+func (w *Writer) SetBalanceKey(key string) {
+	w.balanceKey = key
+}
+
+// LookupSRVTargets resolves the DNS SRV record name into a list of targets
+// reachable through network, sorted by priority and randomized by weight.
+func LookupSRVTargets(network, name string) ([]Target, error) {
+	_, addrs, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]Target, 0, len(addrs))
+	for _, addr := range addrs {
+		targets = append(targets, Target{
+			Network: network,
+			Raddr:   net.JoinHostPort(addr.Target, strconv.Itoa(int(addr.Port))),
+		})
+	}
+	return targets, nil
+}
+
+// poolDialer resolves the Writer targets and returns a serverConn which
+// distributes the messages among them. It fails unless at least one target
+// is reachable; the remaining ones are dialed when they are first needed.
+func (w *Writer) poolDialer() (serverConn, string, error) {
+	if w.targets == nil {
+		return nil, "", ErrNoTargets
+	}
+
+	targets, err := w.targets()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(targets) == 0 {
+		return nil, "", ErrNoTargets
+	}
+
+	initial, max := w.backoff.config()
+	pc := &poolConn{
+		members: make([]*Writer, 0, len(targets)),
+	}
+	for _, t := range targets {
+		m := &Writer{
+			priority:       w.priority,
+			tag:            w.tag,
+			hostname:       w.getHostname(),
+			network:        t.Network,
+			raddr:          t.Raddr,
+			tlsConfig:      w.tlsConfig,
+			framer:         w.framer,
+			formatter:      w.formatter,
+			dialTimeout:    w.dialTimeout,
+			writeTimeout:   w.writeTimeout,
+			keepAlive:      w.keepAlive,
+			relpWindowSize: w.relpWindowSize,
+			relpRejected:   w.relpRejected,
+		}
+		m.backoff.set(initial, max)
+		pc.members = append(pc.members, m)
+	}
+	if w.balanceKey != "" {
+		h := fnv.New32a()
+		h.Write([]byte(w.balanceKey))
+		pc.hash = int(h.Sum32() % uint32(len(pc.members)))
+		pc.hashed = true
+	}
+
+	for i := range pc.members {
+		m := pc.members[(pc.hash+i)%len(pc.members)]
+		if _, err = m.connect(); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		pc.close()
+		return nil, "", err
+	}
+
+	hostname := w.getHostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return pc, hostname, nil
+}
+
+// poolConn adheres to the serverConn interface, distributing the messages
+// among several syslog servers. Every member is a Writer on its own, so a
+// server that fails is skipped until its reconnect backoff expires.
+type poolConn struct {
+	// members never change once the pool is dialed
+	members []*Writer
+
+	mu     sync.Mutex // guards next
+	next   int
+	hash   int
+	hashed bool
+}
+
+// write formats syslog messages and sends them to the first healthy member.
+func (pc *poolConn) write(
+	framer Framer,
+	formatter Formatter,
+	timestamp time.Time,
+	p Priority,
+	hostname, tag string,
+	msg []byte) error {
+	return pc.each(func(conn serverConn) error {
+		return conn.write(framer, formatter, timestamp, p, hostname, tag, msg)
+	})
+}
+
+// writeBatch sends the batch to the first healthy member, which frames the
+// messages as needed by its transport. The messages taken by a failed member
+// aren't sent again to the next one.
+func (pc *poolConn) writeBatch(framer Framer, msgs [][]byte) (int, error) {
+	var sent int
+	err := pc.each(func(conn serverConn) error {
+		n, err := conn.writeBatch(framer, msgs[sent:])
+		sent += n
+		return err
+	})
+	return sent, err
+}
+
+// each calls fn with the connection of every member, starting with the one
+// chosen by the balancing mode, until one of them succeeds. A member whose
+// connection fails is reconnected once before moving on to the next one.
+// The lock is only held to choose the first member, so a member that is slow
+// to dial doesn't hold back the writes going to the other ones.
+func (pc *poolConn) each(fn func(serverConn) error) error {
+	pc.mu.Lock()
+	start := pc.hash
+	if !pc.hashed {
+		start = pc.next
+		pc.next = (pc.next + 1) % len(pc.members)
+	}
+	pc.mu.Unlock()
+
+	var err error
+	for i := range pc.members {
+		m := pc.members[(start+i)%len(pc.members)]
+		conn := m.acquireConn()
+		if conn != nil {
+			err = fn(conn)
+			m.releaseConn(conn)
+			if err == nil {
+				return nil
+			}
+		}
+
+		if conn, err = m.reconnect(conn); err != nil {
+			continue
+		}
+		err = fn(conn)
+		m.releaseConn(conn)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// close every member connection
+func (pc *poolConn) close() error {
+	var err error
+	for _, m := range pc.members {
+		if cerr := m.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
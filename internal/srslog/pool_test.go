@@ -0,0 +1,183 @@
+package srslog
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolRoundRobin(t *testing.T) {
+	var (
+		require = require.New(t)
+		done1   = make(chan string, 10)
+		done2   = make(chan string, 10)
+	)
+
+	addr1, sock1, srvWG1 := startServer("tcp", "", done1)
+	defer srvWG1.Wait()
+	defer sock1.Close()
+	addr2, sock2, srvWG2 := startServer("tcp", "", done2)
+	defer srvWG2.Wait()
+	defer sock2.Close()
+
+	w, err := NewWriter(PoolNetwork, "", LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetTargets([]Target{{"tcp", addr1}, {"tcp", addr2}})
+	require.NoError(w.Connect())
+	defer w.Close()
+
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		require.NoError(w.Info(msg))
+	}
+
+	check(t, "one", <-done1)
+	check(t, "two", <-done2)
+	check(t, "three", <-done1)
+	check(t, "four", <-done2)
+}
+
+func TestPoolBalanceKey(t *testing.T) {
+	var (
+		require = require.New(t)
+		done1   = make(chan string, 10)
+		done2   = make(chan string, 10)
+	)
+
+	addr1, sock1, srvWG1 := startServer("tcp", "", done1)
+	defer srvWG1.Wait()
+	defer sock1.Close()
+	addr2, sock2, srvWG2 := startServer("tcp", "", done2)
+	defer srvWG2.Wait()
+	defer sock2.Close()
+
+	w, err := NewWriter(PoolNetwork, "", LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetTargets([]Target{{"tcp", addr1}, {"tcp", addr2}})
+	w.SetBalanceKey("7f0ebc7d0b9a")
+	require.NoError(w.Connect())
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(w.Info("sticky"))
+	}
+
+	// every message must go to the same server
+	var rcvd1, rcvd2 int
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-done1:
+			check(t, "sticky", msg)
+			rcvd1++
+		case msg := <-done2:
+			check(t, "sticky", msg)
+			rcvd2++
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+	assert.True(t, rcvd1 == 3 || rcvd2 == 3, "messages were split: %d and %d", rcvd1, rcvd2)
+}
+
+func TestPoolSkipsUnhealthyTargets(t *testing.T) {
+	var (
+		require = require.New(t)
+		done    = make(chan string, 10)
+	)
+
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	// get an address where nobody is listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	deadAddr := l.Addr().String()
+	l.Close()
+
+	w, err := NewWriter(PoolNetwork, "", LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetTargets([]Target{{"tcp", deadAddr}, {"tcp", addr}})
+	w.SetReconnectBackoff(time.Hour, time.Hour)
+	require.NoError(w.Connect(), "should connect while a target is reachable")
+	defer w.Close()
+
+	for _, msg := range []string{"one", "two", "three"} {
+		require.NoError(w.Info(msg))
+		check(t, msg, <-done)
+	}
+}
+
+func TestPoolWithoutReachableTargets(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadAddr := l.Addr().String()
+	l.Close()
+
+	w, err := NewWriter(PoolNetwork, "", LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(t, err)
+	assert.Equal(t, ErrNoTargets, w.Connect())
+
+	w.SetTargets([]Target{{"tcp", deadAddr}})
+	assert.Error(t, w.Connect())
+}
+
+func TestPoolMixedNetworks(t *testing.T) {
+	if !testableNetwork("unix") {
+		t.Skip("'unix' is not supported")
+	}
+
+	var (
+		require = require.New(t)
+		done    = make(chan string, 10)
+	)
+
+	addr, sock, srvWG := startServer("unix", "", done)
+	defer srvWG.Wait()
+	defer os.Remove(addr)
+	defer sock.Close()
+
+	w, err := NewWriter(PoolNetwork, "", LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetTargets([]Target{{"unix", addr}})
+	require.NoError(w.Connect())
+	defer w.Close()
+
+	require.NoError(w.Info("local"))
+	check(t, "local", <-done)
+}
+
+func TestPoolAsyncRELP(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		srv     = startRELPServer(t, nil)
+	)
+	defer srv.close()
+
+	w, err := NewWriter(PoolNetwork, "", LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetTargets([]Target{{"relp", srv.l.Addr().String()}})
+	// RELP members must ignore the framer of the pool
+	w.SetFramer(RFC5425MessageLengthFramer)
+	w.SetRELPWindow(3)
+	require.NoError(w.Connect())
+	w.SetAsync(10)
+
+	pc, ok := w.getConn().(*poolConn)
+	require.True(ok)
+	assert.Equal(3, pc.members[0].relpWindow.size, "members should inherit the RELP window")
+
+	for _, msg := range []string{"one", "two"} {
+		_, err := w.Write([]byte(msg))
+		require.NoError(err)
+	}
+	require.NoError(w.Close())
+
+	for _, msg := range []string{"one", "two"} {
+		check(t, msg, <-srv.msgs+"\n")
+	}
+}
@@ -0,0 +1,179 @@
+package srslog
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recycler keeps track of when the connection of a Writer must be replaced,
+// either because it's too old or because its endpoints should be resolved
+// again. A zero value recycler never replaces a connection.
+type recycler struct {
+	mu          sync.Mutex
+	maxLifetime time.Duration
+	interval    time.Duration
+	connectedAt time.Time
+	resolvedAt  time.Time
+	busy        bool
+}
+
+// SetMaxConnLifetime makes the Writer replace its connection once it has been
+// open for longer than d. The new connection is dialed before closing the old
+// one, so long-lived writers follow DNS changes and pools are rebalanced.
+// Zero means connections are reused forever.
+func (w *Writer) SetMaxConnLifetime(d time.Duration) {
+	w.recycle.mu.Lock()
+	w.recycle.maxLifetime = d
+	w.recycle.mu.Unlock()
+}
+
+// SetResolveInterval makes the Writer resolve its endpoints again every d: the
+// host name of the server, or the targets of a pool Writer. If they no longer
+// match the current connection, it's replaced as with SetMaxConnLifetime.
+// Zero disables the periodic resolution.
+func (w *Writer) SetResolveInterval(d time.Duration) {
+	w.recycle.mu.Lock()
+	w.recycle.interval = d
+	w.recycle.mu.Unlock()
+}
+
+// connected registers a new connection.
+func (r *recycler) connected(now time.Time) {
+	r.mu.Lock()
+	r.connectedAt = now
+	r.resolvedAt = now
+	r.mu.Unlock()
+}
+
+// due checks whether the connection is too old or the endpoints must be
+// resolved again. If so, the caller must call done once it finishes, and
+// other callers won't be told to do the same meanwhile.
+func (r *recycler) due(now time.Time) (expired, resolve bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.busy || r.connectedAt.IsZero() {
+		return false, false
+	}
+
+	expired = r.maxLifetime > 0 && now.Sub(r.connectedAt) >= r.maxLifetime
+	resolve = r.interval > 0 && now.Sub(r.resolvedAt) >= r.interval
+	if resolve {
+		r.resolvedAt = now
+	}
+	r.busy = expired || resolve
+	return
+}
+
+// done marks the end of a check started by due.
+func (r *recycler) done() {
+	r.mu.Lock()
+	r.busy = false
+	r.mu.Unlock()
+}
+
+// maybeRecycle replaces the current connection if it's too old or if its
+// endpoints have changed. Failures are ignored, the current connection is
+// kept until it breaks. The old connection is closed once the writes using
+// it finish.
+func (w *Writer) maybeRecycle() {
+	now := time.Now()
+	expired, resolve := w.recycle.due(now)
+	if !expired && !resolve {
+		return
+	}
+	defer w.recycle.done()
+
+	if !expired && !w.endpointsChanged() {
+		return
+	}
+
+	old := w.getConn()
+	conn, hostname, err := w.dial(now)
+	if err != nil {
+		return
+	}
+	if !w.replaceConn(old, conn, hostname) {
+		// a write has replaced the connection meanwhile
+		w.closeRetired(conn)
+		return
+	}
+	w.recycle.connected(now)
+}
+
+// endpointsChanged resolves the endpoints of the current connection again
+// and reports whether they are different. Resolution errors are not
+// considered a change.
+func (w *Writer) endpointsChanged() bool {
+	switch conn := w.getConn().(type) {
+	case *poolConn:
+		targets, err := w.targets()
+		if err != nil {
+			return false
+		}
+		return conn.changed(targets)
+	case *netConn:
+		return addrChanged(w.raddr, conn.conn.RemoteAddr())
+	case *relpConn:
+		return addrChanged(w.raddr, conn.conn.RemoteAddr())
+	}
+	return false
+}
+
+// addrChanged reports whether the host name in raddr no longer resolves to
+// the address we are connected to.
+func addrChanged(raddr string, remote net.Addr) bool {
+	host, _, err := net.SplitHostPort(raddr)
+	if err != nil || net.ParseIP(host) != nil || remote == nil {
+		return false
+	}
+
+	remoteHost, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return false
+	}
+	remoteIP := net.ParseIP(remoteHost)
+
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.Equal(remoteIP) {
+			return false
+		}
+	}
+	return true
+}
+
+// changed reports whether the pool doesn't match the given targets, or any
+// of the connected members is now resolved to a different address.
+func (pc *poolConn) changed(targets []Target) bool {
+	if len(targets) != len(pc.members) {
+		return true
+	}
+
+	current := make([]string, 0, len(pc.members))
+	for _, m := range pc.members {
+		current = append(current, m.network+"://"+m.raddr)
+	}
+	wanted := make([]string, 0, len(targets))
+	for _, t := range targets {
+		wanted = append(wanted, t.Network+"://"+t.Raddr)
+	}
+	sort.Strings(current)
+	sort.Strings(wanted)
+	for i := range current {
+		if current[i] != wanted[i] {
+			return true
+		}
+	}
+
+	for _, m := range pc.members {
+		if m.endpointsChanged() {
+			return true
+		}
+	}
+	return false
+}
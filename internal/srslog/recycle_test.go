@@ -0,0 +1,177 @@
+package srslog
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxConnLifetime(t *testing.T) {
+	addr, accepted, stop := startStalledServer(t)
+	defer stop()
+
+	w, err := Dial("tcp", addr, LOG_USER|LOG_INFO, "syslog_test")
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, w.Info("first"))
+	assert.Equal(t, 1, accepted())
+
+	w.SetMaxConnLifetime(10 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, w.Info("second"))
+	require.NoError(t, w.Info("third"))
+
+	// wait for the server to accept the new connection
+	for i := 0; i < 100 && accepted() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 2, accepted(), "should have replaced the old connection once")
+}
+
+func TestResolveIntervalRebalancesPool(t *testing.T) {
+	var (
+		require = require.New(t)
+		done1   = make(chan string, 10)
+		done2   = make(chan string, 10)
+	)
+
+	addr1, sock1, srvWG1 := startServer("tcp", "", done1)
+	defer srvWG1.Wait()
+	defer sock1.Close()
+	addr2, sock2, srvWG2 := startServer("tcp", "", done2)
+	defer srvWG2.Wait()
+	defer sock2.Close()
+
+	targets := []Target{{"tcp", addr1}}
+	w, err := NewWriter(PoolNetwork, "", LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.targets = func() ([]Target, error) {
+		return targets, nil
+	}
+	require.NoError(w.Connect())
+	defer w.Close()
+
+	require.NoError(w.Info("before"))
+	check(t, "before", <-done1)
+
+	w.SetResolveInterval(10 * time.Millisecond)
+	targets = []Target{{"tcp", addr2}}
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(w.Info("after"))
+	check(t, "after", <-done2)
+}
+
+func TestAddrChanged(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		remote = &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 514}
+	)
+
+	assert.False(addrChanged("127.0.0.1:514", remote), "literal addresses never change")
+	assert.False(addrChanged("localhost:514", remote))
+	assert.True(addrChanged("localhost:514", &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 514}))
+}
+
+// countingConn is a serverConn which only counts how many times it's closed
+type countingConn struct {
+	closed int32
+}
+
+func (c *countingConn) write(Framer, Formatter, time.Time, Priority, string, string, []byte) error {
+	return nil
+}
+
+func (c *countingConn) writeBatch(_ Framer, msgs [][]byte) (int, error) {
+	return len(msgs), nil
+}
+
+func (c *countingConn) close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+func TestReplacedConnClosedOnRelease(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		old     = &countingConn{}
+		first   = &countingConn{}
+		second  = &countingConn{}
+		w       = &Writer{}
+	)
+
+	require.True(w.replaceConn(nil, old, "host1"))
+	conn := w.acquireConn()
+	require.Equal(old, conn)
+
+	require.True(w.replaceConn(old, first, "host2"))
+	assert.Equal("host2", w.getHostname())
+	w.closing.Wait()
+	assert.Zero(atomic.LoadInt32(&old.closed), "must not close a connection in use")
+
+	// the old connection was already replaced, so it's not replaced again
+	assert.False(w.replaceConn(old, second, "host3"))
+	w.closeRetired(second)
+
+	w.releaseConn(conn)
+	w.closing.Wait()
+	assert.Equal(int32(1), atomic.LoadInt32(&old.closed))
+	assert.Equal(int32(1), atomic.LoadInt32(&second.closed))
+	assert.Zero(atomic.LoadInt32(&first.closed))
+
+	require.NoError(w.Close())
+	assert.Equal(int32(1), atomic.LoadInt32(&first.closed))
+}
+
+func TestRecycleWhileWriting(t *testing.T) {
+	const (
+		writers  = 8
+		messages = 50
+	)
+	done := make(chan string, writers*messages)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	w, err := Dial("tcp", addr, LOG_USER|LOG_INFO, "syslog_test")
+	require.NoError(t, err)
+	w.SetMaxConnLifetime(time.Millisecond)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*messages)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				if err := w.Info("recycled"); err != nil {
+					errs <- err
+				}
+				if j%10 == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, w.Close())
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for i := 0; i < writers*messages; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d messages, want %d", i, writers*messages)
+		}
+	}
+}
@@ -0,0 +1,568 @@
+package srslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RELP (Reliable Event Logging Protocol) support. Every message is sent as a
+// "syslog" command and acknowledged by the server. Up to a window of
+// messages may be waiting for their acknowledgement; the ones that are still
+// unacknowledged when the connection breaks are sent again as soon as the
+// Writer reconnects. See https://www.rsyslog.com/doc/relp.html
+const (
+	relpNetwork    = "relp"
+	relpTLSNetwork = "relp+tls"
+
+	// default number of unacknowledged messages
+	defaultRELPWindow = 128
+
+	relpMaxTxnr      = 999999999
+	relpMaxFrame     = 128 * 1024
+	relpCloseTimeout = 5 * time.Second
+
+	// number of times a message can be rejected by the server before it's
+	// dropped
+	relpMaxRejections = 3
+
+	relpOffers = "relp_version=0\nrelp_software=srslog\ncommands=syslog"
+)
+
+// ErrRELPClosed is returned when writing to a RELP connection closed by the
+// server.
+var ErrRELPClosed = errors.New("srslog: relp connection closed by server")
+
+// SetRELPWindow changes the number of messages that can be waiting for an
+// acknowledgement on a RELP connection before writes block. It must be called
+// before the Writer connects.
+func (w *Writer) SetRELPWindow(size int) {
+	if size < 1 {
+		size = 1
+	}
+	w.relpWindowSize = size
+}
+
+// SetRELPRejectHandler sets a function called with the messages dropped after
+// being rejected by the RELP server too many times, and the last error. It
+// must be called before the Writer connects.
+func (w *Writer) SetRELPRejectHandler(f func(msg []byte, err error)) {
+	w.relpRejected = f
+}
+
+// relpDialer connects to a RELP server, over TLS for the "relp+tls" network.
+// The window of unacknowledged messages outlives the connection, so they
+// are sent again on the new one.
+func (w *Writer) relpDialer() (serverConn, string, error) {
+	var (
+		c   net.Conn
+		err error
+	)
+	if w.network == relpTLSNetwork {
+		c, err = tls.DialWithDialer(w.netDialer(), "tcp", w.raddr, w.tlsConfig)
+	} else {
+		c, err = w.netDialer().Dial("tcp", w.raddr)
+	}
+	if err != nil {
+		return nil, w.getHostname(), err
+	}
+
+	w.mu.Lock()
+	if w.relpWindow == nil {
+		size := w.relpWindowSize
+		if size == 0 {
+			size = defaultRELPWindow
+		}
+		w.relpWindow = newRELPWindow(size, w.relpRejected)
+	}
+	window := w.relpWindow
+	w.mu.Unlock()
+
+	rc, err := openRELPConn(c, window, w.writeTimeout)
+	if err != nil {
+		c.Close()
+		return nil, w.getHostname(), err
+	}
+
+	hostname := w.getHostname()
+	if hostname == "" {
+		hostname = c.LocalAddr().String()
+	}
+	return rc, hostname, nil
+}
+
+// relpFrame is a message waiting for its acknowledgement on the connection
+// which sent it last, or for a new connection to send it again if the owner
+// is nil
+type relpFrame struct {
+	owner *relpConn
+	txnr  int
+	data  []byte
+	// number of times the server rejected the message
+	rejections int
+}
+
+// relpWindow holds the unacknowledged messages of a Writer.
+type relpWindow struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	size    int
+	pending []relpFrame
+	// called with the dropped messages, if not nil
+	rejected func(msg []byte, err error)
+}
+
+func newRELPWindow(size int, rejected func([]byte, error)) *relpWindow {
+	rw := &relpWindow{size: size, rejected: rejected}
+	rw.cond = sync.NewCond(&rw.mu)
+	return rw
+}
+
+// relpConn adheres to the serverConn interface, sending syslog messages to
+// a RELP server.
+type relpConn struct {
+	conn         net.Conn
+	reader       *bufio.Reader
+	window       *relpWindow
+	writeTimeout time.Duration
+
+	wmu  sync.Mutex // serializes frames on the connection
+	txnr int
+
+	// guarded by window.mu
+	err  error
+	done chan struct{}
+}
+
+// openRELPConn opens the RELP session, starts reading the acknowledgements,
+// and sends again the messages left by the previous connections that are
+// gone. Messages still owned by a previous connection, which may yet be
+// acknowledged, are not sent again.
+func openRELPConn(c net.Conn, window *relpWindow, writeTimeout time.Duration) (*relpConn, error) {
+	rc := &relpConn{
+		conn:         c,
+		reader:       bufio.NewReader(c),
+		window:       window,
+		writeTimeout: writeTimeout,
+		done:         make(chan struct{}),
+	}
+
+	txnr, err := rc.writeFrame("open", []byte(relpOffers))
+	if err != nil {
+		return nil, err
+	}
+	if writeTimeout > 0 {
+		c.SetReadDeadline(time.Now().Add(writeTimeout))
+	}
+	rsp, err := readRELPFrame(rc.reader)
+	if err != nil {
+		return nil, err
+	}
+	c.SetReadDeadline(time.Time{})
+	if rsp.txnr != txnr || rsp.command != "rsp" {
+		return nil, fmt.Errorf("srslog: unexpected relp frame %d %s", rsp.txnr, rsp.command)
+	}
+	if err := relpStatus(rsp.data); err != nil {
+		return nil, err
+	}
+
+	go rc.readAcks()
+
+	rc.wmu.Lock()
+	defer rc.wmu.Unlock()
+	rc.window.mu.Lock()
+	frames := rc.claim()
+	rc.window.mu.Unlock()
+	if err := rc.replay(frames); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// claim takes over the messages left by the connections that are gone, so
+// rc sends them again. The caller must hold rc.wmu and the window lock.
+func (rc *relpConn) claim() []relpFrame {
+	var frames []relpFrame
+	for i := range rc.window.pending {
+		if f := &rc.window.pending[i]; f.owner == nil {
+			rc.txnr = nextRELPTxnr(rc.txnr)
+			f.owner, f.txnr = rc, rc.txnr
+			frames = append(frames, *f)
+		}
+	}
+	if len(frames) > 0 {
+		rc.armAckTimeout()
+	}
+	return frames
+}
+
+// replay sends the messages returned by claim. If it fails, the connection
+// is marked as broken, so they are left for the next connection. The caller
+// must hold rc.wmu.
+func (rc *relpConn) replay(frames []relpFrame) error {
+	for _, f := range frames {
+		if err := rc.writeFrameWithTxnr(f.txnr, "syslog", f.data); err != nil {
+			rc.fail(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// write formats syslog messages and sends them as RELP syslog commands. RELP
+// has its own framing, so the framer is ignored.
+func (rc *relpConn) write(
+	_ Framer,
+	formatter Formatter,
+	timestamp time.Time,
+	p Priority,
+	hostname, tag string,
+	msg []byte) error {
+	if formatter == nil {
+		formatter = DefaultFormatter
+	}
+
+	// the caller may reuse the formatted message, but we may need to send it
+	// again, so we keep our own copy
+	fmsg := formatter(timestamp, p, hostname, tag, msg)
+	return rc.send(append([]byte(nil), fmsg...))
+}
+
+// writeBatch sends already formatted messages as RELP syslog commands. RELP
+// has its own framing, so the framer is ignored. The messages sent before
+// failing are in the window, so they are counted as sent.
+func (rc *relpConn) writeBatch(_ Framer, msgs [][]byte) (int, error) {
+	for i, msg := range msgs {
+		if err := rc.send(msg); err != nil {
+			return i, err
+		}
+	}
+	return len(msgs), nil
+}
+
+// send adds the message to the window, waiting for room if needed, and
+// writes it to the connection. If the write fails, the message is removed
+// from the window so the caller can send it again after reconnecting. The
+// messages left meanwhile by a previous connection are sent again first.
+// The wait is bounded by the acknowledgement timeout of the connections
+// owning the messages in the window, see armAckTimeout.
+func (rc *relpConn) send(data []byte) error {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+
+	rc.wmu.Lock()
+	defer rc.wmu.Unlock()
+
+	rc.window.mu.Lock()
+	for rc.err == nil {
+		if frames := rc.claim(); len(frames) > 0 {
+			rc.window.mu.Unlock()
+			if err := rc.replay(frames); err != nil {
+				return err
+			}
+			rc.window.mu.Lock()
+			continue
+		}
+		if len(rc.window.pending) < rc.window.size {
+			break
+		}
+		rc.window.cond.Wait()
+	}
+	if rc.err != nil {
+		err := rc.err
+		rc.window.mu.Unlock()
+		return err
+	}
+	rc.txnr = nextRELPTxnr(rc.txnr)
+	txnr := rc.txnr
+	rc.window.pending = append(rc.window.pending, relpFrame{owner: rc, txnr: txnr, data: data})
+	rc.armAckTimeout()
+	rc.window.mu.Unlock()
+
+	if err := rc.writeFrameWithTxnr(txnr, "syslog", data); err != nil {
+		rc.window.mu.Lock()
+		rc.window.ack(rc, txnr)
+		rc.window.mu.Unlock()
+		rc.fail(err)
+		return err
+	}
+	return nil
+}
+
+// writeFrame writes a frame with the next transaction number. It must be
+// called before the acknowledgements reader is started.
+func (rc *relpConn) writeFrame(command string, data []byte) (int, error) {
+	rc.txnr = nextRELPTxnr(rc.txnr)
+	return rc.txnr, rc.writeFrameWithTxnr(rc.txnr, command, data)
+}
+
+func (rc *relpConn) writeFrameWithTxnr(txnr int, command string, data []byte) error {
+	if rc.writeTimeout > 0 {
+		if err := rc.conn.SetWriteDeadline(time.Now().Add(rc.writeTimeout)); err != nil {
+			return err
+		}
+	}
+
+	header := strconv.Itoa(txnr) + " " + command + " " + strconv.Itoa(len(data))
+	if len(data) > 0 {
+		header += " "
+	}
+	nb := net.Buffers{[]byte(header), data, []byte{'\n'}}
+	_, err := nb.WriteTo(rc.conn)
+	return err
+}
+
+// readAcks removes every acknowledged message from the window, until the
+// connection breaks. Then, the messages that were not acknowledged are left
+// for the next connection.
+func (rc *relpConn) readAcks() {
+	defer close(rc.done)
+	defer rc.release()
+
+	for {
+		f, err := readRELPFrame(rc.reader)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				err = fmt.Errorf("srslog: relp acknowledgement timeout: %w", err)
+			}
+			rc.fail(err)
+			return
+		}
+
+		switch f.command {
+		case "rsp":
+			if err := relpStatus(f.data); err != nil {
+				rc.window.mu.Lock()
+				data, dropped := rc.window.reject(rc, f.txnr)
+				if dropped {
+					rc.armAckTimeout()
+					rc.window.cond.Broadcast()
+				}
+				rc.window.mu.Unlock()
+				if !dropped {
+					// the message will be sent again after reconnecting
+					rc.fail(err)
+					return
+				}
+				if rc.window.rejected != nil {
+					rc.window.rejected(data, err)
+				}
+				continue
+			}
+			rc.window.mu.Lock()
+			rc.window.ack(rc, f.txnr)
+			rc.armAckTimeout()
+			rc.window.cond.Broadcast()
+			rc.window.mu.Unlock()
+		case "serverclose":
+			rc.fail(ErrRELPClosed)
+			return
+		}
+	}
+}
+
+// armAckTimeout makes the acknowledgements reader fail if the server doesn't
+// acknowledge anything within the write timeout while rc has messages waiting
+// for their acknowledgement, so a server that stops acknowledging but keeps
+// the session open can't block the writers forever. The deadline is cleared
+// once every message is acknowledged. The caller must hold the window lock.
+func (rc *relpConn) armAckTimeout() {
+	if rc.writeTimeout <= 0 {
+		return
+	}
+	if rc.window.owns(rc) {
+		rc.conn.SetReadDeadline(time.Now().Add(rc.writeTimeout))
+	} else {
+		rc.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// fail marks the connection as broken, waking up any blocked writer.
+func (rc *relpConn) fail(err error) {
+	rc.window.mu.Lock()
+	if rc.err == nil {
+		rc.err = err
+	}
+	rc.window.cond.Broadcast()
+	rc.window.mu.Unlock()
+	rc.conn.Close()
+}
+
+// release gives up the messages that rc didn't get acknowledged, waking up
+// any writer so they are sent again.
+func (rc *relpConn) release() {
+	rc.window.mu.Lock()
+	for i := range rc.window.pending {
+		if rc.window.pending[i].owner == rc {
+			rc.window.pending[i].owner = nil
+		}
+	}
+	rc.window.cond.Broadcast()
+	rc.window.mu.Unlock()
+}
+
+// owns reports whether any message sent by rc is waiting for its
+// acknowledgement. The caller must hold the window lock.
+func (rw *relpWindow) owns(rc *relpConn) bool {
+	for _, f := range rw.pending {
+		if f.owner == rc {
+			return true
+		}
+	}
+	return false
+}
+
+// reject counts a rejection of the message sent by rc with the given
+// transaction number. The message is removed once it's rejected too many
+// times, as sending it again would fail the same way, and it's returned with
+// dropped true. The caller must hold the window lock.
+func (rw *relpWindow) reject(rc *relpConn, txnr int) (data []byte, dropped bool) {
+	for i := range rw.pending {
+		f := &rw.pending[i]
+		if f.owner != rc || f.txnr != txnr {
+			continue
+		}
+		if f.rejections++; f.rejections < relpMaxRejections {
+			return nil, false
+		}
+		data = f.data
+		rw.pending = append(rw.pending[:i], rw.pending[i+1:]...)
+		return data, true
+	}
+	return nil, false
+}
+
+// ack removes the message sent by rc with the given transaction number. The
+// caller must hold the window lock.
+func (rw *relpWindow) ack(rc *relpConn, txnr int) {
+	for i, f := range rw.pending {
+		if f.owner == rc && f.txnr == txnr {
+			rw.pending = append(rw.pending[:i], rw.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// close sends again the messages left by the previous connections, waits a
+// bit for the acknowledgements of the messages sent by rc, then ends the
+// RELP session and closes the connection. Messages that were not
+// acknowledged stay in the window.
+func (rc *relpConn) close() error {
+	rc.wmu.Lock()
+	defer rc.wmu.Unlock()
+
+	rc.window.mu.Lock()
+	frames := rc.claim()
+	rc.window.mu.Unlock()
+	rc.replay(frames)
+
+	deadline := time.Now().Add(relpCloseTimeout)
+	timer := time.AfterFunc(relpCloseTimeout, func() {
+		rc.window.mu.Lock()
+		rc.window.cond.Broadcast()
+		rc.window.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	rc.window.mu.Lock()
+	for rc.window.owns(rc) && rc.err == nil && time.Now().Before(deadline) {
+		rc.window.cond.Wait()
+	}
+	broken := rc.err != nil
+	rc.window.mu.Unlock()
+
+	if !broken {
+		rc.txnr = nextRELPTxnr(rc.txnr)
+		rc.writeFrameWithTxnr(rc.txnr, "close", nil)
+	}
+	err := rc.conn.Close()
+	<-rc.done
+	if broken {
+		return nil
+	}
+	return err
+}
+
+// relpResponse is a frame received from the server
+type relpResponse struct {
+	txnr    int
+	command string
+	data    []byte
+}
+
+// readRELPFrame reads a "TXNR SP COMMAND SP DATALEN [SP DATA] LF" frame
+func readRELPFrame(r *bufio.Reader) (relpResponse, error) {
+	var f relpResponse
+
+	txnr, err := r.ReadString(' ')
+	if err != nil {
+		return f, err
+	}
+	if f.txnr, err = strconv.Atoi(txnr[:len(txnr)-1]); err != nil {
+		return f, fmt.Errorf("srslog: invalid relp txnr: %v", err)
+	}
+
+	command, err := r.ReadString(' ')
+	if err != nil {
+		return f, err
+	}
+	f.command = command[:len(command)-1]
+
+	var datalen []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return f, err
+		}
+		if c == ' ' || c == '\n' {
+			size, err := strconv.Atoi(string(datalen))
+			if err != nil || size < 0 || size > relpMaxFrame {
+				return f, fmt.Errorf("srslog: invalid relp data length %q", datalen)
+			}
+			if c == '\n' {
+				if size != 0 {
+					return f, fmt.Errorf("srslog: missing relp data")
+				}
+				return f, nil
+			}
+			f.data = make([]byte, size)
+			if _, err := io.ReadFull(r, f.data); err != nil {
+				return f, err
+			}
+			break
+		}
+		datalen = append(datalen, c)
+	}
+
+	if c, err := r.ReadByte(); err != nil {
+		return f, err
+	} else if c != '\n' {
+		return f, fmt.Errorf("srslog: invalid relp frame trailer %q", c)
+	}
+	return f, nil
+}
+
+// relpStatus returns an error unless a rsp frame reports success
+func relpStatus(data []byte) error {
+	if bytes.HasPrefix(data, []byte("200")) {
+		return nil
+	}
+	status := data
+	if i := bytes.IndexByte(status, '\n'); i >= 0 {
+		status = status[:i]
+	}
+	return fmt.Errorf("srslog: relp server error: %s", status)
+}
+
+func nextRELPTxnr(txnr int) int {
+	if txnr >= relpMaxTxnr {
+		return 1
+	}
+	return txnr + 1
+}
@@ -0,0 +1,389 @@
+package srslog
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relpServer is a minimal in-process RELP server. Every received syslog
+// message is sent to msgs, and answered with the status returned by rsp, or
+// not answered if it's empty.
+type relpServer struct {
+	l    net.Listener
+	msgs chan string
+	rsp  func(conn int, msg string) string
+
+	mu    sync.Mutex
+	conns []net.Conn
+	wg    sync.WaitGroup
+}
+
+// startRELPServer starts a server acknowledging every message unless ack
+// returns false
+func startRELPServer(t *testing.T, ack func(int, string) bool) *relpServer {
+	return startRELPServerWithStatus(t, func(conn int, msg string) string {
+		if ack != nil && !ack(conn, msg) {
+			return ""
+		}
+		return "200 OK"
+	})
+}
+
+func startRELPServerWithStatus(t *testing.T, rsp func(int, string) string) *relpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &relpServer{
+		l:    l,
+		msgs: make(chan string, 100),
+		rsp:  rsp,
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for n := 0; ; n++ {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, c)
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go s.serve(n, c)
+		}
+	}()
+	return s
+}
+
+func (s *relpServer) serve(n int, c net.Conn) {
+	defer s.wg.Done()
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	for {
+		f, err := readRELPFrame(r)
+		if err != nil {
+			return
+		}
+
+		var rsp string
+		switch f.command {
+		case "open":
+			rsp = "200 OK\n" + relpOffers
+		case "syslog":
+			s.msgs <- string(f.data)
+			if rsp = s.rsp(n, string(f.data)); rsp == "" {
+				continue
+			}
+		case "close":
+			c.Write([]byte(strconv.Itoa(f.txnr) + " rsp 0\n0 serverclose 0\n"))
+			return
+		}
+		c.Write([]byte(strconv.Itoa(f.txnr) + " rsp " + strconv.Itoa(len(rsp)) + " " + rsp + "\n"))
+	}
+}
+
+// closeConn closes the n-th connection accepted by the server
+func (s *relpServer) closeConn(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[n].Close()
+}
+
+func (s *relpServer) close() {
+	s.l.Close()
+	s.mu.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func pendingRELP(w *Writer) int {
+	w.relpWindow.mu.Lock()
+	defer w.relpWindow.mu.Unlock()
+	return len(w.relpWindow.pending)
+}
+
+func TestRELPWrite(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		srv     = startRELPServer(t, nil)
+	)
+	defer srv.close()
+
+	w, err := Dial("relp", srv.l.Addr().String(), LOG_USER|LOG_INFO, "syslog_test")
+	require.NoError(err, "Dial() failed")
+
+	for _, msg := range []string{"one", "two", "three"} {
+		require.NoError(w.Info(msg))
+		check(t, msg, <-srv.msgs+"\n")
+	}
+
+	require.NoError(w.Close())
+	assert.Equal(0, pendingRELP(w), "every message should be acknowledged")
+}
+
+func TestRELPRetransmitsAfterReconnect(t *testing.T) {
+	var (
+		require = require.New(t)
+		// the first connection never acknowledges anything
+		srv = startRELPServer(t, func(conn int, _ string) bool { return conn > 0 })
+	)
+	defer srv.close()
+
+	w, err := Dial("relp", srv.l.Addr().String(), LOG_USER|LOG_INFO, "syslog_test")
+	require.NoError(err, "Dial() failed")
+	defer w.Close()
+
+	require.NoError(w.Info("one"))
+	require.NoError(w.Info("two"))
+	check(t, "one", <-srv.msgs+"\n")
+	check(t, "two", <-srv.msgs+"\n")
+	require.Equal(2, pendingRELP(w))
+
+	// break the connection and wait until the writer notices it
+	srv.closeConn(0)
+	rc := w.getConn().(*relpConn)
+	for i := 0; i < 100; i++ {
+		select {
+		case <-rc.done:
+			i = 100
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	require.NoError(w.Info("three"))
+	check(t, "one", <-srv.msgs+"\n")
+	check(t, "two", <-srv.msgs+"\n")
+	check(t, "three", <-srv.msgs+"\n")
+
+	for i := 0; i < 100 && pendingRELP(w) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(0, pendingRELP(w), "every message should be acknowledged")
+}
+
+func TestRELPWindow(t *testing.T) {
+	var (
+		require = require.New(t)
+		release = make(chan struct{})
+		srv     = startRELPServer(t, func(_ int, msg string) bool {
+			<-release
+			return true
+		})
+	)
+	defer srv.close()
+
+	w, err := NewWriter("relp", srv.l.Addr().String(), LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetRELPWindow(1)
+	require.NoError(w.Connect())
+	defer w.Close()
+
+	require.NoError(w.Info("one"))
+
+	written := make(chan error)
+	go func() {
+		written <- w.Info("two")
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("write should block while the window is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(<-written)
+}
+
+func TestReadRELPFrame(t *testing.T) {
+	assert := assert.New(t)
+
+	r := bufio.NewReader(strings.NewReader("2 rsp 6 200 OK\n0 serverclose 0\n3 rsp 3 abc"))
+
+	f, err := readRELPFrame(r)
+	assert.NoError(err)
+	assert.Equal(relpResponse{2, "rsp", []byte("200 OK")}, f)
+
+	f, err = readRELPFrame(r)
+	assert.NoError(err)
+	assert.Equal(relpResponse{0, "serverclose", nil}, f)
+
+	_, err = readRELPFrame(r)
+	assert.Error(err, "should fail without trailer")
+
+	assert.NoError(relpStatus([]byte("200 OK")))
+	assert.Error(relpStatus([]byte("500 error\nmore")))
+}
+
+func TestRELPNoRetransmitWhileOldConnIsOpen(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		release = make(chan struct{})
+		// the first connection acknowledges once released
+		srv = startRELPServer(t, func(conn int, _ string) bool {
+			if conn == 0 {
+				<-release
+			}
+			return true
+		})
+	)
+	defer srv.close()
+
+	w, err := Dial("relp", srv.l.Addr().String(), LOG_USER|LOG_INFO, "syslog_test")
+	require.NoError(err, "Dial() failed")
+
+	require.NoError(w.Info("one"))
+	check(t, "one", <-srv.msgs+"\n")
+
+	// replace the connection, as when it's recycled, while the old one may
+	// still acknowledge the message
+	require.NoError(w.Connect())
+	require.NoError(w.Info("two"))
+	check(t, "two", <-srv.msgs+"\n")
+
+	close(release)
+	require.NoError(w.Close())
+	assert.Equal(0, pendingRELP(w), "every message should be acknowledged")
+	assert.Len(srv.msgs, 0, "no message should be sent twice")
+}
+
+func TestRELPBatchNotSentTwice(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		srv     *relpServer
+		started = make(chan struct{})
+	)
+	// the first connection breaks after receiving the first message, while
+	// the second one waits for room in the window
+	srv = startRELPServer(t, func(conn int, _ string) bool {
+		if conn == 0 {
+			<-started
+			srv.closeConn(0)
+			return false
+		}
+		return true
+	})
+	close(started)
+	defer srv.close()
+
+	w, err := NewWriter("relp", srv.l.Addr().String(), LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetRELPWindow(1)
+	require.NoError(w.Connect())
+	defer w.Close()
+
+	require.NoError(w.sendBatch([][]byte{[]byte("one\n"), []byte("two\n"), []byte("three\n")}))
+
+	// the first message is only sent again from the window
+	for _, msg := range []string{"one", "one", "two", "three"} {
+		select {
+		case got := <-srv.msgs:
+			assert.Equal(msg, got)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %q", msg)
+		}
+	}
+	select {
+	case got := <-srv.msgs:
+		t.Fatalf("unexpected message %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRELPAckTimeout(t *testing.T) {
+	var (
+		require = require.New(t)
+		// the server keeps the session open but never acknowledges anything
+		srv = startRELPServer(t, func(int, string) bool { return false })
+	)
+	defer srv.close()
+
+	w, err := NewWriter("relp", srv.l.Addr().String(), LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetRELPWindow(1)
+	w.SetWriteTimeout(50 * time.Millisecond)
+	require.NoError(w.Connect())
+
+	require.NoError(w.Info("one"))
+
+	// the writes waiting for room in the window and the close give up
+	written := make(chan error)
+	go func() {
+		written <- w.Info("two")
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write blocked waiting for an acknowledgement")
+	}
+
+	closed := make(chan error)
+	go func() {
+		closed <- w.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(relpCloseTimeout / 2):
+		t.Fatal("close blocked waiting for an acknowledgement")
+	}
+}
+
+func TestRELPDropsRejectedMessage(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		srv     = startRELPServerWithStatus(t, func(_ int, msg string) string {
+			if strings.Contains(msg, "bad") {
+				return "500 rejected"
+			}
+			return "200 OK"
+		})
+		rejected = make(chan string, 1)
+	)
+	defer srv.close()
+	go func() {
+		// the server gets every message, but only the rejections matter
+		for range srv.msgs {
+		}
+	}()
+
+	w, err := NewWriter("relp", srv.l.Addr().String(), LOG_USER|LOG_INFO, "syslog_test", nil)
+	require.NoError(err)
+	w.SetRELPRejectHandler(func(msg []byte, err error) {
+		assert.Error(err)
+		rejected <- string(msg)
+	})
+	require.NoError(w.Connect())
+
+	require.NoError(w.Info("bad"))
+	// every write reconnects after a rejection and sends the message again
+	// until it's dropped
+	for i := 0; i < 100; i++ {
+		w.Info("good")
+		select {
+		case msg := <-rejected:
+			assert.Contains(msg, "bad")
+			require.NoError(w.Close())
+			assert.Equal(0, pendingRELP(w), "the good messages should be acknowledged")
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("the rejected message wasn't dropped")
+}
@@ -21,6 +21,9 @@ type serverConn interface {
 		p Priority,
 		hostname, tag string,
 		msg []byte) error
+	// writeBatch returns how many messages were sent, or queued to be sent
+	// again after reconnecting, before failing
+	writeBatch(framer Framer, msgs [][]byte) (int, error)
 	close() error
 }
 
@@ -39,7 +42,8 @@ func New(priority Priority, tag string) (w *Writer, err error) {
 // address raddr on the specified network.  Each write to the returned
 // Writer sends a log message with the given facility, severity and
 // tag.
-// If network is empty, Dial will connect to the local syslog server.
+// If network is empty, Dial will connect to the local syslog server, through
+// the Unix socket at raddr if it is not empty.
 func Dial(network, raddr string, priority Priority, tag string) (*Writer, error) {
 	return DialWithTLSConfig(network, raddr, priority, tag, nil)
 }
@@ -91,8 +95,29 @@ func DialWithTLSConfig(network, raddr string, priority Priority, tag string, tls
 	return dialAllParameters(network, raddr, priority, tag, tlsConfig, nil)
 }
 
+// NewWriter returns a Writer for the log daemon at address raddr on the
+// specified network, without connecting to it. The connection is made by
+// Connect or by the first write, so the daemon doesn't need to be reachable
+// yet. tlsConfig is only used by the "tcp+tls" network.
+func NewWriter(network, raddr string, priority Priority, tag string, tlsConfig *tls.Config) (*Writer, error) {
+	return newWriter(network, raddr, priority, tag, tlsConfig, nil)
+}
+
 // implementation of the various functions above
 func dialAllParameters(network, raddr string, priority Priority, tag string, tlsConfig *tls.Config, customDial DialFunc) (*Writer, error) {
+	w, err := newWriter(network, raddr, priority, tag, tlsConfig, customDial)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// newWriter builds a Writer without connecting it.
+func newWriter(network, raddr string, priority Priority, tag string, tlsConfig *tls.Config, customDial DialFunc) (*Writer, error) {
 	if err := validatePriority(priority); err != nil {
 		return nil, err
 	}
@@ -112,11 +137,7 @@ func dialAllParameters(network, raddr string, priority Priority, tag string, tls
 		customDial: customDial,
 	}
 
-	_, err := w.connect()
-	if err != nil {
-		return nil, err
-	}
-	return w, err
+	return w, nil
 }
 
 // NewLogger creates a log.Logger whose output is written to
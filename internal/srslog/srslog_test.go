@@ -4,14 +4,18 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -563,3 +567,66 @@ func (c testLocalConn) Write(b []byte) (int, error) {
 func (c testLocalConn) Close() error {
 	return nil
 }
+
+func TestLocalSocketPath(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+	if !testableNetwork("unixgram") {
+		t.Skip("unixgram is not supported")
+	}
+
+	dir, err := ioutil.TempDir("", "syslogtest")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log")
+	l, err := net.ListenPacket("unixgram", path)
+	require.NoError(err)
+	defer l.Close()
+
+	w, err := Dial("", path, LOG_USER|LOG_INFO, "syslog_test")
+	require.NoError(err, "Dial() should use the given socket")
+	defer w.Close()
+
+	lc, ok := w.getConn().(*localConn)
+	require.True(ok)
+	assert.True(lc.datagram)
+
+	// a datagram larger than the send buffer grows it
+	require.NoError(lc.conn.(*net.UnixConn).SetWriteBuffer(4096))
+	msg := strings.Repeat("x", 16*1024)
+	require.NoError(w.Info(msg))
+
+	buf := make([]byte, 64*1024)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := l.ReadFrom(buf)
+	require.NoError(err)
+	assert.Contains(string(buf[:n]), msg+"\n", "the whole message should be a single datagram")
+}
+
+func TestLocalConnMessageTooLarge(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		messages = make([]string, 0)
+		lc       = localConn{conn: tooLargeConn{newTestLocalConn(&messages)}, datagram: true}
+	)
+
+	_, err := lc.writeBatch(nil, [][]byte{[]byte("small"), []byte("too large"), []byte("other")})
+	assert.True(errors.Is(err, ErrMessageTooLarge), "should report the message too large")
+	assert.Equal([]string{"small", "other"}, messages, "should write the other messages")
+}
+
+// tooLargeConn fails to write messages with a space like datagrams over the
+// send buffer size
+type tooLargeConn struct {
+	testLocalConn
+}
+
+func (c tooLargeConn) Write(b []byte) (int, error) {
+	if bytes.Contains(b, []byte(" ")) {
+		return 0, &net.OpError{Op: "write", Net: "unixgram", Err: os.NewSyscallError("write", syscall.EMSGSIZE)}
+	}
+	return c.testLocalConn.Write(b)
+}
@@ -3,11 +3,17 @@ package srslog
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"syscall"
 	"time"
 )
 
+// ErrMessageTooLarge is returned when a message doesn't fit in a datagram of
+// the local syslog socket. Reconnecting doesn't help, so it's not retried.
+var ErrMessageTooLarge = errors.New("srslog: message too large for the local syslog socket")
+
 // unixSyslog opens a connection to the syslog daemon running on the
 // local machine using a Unix domain socket. This function exists because of
 // Solaris support as implemented by gccgo.  On Solaris you can not
@@ -15,16 +21,21 @@ import (
 // sources have a syslog_solaris.go file that implements unixSyslog to
 // return a type that satisfies the serverConn interface and simply calls the C
 // library syslog function.
-func unixSyslog() (conn serverConn, err error) {
+//
+// If path is empty, the usual socket paths are tried.
+func unixSyslog(path string) (conn serverConn, err error) {
 	logTypes := []string{"unixgram", "unix"}
 	logPaths := []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+	if path != "" {
+		logPaths = []string{path}
+	}
 	for _, network := range logTypes {
 		for _, path := range logPaths {
 			conn, err := net.Dial(network, path)
 			if err != nil {
 				continue
 			} else {
-				return &localConn{conn: conn}, nil
+				return &localConn{conn: conn, datagram: network == "unixgram"}, nil
 			}
 		}
 	}
@@ -34,7 +45,8 @@ func unixSyslog() (conn serverConn, err error) {
 // localConn adheres to the serverConn interface, allowing us to send syslog
 // messages to the local syslog daemon over a Unix domain socket.
 type localConn struct {
-	conn io.WriteCloser
+	conn     io.WriteCloser
+	datagram bool
 }
 
 // write formats syslog messages using time.Stamp instead of time.RFC3339,
@@ -63,8 +75,47 @@ func (n *localConn) write(
 	default:
 		wmsg = bytes.Join(fmsg, []byte{})
 	}
-	_, err := n.conn.Write(wmsg)
-	return err
+	return n.send(wmsg)
+}
+
+// writeBatch frames and sends several already formatted messages, one at a
+// time, as the local daemon may be listening on a datagram socket. Messages
+// too large for a datagram are skipped, so they don't hold back the rest.
+func (n *localConn) writeBatch(framer Framer, msgs [][]byte) (int, error) {
+	if framer == nil {
+		framer = DefaultFramer
+	}
+
+	var tooLarge error
+	for i, msg := range msgs {
+		if err := n.send(bytes.Join(framer(msg), nil)); err != nil {
+			if !errors.Is(err, ErrMessageTooLarge) {
+				return i, err
+			}
+			tooLarge = err
+		}
+	}
+	return len(msgs), tooLarge
+}
+
+// send writes a single message. A datagram larger than the socket send
+// buffer fails with EMSGSIZE, so the buffer is grown to fit the message and
+// the write is tried again. The kernel may cap the buffer size, in which case
+// ErrMessageTooLarge is returned.
+func (n *localConn) send(msg []byte) error {
+	_, err := n.conn.Write(msg)
+	if err == nil || !n.datagram || !errors.Is(err, syscall.EMSGSIZE) {
+		return err
+	}
+
+	if c, ok := n.conn.(interface{ SetWriteBuffer(int) error }); ok {
+		if c.SetWriteBuffer(2*len(msg)) == nil {
+			if _, err = n.conn.Write(msg); err == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w (%d bytes): %v", ErrMessageTooLarge, len(msg), err)
 }
 
 // close the (local) network connection
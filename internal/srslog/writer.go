@@ -3,6 +3,7 @@ package srslog
 import (
 	"bytes"
 	"crypto/tls"
+	"errors"
 	"sync"
 	"time"
 )
@@ -21,8 +22,37 @@ type Writer struct {
 	//non-nil if custom dialer set, used in getDialer
 	customDial DialFunc
 
-	mu   sync.RWMutex // guards conn
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	keepAlive    time.Duration
+
+	// used by the pool network, see SetTargets
+	targets    TargetsFunc
+	balanceKey string
+
+	// used by the relp networks, see SetRELPWindow and SetRELPRejectHandler
+	relpWindowSize int
+	relpRejected   func(msg []byte, err error)
+	relpWindow     *relpWindow
+
+	mu   sync.RWMutex // guards conn, refs, retired, hostname and relpWindow
 	conn serverConn
+	// number of writes using conn
+	refs int
+	// replaced connections still used by some writes, closed by the last one
+	retired map[serverConn]int
+	// replaced connections being closed in the background, see Close
+	closing sync.WaitGroup
+
+	backoff backoff
+	recycle recycler
+
+	amu    sync.RWMutex // guards async and closed
+	async  *asyncSender
+	closed bool
+
+	emu      sync.Mutex // guards asyncErr
+	asyncErr error
 }
 
 // getConn provides access to the internal conn, protected by a mutex. The
@@ -42,26 +72,178 @@ func (w *Writer) setConn(c serverConn) {
 	w.mu.Unlock()
 }
 
-// connect makes a connection to the syslog server.
-func (w *Writer) connect() (serverConn, error) {
-	conn := w.getConn()
+// getHostname returns the hostname of the current connection.
+func (w *Writer) getHostname() string {
+	w.mu.RLock()
+	hostname := w.hostname
+	w.mu.RUnlock()
+	return hostname
+}
+
+// acquireConn returns the current connection, which won't be closed when it's
+// replaced until it's released with releaseConn.
+func (w *Writer) acquireConn() serverConn {
+	w.mu.Lock()
+	conn := w.conn
 	if conn != nil {
-		// ignore err from close, it makes sense to continue anyway
+		w.refs++
+	}
+	w.mu.Unlock()
+	return conn
+}
+
+// releaseConn releases a connection returned by acquireConn, closing it if
+// it has been replaced and this was its last user.
+func (w *Writer) releaseConn(conn serverConn) {
+	if conn == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if conn == w.conn {
+		w.refs--
+		return
+	}
+	n, ok := w.retired[conn]
+	if !ok {
+		// closed by Close
+		return
+	}
+	if n > 1 {
+		w.retired[conn] = n - 1
+		return
+	}
+	delete(w.retired, conn)
+	w.closeRetired(conn)
+}
+
+// replaceConn makes conn the current connection, with its hostname, as long
+// as the current one is still old. Otherwise, another write has already
+// replaced it and false is returned. The old connection is closed once no
+// write uses it.
+func (w *Writer) replaceConn(old, conn serverConn, hostname string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != old {
+		return false
+	}
+	w.swapConn(conn, hostname)
+	return true
+}
+
+// swapConn makes conn the current connection, retiring the previous one. It
+// must be called with the lock held.
+func (w *Writer) swapConn(conn serverConn, hostname string) {
+	old, refs := w.conn, w.refs
+	w.conn, w.refs, w.hostname = conn, 0, hostname
+	switch {
+	case old == nil:
+	case refs > 0:
+		if w.retired == nil {
+			w.retired = make(map[serverConn]int)
+		}
+		w.retired[old] = refs
+	default:
+		w.closeRetired(old)
+	}
+}
+
+// closeRetired closes a replaced connection in the background, as closing a
+// RELP connection waits for its pending acknowledgements.
+func (w *Writer) closeRetired(conn serverConn) {
+	w.closing.Add(1)
+	go func() {
+		defer w.closing.Done()
+		// ignore err from close, the connection is no longer used
 		conn.close()
-		w.setConn(nil)
+	}()
+}
+
+// dial makes a new connection to the syslog server. If the previous dial
+// failed and the reconnect backoff has not expired yet, it fails without
+// dialing.
+func (w *Writer) dial(now time.Time) (serverConn, string, error) {
+	if err := w.backoff.check(now); err != nil {
+		return nil, "", err
 	}
 
-	var hostname string
-	var err error
-	dialer := w.getDialer()
-	conn, hostname, err = dialer.Call()
-	if err == nil {
-		w.setConn(conn)
-		w.hostname = hostname
+	conn, hostname, err := w.getDialer().Call()
+	if err != nil {
+		w.backoff.fail(now, err)
+		return nil, "", err
+	}
+	w.backoff.reset()
+	return conn, hostname, nil
+}
 
-		return conn, nil
+// connect makes a connection to the syslog server, replacing the current one
+// if any.
+func (w *Writer) connect() (serverConn, error) {
+	now := time.Now()
+	conn, hostname, err := w.dial(now)
+	if err != nil {
+		return nil, err
 	}
-	return nil, err
+	w.mu.Lock()
+	w.swapConn(conn, hostname)
+	w.mu.Unlock()
+	w.recycle.connected(now)
+	return conn, nil
+}
+
+// reconnect replaces the failed connection, unless another write has already
+// done it, and returns the current connection, which must be released with
+// releaseConn. A nil failed connection means there's no connection yet.
+func (w *Writer) reconnect(failed serverConn) (serverConn, error) {
+	if conn := w.acquireConn(); conn != nil {
+		if conn != failed {
+			return conn, nil
+		}
+		w.releaseConn(conn)
+	}
+
+	now := time.Now()
+	conn, hostname, err := w.dial(now)
+	if err != nil {
+		return nil, err
+	}
+	if w.replaceConn(failed, conn, hostname) {
+		w.recycle.connected(now)
+	} else {
+		// another write was faster, use its connection instead
+		w.closeRetired(conn)
+	}
+
+	if conn = w.acquireConn(); conn == nil {
+		return nil, ErrWriterClosed
+	}
+	return conn, nil
+}
+
+// Connect makes a connection to the syslog server, replacing the current
+// one if any. It's only needed for writers created with NewWriter, as the
+// Dial functions already connect and every write reconnects when needed.
+func (w *Writer) Connect() error {
+	_, err := w.connect()
+	return err
+}
+
+// SetReconnectBackoff enables exponential backoff between failed dials: after
+// the first failure, writes fail without dialing until a delay between
+// initial/2 and initial expires, and the delay doubles on every consecutive
+// failure up to max. By default, every write on a broken connection dials
+// again.
+func (w *Writer) SetReconnectBackoff(initial, max time.Duration) {
+	w.backoff.set(initial, max)
+}
+
+// isAsync reports whether the Writer is running in asynchronous mode.
+func (w *Writer) isAsync() bool {
+	w.amu.RLock()
+	async := w.async != nil
+	w.amu.RUnlock()
+	return async
 }
 
 // SetFormatter changes the formatter function for subsequent messages.
@@ -74,9 +256,33 @@ func (w *Writer) SetFramer(f Framer) {
 	w.framer = f
 }
 
+// SetDialTimeout sets the maximum amount of time a dial to a network syslog
+// server will wait for a connection to complete. Zero means no timeout.
+func (w *Writer) SetDialTimeout(d time.Duration) {
+	w.dialTimeout = d
+}
+
+// SetWriteTimeout sets the maximum amount of time a write to a network syslog
+// server may block. A timed out write fails and the connection is replaced
+// on the next attempt. Zero means no timeout. It applies to connections made
+// after the call.
+func (w *Writer) SetWriteTimeout(d time.Duration) {
+	w.writeTimeout = d
+}
+
+// SetKeepAlive sets the keep-alive period for TCP connections, as in
+// net.Dialer: zero enables keep-alives with the default period and a
+// negative value disables them. It applies to connections made after the
+// call.
+func (w *Writer) SetKeepAlive(d time.Duration) {
+	w.keepAlive = d
+}
+
 // SetHostname changes the hostname for syslog messages if needed.
 func (w *Writer) SetHostname(hostname string) {
+	w.mu.Lock()
 	w.hostname = hostname
+	w.mu.Unlock()
 }
 
 // Write sends a log message to the syslog daemon using the default priority
@@ -100,15 +306,29 @@ func (w *Writer) WriteWithTimestampAndPriority(timestamp time.Time, p Priority,
 	return w.writeAndRetryWithTimestampAndPriority(timestamp, p, b)
 }
 
-// Close closes a connection to the syslog daemon.
+// Close closes a connection to the syslog daemon. In asynchronous mode, it
+// waits until every queued message has been sent.
 func (w *Writer) Close() error {
-	conn := w.getConn()
+	aerr := w.closeAsync()
+
+	// replaced connections are closed first, so the RELP messages they
+	// leave are sent again by the current one
+	w.closing.Wait()
+
+	w.mu.Lock()
+	conn := w.conn
+	w.conn, w.refs = nil, 0
+	w.mu.Unlock()
+
+	var err error
 	if conn != nil {
-		err := conn.close()
-		w.setConn(nil)
+		err = conn.close()
+	}
+	w.closing.Wait()
+	if err != nil {
 		return err
 	}
-	return nil
+	return aerr
 }
 
 // Emerg logs a message with severity LOG_EMERG; this overrides the default
@@ -193,17 +413,25 @@ func (w *Writer) writeAndRetryWithTimestampAndPriority(
 	timestamp time.Time,
 	p Priority,
 	b []byte) (int, error) {
-	conn := w.getConn()
+	if w.isAsync() {
+		return w.enqueue(timestamp, p, b)
+	}
+
+	w.maybeRecycle()
+	conn := w.acquireConn()
 	if conn != nil {
-		if n, err := w.write(conn, timestamp, p, b); err == nil {
+		n, err := w.write(conn, timestamp, p, b)
+		w.releaseConn(conn)
+		if err == nil || errors.Is(err, ErrMessageTooLarge) {
 			return n, err
 		}
 	}
 
-	var err error
-	if conn, err = w.connect(); err != nil {
+	conn, err := w.reconnect(conn)
+	if err != nil {
 		return 0, err
 	}
+	defer w.releaseConn(conn)
 	return w.write(conn, timestamp, p, b)
 }
 
@@ -215,7 +443,7 @@ func (w *Writer) write(conn serverConn, timestamp time.Time, p Priority, msg []b
 		msg = append(msg, byte('\n'))
 	}
 
-	err := conn.write(w.framer, w.formatter, timestamp, p, w.hostname, w.tag, msg)
+	err := conn.write(w.framer, w.formatter, timestamp, p, w.getHostname(), w.tag, msg)
 	if err != nil {
 		return 0, err
 	}
@@ -32,13 +32,32 @@ func main() {
 		os.Exit(1)
 	}
 
+	blueprints, err := multilogger.ParseExecDrivers(os.Getenv("MULTILOGGER_EXEC_DRIVERS"))
+	if err == nil {
+		for _, blp := range blueprints {
+			if err = multilogger.Register(blp); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid exec logging drivers: ", err)
+		os.Exit(1)
+	}
+
+	if drivers := os.Getenv("MULTILOGGER_DRIVERS"); drivers != "" {
+		if err := multilogger.EnableOnly(multilogger.ParseDriverList(drivers)...); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid logging drivers: ", err)
+			os.Exit(1)
+		}
+	}
+
 	var (
 		handler       = sdk.NewHandler(`{"Implements": ["LoggingDriver"]}`)
-		blueprints    = multilogger.DefaultBlueprints
 		pluginHandler = &plugin.HTTPHandler{
 			Plugin: plugin.New(
-				multilogger.Validator(blueprints),
-				multilogger.Creator(blueprints),
+				multilogger.DefaultValidator(),
+				multilogger.DefaultCreator(),
 			),
 		}
 	)
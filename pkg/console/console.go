@@ -0,0 +1,276 @@
+// Package console provides a log driver for writing container logs to the
+// plugin's own output, or a named pipe, which is useful for debugging.
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/errdefs"
+	"golang.org/x/time/rate"
+)
+
+// Driver name & available keys
+const (
+	DriverName     = "console"
+	OutputKey      = DriverName + "-output"
+	FormatKey      = DriverName + "-format"
+	RateKey        = DriverName + "-rate"
+	BurstKey       = DriverName + "-burst"
+	EnvKey         = "env"
+	EnvRegexKey    = "env-regex"
+	LabelsKey      = "labels"
+	LabelsRegexKey = "labels-regex"
+)
+
+// Available outputs, along with the path of a named pipe
+const (
+	StdoutOutput = "stdout"
+	StderrOutput = "stderr"
+)
+
+// Available message formats
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+const (
+	defaultRate  = 100
+	defaultBurst = 200
+)
+
+// limiterKey identifies the loggers sharing a rate limiter
+type limiterKey struct {
+	output string
+	rate   float64
+	burst  int
+}
+
+// The rate limiters are shared by the loggers writing to the same output
+// with the same settings, so the rate bounds the output as a whole rather
+// than every container.
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[limiterKey]*rate.Limiter)
+)
+
+// sharedLimiter returns the rate limiter of the output, or nil if there's no
+// limit
+func sharedLimiter(cfg config) *rate.Limiter {
+	if cfg.rate == 0 {
+		return nil
+	}
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	key := limiterKey{cfg.output, cfg.rate, cfg.burst}
+	limiter, ok := limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(cfg.rate), cfg.burst)
+		limiters[key] = limiter
+	}
+	return limiter
+}
+
+type consoleLogger struct {
+	out  io.Writer
+	name string
+	json bool
+	// fields added to every JSON message
+	fields map[string]interface{}
+
+	// shared with the other loggers of the output
+	limiter *rate.Limiter
+
+	mu      sync.Mutex
+	dropped int
+	buf     bytes.Buffer
+	now     func() time.Time
+}
+
+// New creates a console logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer
+	switch cfg.output {
+	case StdoutOutput:
+		out = os.Stdout
+	case StderrOutput:
+		out = os.Stderr
+	default:
+		if out, err = openPipe(cfg.output); err != nil {
+			return nil, err
+		}
+	}
+
+	return newConsoleLogger(info, cfg, out)
+}
+
+// newConsoleLogger creates a console logger writing to the given output.
+func newConsoleLogger(info logger.Info, cfg config, out io.Writer) (*consoleLogger, error) {
+	l := &consoleLogger{
+		out:     out,
+		name:    info.Name(),
+		json:    cfg.format == JSONFormat,
+		limiter: sharedLimiter(cfg),
+		now:     time.Now,
+	}
+
+	if l.json {
+		var err error
+		if l.fields, err = loggerutil.ContainerFields(info); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+func (l *consoleLogger) Log(msg *logger.Message) error {
+	defer logger.PutMessage(msg)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if l.limiter != nil && !l.limiter.AllowN(now, 1) {
+		l.dropped++
+		return nil
+	}
+
+	l.buf.Reset()
+	if l.dropped > 0 {
+		if err := l.format(now, "console", []byte(fmt.Sprintf("dropped %d messages over the rate limit", l.dropped))); err != nil {
+			return err
+		}
+		l.dropped = 0
+	}
+	if err := l.format(msg.Timestamp, msg.Source, msg.Line); err != nil {
+		return err
+	}
+
+	// a single write, so the messages of several containers aren't mixed
+	_, err := l.out.Write(l.buf.Bytes())
+	return err
+}
+
+// format appends a message line to the buffer
+func (l *consoleLogger) format(ts time.Time, source string, line []byte) error {
+	if !l.json {
+		fmt.Fprintf(&l.buf, "%s %s %s: %s\n", ts.UTC().Format(time.RFC3339Nano), l.name, source, line)
+		return nil
+	}
+
+	fields := make(map[string]interface{}, len(l.fields)+3)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields["timestamp"] = ts.UTC().Format(time.RFC3339Nano)
+	fields["message"] = string(line)
+	fields["source"] = source
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	l.buf.Write(b)
+	l.buf.WriteByte('\n')
+	return nil
+}
+
+func (l *consoleLogger) Close() error {
+	if c, ok := l.out.(io.Closer); ok && l.out != os.Stdout && l.out != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+func (l *consoleLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for console specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case OutputKey:
+		case FormatKey:
+		case RateKey:
+		case BurstKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for console log driver", key)
+		}
+	}
+	_, err := parseConfig(cfg)
+	return err
+}
+
+// config holds the parsed options
+type config struct {
+	output string
+	format string
+	rate   float64
+	burst  int
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	switch c.output = cfg[OutputKey]; c.output {
+	case "":
+		c.output = StdoutOutput
+	case StdoutOutput, StderrOutput:
+	default:
+		if !filepath.IsAbs(c.output) {
+			return c, fmt.Errorf("invalid console output %q, use %s, %s or the absolute path of a named pipe", c.output, StdoutOutput, StderrOutput)
+		}
+	}
+
+	switch c.format = cfg[FormatKey]; c.format {
+	case "":
+		c.format = TextFormat
+	case TextFormat, JSONFormat:
+	default:
+		return c, fmt.Errorf("invalid console format %q, use %s or %s", c.format, TextFormat, JSONFormat)
+	}
+
+	c.rate = defaultRate
+	if v := cfg[RateKey]; v != "" {
+		if c.rate, err = strconv.ParseFloat(v, 64); err != nil {
+			return c, errdefs.InvalidParameter(err)
+		}
+		if c.rate < 0 {
+			return c, fmt.Errorf("%s can't be negative", RateKey)
+		}
+	}
+
+	c.burst = defaultBurst
+	if v := cfg[BurstKey]; v != "" {
+		if c.burst, err = strconv.Atoi(v); err != nil {
+			return c, errdefs.InvalidParameter(err)
+		}
+		if c.burst < 1 {
+			return c, fmt.Errorf("%s must be at least 1", BurstKey)
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,206 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"empty", map[string]string{}, true},
+		{"full", map[string]string{
+			OutputKey: "/run/docker-console.pipe",
+			FormatKey: JSONFormat,
+			RateKey:   "0.5",
+			BurstKey:  "10",
+			LabelsKey: "team",
+			EnvKey:    "STAGE",
+		}, true},
+		{"stderr", map[string]string{OutputKey: StderrOutput}, true},
+		{"unlimited", map[string]string{RateKey: "0"}, true},
+		{"unknown key", map[string]string{"console-foo": "bar"}, false},
+		{"relative output", map[string]string{OutputKey: "console.pipe"}, false},
+		{"invalid format", map[string]string{FormatKey: "xml"}, false},
+		{"invalid rate", map[string]string{RateKey: "fast"}, false},
+		{"negative rate", map[string]string{RateKey: "-1"}, false},
+		{"invalid burst", map[string]string{BurstKey: "0"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+// ts is the timestamp of the logged messages
+var ts = time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestLogger creates a logger writing to out
+func newTestLogger(t *testing.T, cfg map[string]string, out *bytes.Buffer) *consoleLogger {
+	info := loggertest.Info(cfg)
+	info.ContainerLabels = map[string]string{"team": "core"}
+	c, err := parseConfig(cfg)
+	require.Nil(t, err)
+	l, err := newConsoleLogger(info, c, out)
+	require.Nil(t, err)
+	return l
+}
+
+// resetLimiters drops the shared rate limiters, so every test starts with a
+// full burst
+func resetLimiters() {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	limiters = make(map[limiterKey]*rate.Limiter)
+}
+
+func TestTextFormat(t *testing.T) {
+	var out bytes.Buffer
+	l := newTestLogger(t, map[string]string{}, &out)
+	loggertest.LogAt(t, l, "hello", "stderr", ts)
+	loggertest.LogAt(t, l, "world", "stderr", ts)
+	require.Nil(t, l.Close())
+
+	assert.Equal(t, "2020-01-02T03:04:05Z web stderr: hello\n2020-01-02T03:04:05Z web stderr: world\n", out.String())
+}
+
+func TestJSONFormat(t *testing.T) {
+	var out bytes.Buffer
+	l := newTestLogger(t, map[string]string{FormatKey: JSONFormat, LabelsKey: "team"}, &out)
+	loggertest.LogAt(t, l, "hello", "stderr", ts)
+
+	var fields map[string]string
+	require.Nil(t, json.Unmarshal(out.Bytes(), &fields))
+	assert.Equal(t, map[string]string{
+		"timestamp":      "2020-01-02T03:04:05Z",
+		"message":        "hello",
+		"source":         "stderr",
+		"container_id":   loggertest.ContainerID,
+		"container_name": "web",
+		"image_id":       "",
+		"image_name":     "",
+		"team":           "core",
+	}, fields)
+}
+
+func TestRateLimit(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	resetLimiters()
+	var out bytes.Buffer
+	l := newTestLogger(t, map[string]string{RateKey: "1", BurstKey: "2"}, &out)
+	now := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for _, line := range []string{"first", "second", "third", "fourth"} {
+		loggertest.LogAt(t, l, line, "stderr", ts)
+	}
+	now = now.Add(time.Second)
+	loggertest.LogAt(t, l, "fifth", "stderr", ts)
+
+	var lines []string
+	s := bufio.NewScanner(&out)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	require.Nil(s.Err())
+	assert.Equal([]string{
+		"2020-01-02T03:04:05Z web stderr: first",
+		"2020-01-02T03:04:05Z web stderr: second",
+		"2020-01-02T03:04:06Z web console: dropped 2 messages over the rate limit",
+		"2020-01-02T03:04:05Z web stderr: fifth",
+	}, lines)
+}
+
+func TestRateLimitShared(t *testing.T) {
+	resetLimiters()
+	var out bytes.Buffer
+	cfg := map[string]string{RateKey: "1", BurstKey: "3"}
+	now := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	l1 := newTestLogger(t, cfg, &out)
+	l1.now = func() time.Time { return now }
+	l2 := newTestLogger(t, cfg, &out)
+	l2.now = func() time.Time { return now }
+
+	// the containers share the burst
+	loggertest.LogAt(t, l1, "first", "stderr", ts)
+	loggertest.LogAt(t, l1, "second", "stderr", ts)
+	loggertest.LogAt(t, l2, "third", "stderr", ts)
+	loggertest.LogAt(t, l2, "fourth", "stderr", ts)
+
+	assert.Equal(t, "2020-01-02T03:04:05Z web stderr: first\n2020-01-02T03:04:05Z web stderr: second\n2020-01-02T03:04:05Z web stderr: third\n", out.String())
+}
+
+func TestNamedPipe(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir, err := ioutil.TempDir("", "console")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "console.pipe")
+
+	l := loggertest.New(t, New, map[string]string{OutputKey: path})
+	defer l.Close()
+
+	stat, err := os.Stat(path)
+	require.Nil(err)
+	assert.True(stat.Mode()&os.ModeNamedPipe != 0)
+
+	// without a reader the message is dropped
+	loggertest.LogAt(t, l, "dropped", "stderr", ts)
+
+	r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	require.Nil(err)
+	loggertest.LogAt(t, l, "hello", "stderr", ts)
+	line, err := bufio.NewReader(r).ReadString('\n')
+	require.Nil(err)
+	assert.Equal("2020-01-02T03:04:05Z web stderr: hello\n", line)
+
+	// the pipe is opened again after the reader goes away
+	require.Nil(r.Close())
+	loggertest.LogAt(t, l, "dropped", "stderr", ts)
+	r, err = os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	require.Nil(err)
+	defer r.Close()
+	loggertest.LogAt(t, l, "again", "stderr", ts)
+	line, err = bufio.NewReader(r).ReadString('\n')
+	require.Nil(err)
+	assert.Equal("2020-01-02T03:04:05Z web stderr: again\n", line)
+}
+
+func TestNotANamedPipe(t *testing.T) {
+	f, err := ioutil.TempFile("", "console")
+	require.Nil(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	_, err = New(logger.Info{Config: map[string]string{OutputKey: f.Name()}})
+	assert.NotNil(t, err)
+}
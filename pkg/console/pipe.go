@@ -0,0 +1,86 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maximum time a write waits for the reader of a named pipe
+const pipeWriteTimeout = 10 * time.Millisecond
+
+// pipe writes to a named pipe without blocking. The pipe is opened when
+// there's a reader, and the messages are dropped when there isn't one or it
+// doesn't keep up.
+type pipe struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openPipe creates the named pipe if needed
+func openPipe(path string) (*pipe, error) {
+	if err := syscall.Mkfifo(path, 0600); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("error creating named pipe: %v", err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Mode()&os.ModeNamedPipe == 0 {
+		return nil, fmt.Errorf("console output %q isn't a named pipe", path)
+	}
+	return &pipe{path: path}, nil
+}
+
+func (p *pipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.file == nil {
+		// opening a pipe for writing without blocking fails if there's no
+		// reader
+		f, err := os.OpenFile(p.path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			if errors.Is(err, syscall.ENXIO) {
+				// nobody is reading, so the message is dropped
+				return len(b), nil
+			}
+			return 0, err
+		}
+		p.file = f
+	}
+
+	if err := p.file.SetWriteDeadline(time.Now().Add(pipeWriteTimeout)); err != nil {
+		return 0, err
+	}
+	switch _, err := p.file.Write(b); {
+	case err == nil, os.IsTimeout(err):
+		// the message is dropped if the reader doesn't keep up
+	case errors.Is(err, syscall.EPIPE):
+		// the reader is gone, so the pipe is opened again with the next one
+		p.file.Close()
+		p.file = nil
+	default:
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the pipe, which is kept for the next logger
+func (p *pipe) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.file == nil {
+		return nil
+	}
+	err := p.file.Close()
+	p.file = nil
+	return err
+}
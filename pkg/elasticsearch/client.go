@@ -0,0 +1,260 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/batcher"
+	"github.com/sirupsen/logrus"
+)
+
+// document is a log message ready to be indexed
+type document struct {
+	index     string
+	timestamp time.Time
+	body      []byte
+}
+
+// rejection is a document which couldn't be indexed
+type rejection struct {
+	doc    document
+	status int
+	reason string
+}
+
+// client batches documents and indexes them through the bulk API from a
+// background goroutine.
+type client struct {
+	cfg     config
+	http    *http.Client
+	batcher *batcher.Batcher
+}
+
+func newClient(cfg config) *client {
+	c := &client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: cfg.timeout},
+	}
+	c.batcher = batcher.New(batcher.Config{
+		Wait:    cfg.flushInterval,
+		MaxSize: cfg.bulkSize,
+		Size:    func(doc interface{}) int { return len(doc.(document).body) },
+	}, c.send)
+	return c
+}
+
+// push queues a document, blocking if the queue is full.
+func (c *client) push(doc document) error {
+	return c.batcher.Push(doc)
+}
+
+// close stops accepting documents and waits until the queued ones are
+// indexed, without retrying failed requests.
+func (c *client) close() error {
+	c.batcher.Close()
+	return nil
+}
+
+// send indexes the documents, retrying with an exponential backoff the
+// whole request on network errors, rate limiting and server errors, and the
+// documents rejected for the same reasons. The documents which can't be
+// indexed, including the ones of a request rejected as a whole, are
+// dead-lettered.
+func (c *client) send(items []interface{}) {
+	docs := make([]document, 0, len(items))
+	for _, item := range items {
+		docs = append(docs, item.(document))
+	}
+
+	var rejected, retry []rejection
+	c.batcher.Retry(c.cfg.retries, func() (bool, error) {
+		var (
+			failed []rejection
+			status int
+			err    error
+		)
+		retry, failed, status, err = c.bulk(docs)
+		if err != nil {
+			failed = rejectAll(docs, status, err)
+			if batcher.Retriable(status) {
+				retry, failed = failed, nil
+			}
+		}
+		rejected = append(rejected, failed...)
+		if len(retry) == 0 {
+			return false, err
+		}
+
+		docs = docs[:0]
+		for _, r := range retry {
+			docs = append(docs, r.doc)
+		}
+		return true, fmt.Errorf("%d documents failed", len(retry))
+	})
+
+	for _, r := range retry {
+		rejected = append(rejected, rejection{doc: r.doc, status: r.status, reason: "retries exhausted: " + r.reason})
+	}
+	if len(rejected) > 0 {
+		c.deadLetter(rejected)
+	}
+}
+
+// deadLetter indexes the rejected documents in the dead letter index, along
+// with the rejection reason, or logs them if there is no such index.
+func (c *client) deadLetter(rejected []rejection) {
+	if c.cfg.deadLetter == nil {
+		for _, r := range rejected {
+			logrus.WithField("index", r.doc.index).WithField("status", r.status).Errorf("elasticsearch: dropping rejected document: %s", r.reason)
+		}
+		return
+	}
+
+	docs := make([]document, 0, len(rejected))
+	for _, r := range rejected {
+		body, err := json.Marshal(map[string]interface{}{
+			"@timestamp": r.doc.timestamp.UTC().Format(time.RFC3339Nano),
+			"index":      r.doc.index,
+			"status":     r.status,
+			"error":      r.reason,
+			"document":   string(r.doc.body),
+		})
+		if err != nil {
+			logrus.WithError(err).Error("elasticsearch: unable to encode dead letter document")
+			continue
+		}
+		docs = append(docs, document{
+			index:     c.cfg.deadLetter.format(r.doc.timestamp),
+			timestamp: r.doc.timestamp,
+			body:      body,
+		})
+	}
+
+	retry, items, status, err := c.bulk(docs)
+	if err != nil {
+		logrus.WithError(err).WithField("status", status).Errorf("elasticsearch: dropping %d dead letter documents", len(docs))
+		return
+	}
+	for _, r := range append(retry, items...) {
+		logrus.WithField("index", r.doc.index).WithField("status", r.status).Errorf("elasticsearch: dropping dead letter document: %s", r.reason)
+	}
+}
+
+// bulkResponse is the part of the bulk API response we care about
+type bulkResponse struct {
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+type bulkItem struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// bulk sends a bulk request, returning the documents which should be
+// retried and the rejected ones. If the whole request fails, the response
+// status is returned if there is one. If the request can't be built, every
+// document is rejected, as it would fail the same way again.
+func (c *client) bulk(docs []document) (retry, rejected []rejection, status int, err error) {
+	body, err := c.encode(docs)
+	if err != nil {
+		return nil, rejectAll(docs, 0, fmt.Errorf("unable to encode request: %v", err)), 0, nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.cfg.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, rejectAll(docs, 0, err), 0, nil
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.cfg.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.cfg.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+c.cfg.apiKey)
+	} else if c.cfg.username != "" {
+		req.SetBasicAuth(c.cfg.username, c.cfg.password)
+	}
+
+	var result bulkResponse
+	status, err = batcher.Do(c.http, req, func(body io.Reader) error {
+		if err := json.NewDecoder(body).Decode(&result); err != nil {
+			return fmt.Errorf("invalid bulk response: %v", err)
+		}
+		return nil
+	})
+	if err != nil || !result.Errors {
+		return nil, nil, status, err
+	}
+
+	for i, item := range result.Items {
+		if i >= len(docs) {
+			break
+		}
+		for _, it := range item {
+			if it.Error == nil {
+				continue
+			}
+			r := rejection{
+				doc:    docs[i],
+				status: it.Status,
+				reason: it.Error.Type + ": " + it.Error.Reason,
+			}
+			if batcher.Retriable(it.Status) {
+				retry = append(retry, r)
+			} else {
+				rejected = append(rejected, r)
+			}
+		}
+	}
+	return retry, rejected, status, nil
+}
+
+// rejectAll returns the rejections of every document, for the same reason
+func rejectAll(docs []document, status int, err error) []rejection {
+	rejected := make([]rejection, 0, len(docs))
+	for _, doc := range docs {
+		rejected = append(rejected, rejection{doc: doc, status: status, reason: err.Error()})
+	}
+	return rejected
+}
+
+// encode returns the bulk request body, compressed if needed
+func (c *client) encode(docs []document) ([]byte, error) {
+	var buf bytes.Buffer
+	w := io.Writer(&buf)
+
+	var zw *gzip.Writer
+	if c.cfg.gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+
+	for _, doc := range docs {
+		action, err := json.Marshal(map[string]map[string]string{
+			c.cfg.action: {"_index": doc.index},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range [][]byte{action, {'\n'}, doc.body, {'\n'}} {
+			if _, err := w.Write(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
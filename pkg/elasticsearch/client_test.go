@@ -0,0 +1,267 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bulkRequest struct {
+	url     string
+	header  http.Header
+	actions []string
+	indices []string
+	docs    []map[string]interface{}
+}
+
+// startBulkServer runs a bulk API stand-in. Every request is sent to the
+// returned channel, and replied with the document statuses returned by
+// reply, which is called with the request number, starting from 0. If reply
+// returns no statuses, the whole request is rejected with a 400. The server
+// must be closed by the caller.
+func startBulkServer(t *testing.T, reply func(n int, req bulkRequest) []int) (*httptest.Server, <-chan bulkRequest) {
+	var calls int32
+	requests := make(chan bulkRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, bulkPath, r.URL.Path)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			require.Nil(t, err)
+			body = zr
+		}
+
+		req := bulkRequest{url: r.URL.String(), header: r.Header}
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			require.Nil(t, json.Unmarshal(scanner.Bytes(), &action))
+			for name, meta := range action {
+				req.actions = append(req.actions, name)
+				req.indices = append(req.indices, meta["_index"])
+			}
+
+			require.True(t, scanner.Scan())
+			var doc map[string]interface{}
+			require.Nil(t, json.Unmarshal(scanner.Bytes(), &doc))
+			req.docs = append(req.docs, doc)
+		}
+		require.Nil(t, scanner.Err())
+
+		statuses := reply(int(atomic.AddInt32(&calls, 1))-1, req)
+		requests <- req
+		if len(statuses) == 0 {
+			http.Error(w, "rejected by test", http.StatusBadRequest)
+			return
+		}
+
+		var resp bulkResponse
+		for _, status := range statuses {
+			item := bulkItem{Status: status}
+			if status/100 != 2 {
+				resp.Errors = true
+				item.Error = &struct {
+					Type   string `json:"type"`
+					Reason string `json:"reason"`
+				}{"test_exception", "rejected by test"}
+			}
+			resp.Items = append(resp.Items, map[string]bulkItem{req.actions[len(resp.Items)]: item})
+		}
+		require.Nil(t, json.NewEncoder(w).Encode(resp))
+	}))
+	return srv, requests
+}
+
+// accept replies every document with a 201
+func accept(n int, req bulkRequest) []int {
+	statuses := make([]int, len(req.docs))
+	for i := range statuses {
+		statuses[i] = http.StatusCreated
+	}
+	return statuses
+}
+
+func TestBulkIndex(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startBulkServer(t, accept)
+	defer srv.Close()
+	info := loggertest.Info(map[string]string{
+		URLKey:      srv.URL,
+		IndexKey:    "logs-{{.Name}}-%{+yyyy.MM.dd}",
+		PipelineKey: "docker",
+		APIKeyKey:   "a2V5",
+		GzipKey:     "true",
+		LabelsKey:   "team",
+	})
+	info.ContainerImageName = "nginx:latest"
+	info.ContainerLabels = map[string]string{"team": "core"}
+	l, err := New(info)
+	require.Nil(err)
+
+	ts := time.Date(2020, time.January, 2, 3, 4, 5, 6, time.UTC)
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	loggertest.LogAt(t, l, "world", "stdout", ts.Add(24*time.Hour))
+	require.Nil(l.Close())
+
+	req := loggertest.Receive(t, requests).(bulkRequest)
+	assert.Equal("/_bulk?pipeline=docker", req.url)
+	assert.Equal("gzip", req.header.Get("Content-Encoding"))
+	assert.Equal("ApiKey a2V5", req.header.Get("Authorization"))
+	assert.Equal([]string{CreateAction, CreateAction}, req.actions)
+	assert.Equal([]string{"logs-web-2020.01.02", "logs-web-2020.01.03"}, req.indices)
+	require.Len(req.docs, 2)
+	assert.Equal(map[string]interface{}{
+		"@timestamp":     "2020-01-02T03:04:05.000000006Z",
+		"message":        "hello",
+		"source":         "stdout",
+		"container_id":   loggertest.ContainerID,
+		"container_name": "web",
+		"image_id":       "",
+		"image_name":     "nginx:latest",
+		"team":           "core",
+	}, req.docs[0])
+	assert.Equal("world", req.docs[1]["message"])
+}
+
+func TestBulkRetriesRejectedDocuments(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startBulkServer(t, func(n int, req bulkRequest) []int {
+		if n == 0 {
+			return []int{http.StatusCreated, http.StatusTooManyRequests}
+		}
+		return accept(n, req)
+	})
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:           srv.URL,
+		UsernameKey:      "user",
+		PasswordKey:      "secret",
+		FlushIntervalKey: "10ms",
+	})
+	defer l.Close()
+
+	loggertest.Log(t, l, "first")
+	loggertest.Log(t, l, "second")
+
+	req := loggertest.Receive(t, requests).(bulkRequest)
+	user, pass, ok := (&http.Request{Header: req.header}).BasicAuth()
+	require.True(ok)
+	assert.Equal("user", user)
+	assert.Equal("secret", pass)
+	require.Len(req.docs, 2)
+
+	// only the rate limited document is sent again
+	req = loggertest.Receive(t, requests).(bulkRequest)
+	require.Len(req.docs, 1)
+	assert.Equal("second", req.docs[0]["message"])
+}
+
+func TestBulkDeadLetter(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startBulkServer(t, func(n int, req bulkRequest) []int {
+		if n == 0 {
+			return []int{http.StatusBadRequest, http.StatusCreated}
+		}
+		return accept(n, req)
+	})
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:             srv.URL,
+		IndexKey:           "logs",
+		DeadLetterIndexKey: "dead-letter-%{+yyyy}",
+		FlushIntervalKey:   "10ms",
+	})
+	defer l.Close()
+
+	ts := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	loggertest.LogAt(t, l, "bad", "stdout", ts)
+	loggertest.LogAt(t, l, "good", "stdout", ts)
+	require.Len(loggertest.Receive(t, requests).(bulkRequest).docs, 2)
+
+	// the rejected document is indexed in the dead letter index right away
+	req := loggertest.Receive(t, requests).(bulkRequest)
+	assert.Equal([]string{"dead-letter-2020"}, req.indices)
+	require.Len(req.docs, 1)
+	assert.Equal("logs", req.docs[0]["index"])
+	assert.EqualValues(http.StatusBadRequest, req.docs[0]["status"])
+	assert.Equal("test_exception: rejected by test", req.docs[0]["error"])
+
+	var original map[string]interface{}
+	require.Nil(json.Unmarshal([]byte(req.docs[0]["document"].(string)), &original))
+	assert.Equal("bad", original["message"])
+}
+
+func TestBulkDeadLetterRejectedRequest(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startBulkServer(t, func(n int, req bulkRequest) []int {
+		if n == 0 {
+			return nil
+		}
+		return accept(n, req)
+	})
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:             srv.URL,
+		IndexKey:           "logs",
+		ActionKey:          IndexAction,
+		DeadLetterIndexKey: "dead-letter",
+		FlushIntervalKey:   "10ms",
+	})
+	defer l.Close()
+
+	loggertest.Log(t, l, "first")
+	loggertest.Log(t, l, "second")
+	req := loggertest.Receive(t, requests).(bulkRequest)
+	assert.Equal([]string{IndexAction, IndexAction}, req.actions)
+	require.Len(req.docs, 2)
+
+	// the documents of the rejected request aren't retried but dead-lettered
+	req = loggertest.Receive(t, requests).(bulkRequest)
+	assert.Equal([]string{"dead-letter", "dead-letter"}, req.indices)
+	require.Len(req.docs, 2)
+	assert.EqualValues(http.StatusBadRequest, req.docs[0]["status"])
+	assert.Contains(req.docs[0]["error"], "rejected by test")
+}
+
+func TestBulkRequestErrorNotRetried(t *testing.T) {
+	c := &client{
+		cfg:  config{url: "http://localhost:port", action: CreateAction},
+		http: http.DefaultClient,
+	}
+
+	// the request can't be built, so the documents are rejected
+	retry, rejected, status, err := c.bulk([]document{{index: "logs", body: []byte("{}")}})
+	assert.Nil(t, err)
+	assert.Empty(t, retry)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "logs", rejected[0].doc.index)
+}
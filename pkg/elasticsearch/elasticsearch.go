@@ -0,0 +1,361 @@
+// Package elasticsearch provides a log driver for indexing container logs
+// in Elasticsearch or OpenSearch through the bulk API.
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/templates"
+	"github.com/docker/docker/errdefs"
+)
+
+// Driver name & available keys
+const (
+	DriverName         = "elasticsearch"
+	URLKey             = DriverName + "-url"
+	IndexKey           = DriverName + "-index"
+	PipelineKey        = DriverName + "-pipeline"
+	UsernameKey        = DriverName + "-username"
+	PasswordKey        = DriverName + "-password"
+	APIKeyKey          = DriverName + "-api-key"
+	GzipKey            = DriverName + "-gzip"
+	BulkSizeKey        = DriverName + "-bulk-size"
+	FlushIntervalKey   = DriverName + "-flush-interval"
+	RetriesKey         = DriverName + "-retries"
+	TimeoutKey         = DriverName + "-timeout"
+	DeadLetterIndexKey = DriverName + "-dead-letter-index"
+	ActionKey          = DriverName + "-action"
+	EnvKey             = "env"
+	EnvRegexKey        = "env-regex"
+	LabelsKey          = "labels"
+	LabelsRegexKey     = "labels-regex"
+)
+
+// Available bulk actions
+const (
+	// CreateAction only adds new documents, as required by data streams
+	CreateAction = "create"
+	// IndexAction adds or replaces documents
+	IndexAction = "index"
+)
+
+const (
+	bulkPath = "/_bulk"
+
+	defaultIndex         = "docker-%{+yyyy.MM.dd}"
+	defaultBulkSize      = 5 * 1024 * 1024
+	defaultFlushInterval = time.Second
+	defaultRetries       = 3
+	defaultTimeout       = 30 * time.Second
+)
+
+type esLogger struct {
+	client *client
+	index  indexPattern
+	// fields added to every document
+	fields map[string]interface{}
+}
+
+// New creates an elasticsearch logger using the configuration passed in on
+// the context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := parseIndexTemplate(info, cfg.index)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.deadLetterIndex != "" {
+		if cfg.deadLetter, err = parseIndexTemplate(info, cfg.deadLetterIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := loggerutil.ContainerFields(info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &esLogger{
+		client: newClient(cfg),
+		index:  index,
+		fields: fields,
+	}, nil
+}
+
+func (l *esLogger) Log(msg *logger.Message) error {
+	if len(msg.Line) == 0 {
+		logger.PutMessage(msg)
+		return nil
+	}
+
+	fields := make(map[string]interface{}, len(l.fields)+3)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields["@timestamp"] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+	fields["message"] = string(msg.Line)
+	fields["source"] = msg.Source
+
+	body, err := json.Marshal(fields)
+	ts := msg.Timestamp
+	logger.PutMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	return l.client.push(document{
+		index:     l.index.format(ts),
+		timestamp: ts,
+		body:      body,
+	})
+}
+
+func (l *esLogger) Close() error {
+	return l.client.close()
+}
+
+func (l *esLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for elasticsearch specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case URLKey:
+		case IndexKey:
+		case PipelineKey:
+		case UsernameKey:
+		case PasswordKey:
+		case APIKeyKey:
+		case GzipKey:
+		case BulkSizeKey:
+		case FlushIntervalKey:
+		case RetriesKey:
+		case TimeoutKey:
+		case DeadLetterIndexKey:
+		case ActionKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for elasticsearch log driver", key)
+		}
+	}
+
+	c, err := parseConfig(cfg)
+	if err != nil {
+		return err
+	}
+	for _, index := range []string{c.index, c.deadLetterIndex} {
+		if index == "" {
+			continue
+		}
+		if _, err := templates.NewParse("index", index); err != nil {
+			return errdefs.InvalidParameter(err)
+		}
+		if _, err := parseIndexPattern(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// config holds the parsed options
+type config struct {
+	url             string
+	index           string
+	username        string
+	password        string
+	apiKey          string
+	gzip            bool
+	bulkSize        int
+	flushInterval   time.Duration
+	retries         int
+	timeout         time.Duration
+	deadLetterIndex string
+	action          string
+	// set by New from the deadLetterIndex template, if any
+	deadLetter indexPattern
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	if c.url, err = parseURL(cfg[URLKey], cfg[PipelineKey]); err != nil {
+		return
+	}
+
+	if c.index = cfg[IndexKey]; c.index == "" {
+		c.index = defaultIndex
+	}
+	c.deadLetterIndex = cfg[DeadLetterIndexKey]
+
+	c.username = cfg[UsernameKey]
+	c.password = cfg[PasswordKey]
+	c.apiKey = cfg[APIKeyKey]
+	if c.password != "" && c.username == "" {
+		return c, errors.New("elasticsearch password requires a username")
+	}
+	if c.apiKey != "" && c.username != "" {
+		return c, errors.New("elasticsearch api key and basic authentication can't be used together")
+	}
+
+	switch c.action = cfg[ActionKey]; c.action {
+	case "":
+		c.action = CreateAction
+	case CreateAction, IndexAction:
+	default:
+		return c, fmt.Errorf("invalid elasticsearch action %q, use %s or %s", c.action, CreateAction, IndexAction)
+	}
+
+	if c.gzip, err = loggerutil.ParseBool(cfg, GzipKey); err != nil {
+		return
+	}
+	if c.bulkSize, err = loggerutil.ParseInt(cfg, BulkSizeKey, defaultBulkSize, 1); err != nil {
+		return
+	}
+	if c.flushInterval, err = loggerutil.ParsePositiveDuration(cfg, FlushIntervalKey, defaultFlushInterval); err != nil {
+		return
+	}
+	if c.retries, err = loggerutil.ParseInt(cfg, RetriesKey, defaultRetries, 0); err != nil {
+		return
+	}
+	if c.timeout, err = loggerutil.ParsePositiveDuration(cfg, TimeoutKey, defaultTimeout); err != nil {
+		return
+	}
+
+	return c, nil
+}
+
+// parseURL returns the bulk API URL of the cluster, with the ingest pipeline
+// if there is one
+func parseURL(address, pipeline string) (string, error) {
+	if address == "" {
+		return "", errors.New("elasticsearch url is required")
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("elasticsearch url should be in form http[s]://host[:port][/path], got %v", address)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + bulkPath
+	if pipeline != "" {
+		q := u.Query()
+		q.Set("pipeline", pipeline)
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// parseIndexTemplate renders the index template using the container info,
+// and parses the resulting date pattern
+func parseIndexTemplate(info logger.Info, index string) (indexPattern, error) {
+	tmpl, err := templates.NewParse("index", index)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, &info); err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	return parseIndexPattern(buf.String())
+}
+
+// indexPattern is an index name with date placeholders, which are replaced
+// by the UTC date of every message
+type indexPattern []indexPart
+
+// indexPart is either a literal or a date token
+type indexPart struct {
+	literal string
+	token   string
+}
+
+// parseIndexPattern parses the %{+yyyy.MM.dd} date placeholders of an index
+// name. The available tokens are yyyy, yy, MM, dd and HH, and any other
+// character is kept as is.
+func parseIndexPattern(index string) (indexPattern, error) {
+	var p indexPattern
+	for {
+		start := strings.Index(index, "%{+")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(index[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated date placeholder in elasticsearch index %q", index)
+		}
+
+		if start > 0 {
+			p = append(p, indexPart{literal: index[:start]})
+		}
+		layout := index[start+3 : start+end]
+		for len(layout) > 0 {
+			switch token := dateToken(layout); token {
+			case "":
+				p = append(p, indexPart{literal: layout[:1]})
+				layout = layout[1:]
+			default:
+				p = append(p, indexPart{token: token})
+				layout = layout[len(token):]
+			}
+		}
+		index = index[start+end+1:]
+	}
+	if index != "" {
+		p = append(p, indexPart{literal: index})
+	}
+
+	if len(p) == 0 {
+		return nil, errors.New("elasticsearch index can't be empty")
+	}
+	return p, nil
+}
+
+func dateToken(layout string) string {
+	for _, token := range []string{"yyyy", "yy", "MM", "dd", "HH"} {
+		if strings.HasPrefix(layout, token) {
+			return token
+		}
+	}
+	return ""
+}
+
+func (p indexPattern) format(t time.Time) string {
+	t = t.UTC()
+
+	var b strings.Builder
+	for _, part := range p {
+		switch part.token {
+		case "":
+			b.WriteString(part.literal)
+		case "yyyy":
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case "yy":
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case "MM":
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case "dd":
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case "HH":
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package elasticsearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{URLKey: "http://es:9200"}, true},
+		{"full", map[string]string{
+			URLKey:             "https://es:9200/prefix",
+			IndexKey:           "logs-{{.Name}}-%{+yyyy.MM.dd}",
+			PipelineKey:        "docker",
+			UsernameKey:        "user",
+			PasswordKey:        "secret",
+			GzipKey:            "true",
+			BulkSizeKey:        "1024",
+			FlushIntervalKey:   "5s",
+			RetriesKey:         "0",
+			TimeoutKey:         "1m",
+			DeadLetterIndexKey: "dead-letter-%{+yyyy.MM}",
+			ActionKey:          IndexAction,
+			LabelsKey:          "team",
+			EnvKey:             "STAGE",
+		}, true},
+		{"api key", map[string]string{URLKey: "http://es:9200", APIKeyKey: "a2V5"}, true},
+		{"no url", map[string]string{}, false},
+		{"invalid scheme", map[string]string{URLKey: "tcp://es:9200"}, false},
+		{"unknown key", map[string]string{URLKey: "http://es:9200", "elasticsearch-foo": "bar"}, false},
+		{"password without username", map[string]string{URLKey: "http://es:9200", PasswordKey: "secret"}, false},
+		{"api key and username", map[string]string{URLKey: "http://es:9200", APIKeyKey: "a2V5", UsernameKey: "user"}, false},
+		{"invalid action", map[string]string{URLKey: "http://es:9200", ActionKey: "update"}, false},
+		{"invalid gzip", map[string]string{URLKey: "http://es:9200", GzipKey: "maybe"}, false},
+		{"invalid bulk size", map[string]string{URLKey: "http://es:9200", BulkSizeKey: "0"}, false},
+		{"invalid flush interval", map[string]string{URLKey: "http://es:9200", FlushIntervalKey: "-1s"}, false},
+		{"invalid index template", map[string]string{URLKey: "http://es:9200", IndexKey: "logs-{{.Name"}, false},
+		{"unterminated date", map[string]string{URLKey: "http://es:9200", IndexKey: "logs-%{+yyyy"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	u, err := parseURL("http://es:9200", "")
+	require.Nil(t, err)
+	assert.Equal(t, "http://es:9200/_bulk", u)
+
+	u, err = parseURL("https://proxy/es/", "docker logs")
+	require.Nil(t, err)
+	assert.Equal(t, "https://proxy/es/_bulk?pipeline=docker+logs", u)
+}
+
+func TestIndexPattern(t *testing.T) {
+	info := logger.Info{ContainerName: "/web"}
+	ts := time.Date(2021, time.March, 4, 23, 30, 0, 0, time.FixedZone("", -2*60*60))
+
+	for _, tc := range []struct {
+		index    string
+		expected string
+	}{
+		{defaultIndex, "docker-2021.03.05"},
+		{"logs-{{.Name}}-%{+yyyy.MM.dd.HH}", "logs-web-2021.03.05.01"},
+		{"logs-%{+yy}w-%{+MM}", "logs-21w-03"},
+		{"static", "static"},
+	} {
+		p, err := parseIndexTemplate(info, tc.index)
+		require.Nil(t, err)
+		assert.Equal(t, tc.expected, p.format(ts), tc.index)
+	}
+}
@@ -0,0 +1,204 @@
+// Package external provides a log driver forwarding the logs to an external
+// process, over a unix socket or the standard input of a command, so drivers
+// can be written in any language.
+//
+// The process first receives a header with the container info, encoded as
+// JSON, and then a logdriver.LogEntry protobuf message per log message. Every
+// message is preceded by its length, as a big-endian uint32, the same framing
+// used by docker to send the logs to the plugins. The header is sent again
+// after reconnecting or restarting the process.
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/errdefs"
+)
+
+// Driver name & available keys
+const (
+	DriverName     = "external"
+	AddressKey     = DriverName + "-address"
+	ModeKey        = DriverName + "-" + modeOpt
+	MaxBufferKey   = DriverName + "-" + maxBufferOpt
+	TimeoutKey     = DriverName + "-" + timeoutOpt
+	EnvKey         = "env"
+	EnvRegexKey    = "env-regex"
+	LabelsKey      = "labels"
+	LabelsRegexKey = "labels-regex"
+)
+
+// Options shared by the socket and exec drivers, prefixed by the driver name
+const (
+	modeOpt      = "mode"
+	maxBufferOpt = "max-buffer"
+	timeoutOpt   = "timeout"
+)
+
+// Available delivery modes
+const (
+	// BlockingMode blocks logging while the buffer is full
+	BlockingMode = "blocking"
+	// NonBlockingMode drops the messages while the buffer is full
+	NonBlockingMode = "non-blocking"
+)
+
+const (
+	defaultMaxBuffer = 1024
+	defaultTimeout   = 10 * time.Second
+)
+
+// Header is sent to the external process before the log entries
+type Header struct {
+	ContainerID   string            `json:"container_id"`
+	ContainerName string            `json:"container_name"`
+	ImageID       string            `json:"image_id"`
+	ImageName     string            `json:"image_name"`
+	Attrs         map[string]string `json:"attrs,omitempty"`
+}
+
+// New creates an external logger which connects to a unix socket, using the
+// configuration passed in on the context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(DriverName, info.Config)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.address == "" {
+		return nil, fmt.Errorf("%s is required", AddressKey)
+	}
+	return newExternalLogger(DriverName, info, cfg, unixTransport(cfg.address))
+}
+
+// ValidateLogOpt looks for external specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case AddressKey:
+		default:
+			if !isCommonKey(DriverName, key) {
+				return fmt.Errorf("unknown log opt '%s' for external log driver", key)
+			}
+		}
+	}
+
+	c, err := parseConfig(DriverName, cfg)
+	if err != nil {
+		return err
+	}
+	if c.address == "" {
+		return fmt.Errorf("%s is required", AddressKey)
+	}
+	return nil
+}
+
+// NewExec returns the creator and validator of a driver named name, which
+// runs the command for every container and writes the logs to its standard
+// input. The process is restarted if it exits, and it must exit when its
+// standard input is closed.
+func NewExec(name string, command []string) (logger.Creator, logger.LogOptValidator) {
+	creator := func(info logger.Info) (logger.Logger, error) {
+		if len(command) == 0 {
+			return nil, fmt.Errorf("no command for %s log driver", name)
+		}
+		cfg, err := parseConfig(name, info.Config)
+		if err != nil {
+			return nil, err
+		}
+		return newExternalLogger(name, info, cfg, execTransport(command))
+	}
+	validator := func(cfg map[string]string) error {
+		if len(command) == 0 {
+			return fmt.Errorf("no command for %s log driver", name)
+		}
+		for key := range cfg {
+			if !isCommonKey(name, key) {
+				return fmt.Errorf("unknown log opt '%s' for %s log driver", key, name)
+			}
+		}
+		_, err := parseConfig(name, cfg)
+		return err
+	}
+	return creator, validator
+}
+
+// ExecOptions returns the options of a driver created with NewExec
+func ExecOptions(name string) []string {
+	return []string{
+		name + "-" + modeOpt,
+		name + "-" + maxBufferOpt,
+		name + "-" + timeoutOpt,
+		name + "-" + LabelsKey,
+		name + "-" + LabelsRegexKey,
+		name + "-" + EnvKey,
+		name + "-" + EnvRegexKey,
+	}
+}
+
+// isCommonKey checks if the key is an option of both the socket and exec
+// drivers
+func isCommonKey(name, key string) bool {
+	switch key {
+	case name + "-" + modeOpt:
+	case name + "-" + maxBufferOpt:
+	case name + "-" + timeoutOpt:
+	case EnvKey:
+	case EnvRegexKey:
+	case LabelsKey:
+	case LabelsRegexKey:
+	default:
+		return false
+	}
+	return true
+}
+
+// config holds the parsed options
+type config struct {
+	address   string
+	blocking  bool
+	maxBuffer int
+	timeout   time.Duration
+}
+
+func parseConfig(name string, cfg map[string]string) (c config, err error) {
+	if v := cfg[AddressKey]; v != "" && name == DriverName {
+		if c.address = strings.TrimPrefix(v, "unix://"); !filepath.IsAbs(c.address) {
+			return c, fmt.Errorf("invalid address %q, use unix:// and an absolute path", v)
+		}
+	}
+
+	switch v := cfg[name+"-"+modeOpt]; v {
+	case "", BlockingMode:
+		c.blocking = true
+	case NonBlockingMode:
+	default:
+		return c, fmt.Errorf("invalid mode %q, use %s or %s", v, BlockingMode, NonBlockingMode)
+	}
+
+	if c.maxBuffer, err = loggerutil.ParseInt(cfg, name+"-"+maxBufferOpt, defaultMaxBuffer, 1); err != nil {
+		return c, err
+	}
+	c.timeout, err = loggerutil.ParsePositiveDuration(cfg, name+"-"+timeoutOpt, defaultTimeout)
+	return c, err
+}
+
+// encodeHeader returns the header for the container
+func encodeHeader(info logger.Info) ([]byte, error) {
+	attrs, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	return json.Marshal(Header{
+		ContainerID:   info.ContainerID,
+		ContainerName: info.Name(),
+		ImageID:       info.ContainerImageID,
+		ImageName:     info.ContainerImageName,
+		Attrs:         attrs,
+	})
+}
@@ -0,0 +1,340 @@
+package external
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/docker/docker/api/types/plugins/logdriver"
+	"github.com/docker/docker/daemon/logger"
+	protoio "github.com/gogo/protobuf/io"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helperOutputEnv makes the test binary run as an external process, writing
+// the received messages to the given file
+const helperOutputEnv = "EXTERNAL_HELPER_OUTPUT"
+
+func TestMain(m *testing.M) {
+	if path := os.Getenv(helperOutputEnv); path != "" {
+		if err := helperProcess(path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// helperProcess writes a line with the container name and the message for
+// every message received in the standard input
+func helperProcess(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header, entries, err := readMessages(os.Stdin)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(f, "%s %s\n", header.ContainerName, entry.Line)
+	}
+	return nil
+}
+
+// readMessages reads the header and the entries until the end of the stream
+func readMessages(r io.Reader) (header Header, entries []logdriver.LogEntry, err error) {
+	br := bufio.NewReader(r)
+	var size uint32
+	if err = binary.Read(br, binary.BigEndian, &size); err != nil {
+		return
+	}
+	b := make([]byte, size)
+	if _, err = io.ReadFull(br, b); err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &header); err != nil {
+		return
+	}
+
+	dec := protoio.NewUint32DelimitedReader(br, binary.BigEndian, 1e6)
+	for {
+		var entry logdriver.LogEntry
+		if err = dec.ReadMsg(&entry); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{AddressKey: "unix:///run/driver.sock"}, true},
+		{"full", map[string]string{
+			AddressKey:   "/run/driver.sock",
+			ModeKey:      NonBlockingMode,
+			MaxBufferKey: "100",
+			TimeoutKey:   "1s",
+			LabelsKey:    "team",
+			EnvKey:       "STAGE",
+		}, true},
+		{"no address", map[string]string{}, false},
+		{"relative address", map[string]string{AddressKey: "unix://driver.sock"}, false},
+		{"unknown key", map[string]string{AddressKey: "/run/driver.sock", "external-foo": "bar"}, false},
+		{"invalid mode", map[string]string{AddressKey: "/run/driver.sock", ModeKey: "sometimes"}, false},
+		{"invalid max buffer", map[string]string{AddressKey: "/run/driver.sock", MaxBufferKey: "0"}, false},
+		{"invalid timeout", map[string]string{AddressKey: "/run/driver.sock", TimeoutKey: "0s"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateExecLogOpt(t *testing.T) {
+	_, validate := NewExec("mydriver", []string{"/bin/mydriver"})
+	assert.Nil(t, validate(map[string]string{"mydriver-mode": NonBlockingMode, LabelsKey: "team"}))
+	assert.NotNil(t, validate(map[string]string{"mydriver-max-buffer": "many"}))
+	assert.NotNil(t, validate(map[string]string{AddressKey: "/run/driver.sock"}))
+}
+
+// newTestLogger creates a logger writing to the given transport
+func newTestLogger(t *testing.T, cfg map[string]string, tr transport) *externalLogger {
+	info := loggertest.Info(cfg)
+	c, err := parseConfig(DriverName, info.Config)
+	require.Nil(t, err)
+	l, err := newExternalLogger(DriverName, info, c, tr)
+	require.Nil(t, err)
+	return l
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "external")
+	require.Nil(t, err)
+	return dir
+}
+
+func TestUnixSocket(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "driver.sock")
+
+	info := loggertest.Info(map[string]string{AddressKey: "unix://" + path, LabelsKey: "team"})
+	info.ContainerLabels = map[string]string{"team": "core"}
+	l, err := New(info)
+	require.Nil(err)
+	// the socket isn't there yet, so the message is retried
+	ts := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	loggertest.LogAt(t, l, "world", "stdout", ts)
+
+	ln, err := net.Listen("unix", path)
+	require.Nil(err)
+	defer ln.Close()
+
+	type result struct {
+		header  Header
+		entries []logdriver.LogEntry
+		err     error
+	}
+	results := make(chan result)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		header, entries, err := readMessages(conn)
+		results <- result{header, entries, err}
+	}()
+
+	time.Sleep(2 * minBackoff)
+	require.Nil(l.Close())
+
+	r := loggertest.Receive(t, results).(result)
+	require.Nil(r.err)
+	assert.Equal(Header{
+		ContainerID:   loggertest.ContainerID,
+		ContainerName: "web",
+		Attrs:         map[string]string{"team": "core"},
+	}, r.header)
+	require.Len(r.entries, 2)
+	assert.Equal("hello", string(r.entries[0].Line))
+	assert.Equal("stdout", r.entries[0].Source)
+	assert.Equal(ts.UnixNano(), r.entries[0].TimeNano)
+	assert.Equal("world", string(r.entries[1].Line))
+}
+
+func TestWriteTimeout(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "driver.sock")
+
+	ln, err := net.Listen("unix", path)
+	require.Nil(t, err)
+	defer ln.Close()
+
+	l := loggertest.New(t, New, map[string]string{AddressKey: "unix://" + path, TimeoutKey: "100ms"})
+	defer l.Close()
+	// larger than the socket buffers, so the write blocks while the
+	// message isn't read
+	line := strings.Repeat("x", 8<<20)
+	loggertest.Log(t, l, line)
+
+	// the first connection isn't read, so the write times out and the
+	// message is sent again after reconnecting
+	stuck, err := ln.Accept()
+	require.Nil(t, err)
+	defer stuck.Close()
+
+	lines := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		var size uint32
+		binary.Read(br, binary.BigEndian, &size)
+		io.CopyN(ioutil.Discard, br, int64(size))
+		var entry logdriver.LogEntry
+		if protoio.NewUint32DelimitedReader(br, binary.BigEndian, 16<<20).ReadMsg(&entry) == nil {
+			lines <- string(entry.Line)
+		}
+	}()
+	assert.Equal(t, line, loggertest.Receive(t, lines).(string))
+}
+
+func TestExec(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "output")
+	require.Nil(t, os.Setenv(helperOutputEnv, output))
+	defer os.Unsetenv(helperOutputEnv)
+
+	create, _ := NewExec("mydriver", []string{os.Args[0]})
+	l := loggertest.New(t, create, map[string]string{})
+	loggertest.Log(t, l, "hello")
+	loggertest.Log(t, l, "world")
+	// the process exits after the standard input is closed
+	require.Nil(t, l.Close())
+
+	b, err := ioutil.ReadFile(output)
+	require.Nil(t, err)
+	assert.Equal(t, "web hello\nweb world\n", string(b))
+}
+
+// blockingTransport opens a connection which blocks writing until it's
+// released or closed
+type blockingTransport struct {
+	once    sync.Once
+	release chan struct{}
+}
+
+func newBlockingTransport() *blockingTransport {
+	return &blockingTransport{release: make(chan struct{})}
+}
+
+func (t *blockingTransport) open(time.Duration) (conn, error) {
+	return t, nil
+}
+
+func (t *blockingTransport) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (t *blockingTransport) Write(b []byte) (int, error) {
+	<-t.release
+	return len(b), nil
+}
+
+func (t *blockingTransport) Close() error {
+	t.once.Do(func() { close(t.release) })
+	return nil
+}
+
+func TestNonBlockingMode(t *testing.T) {
+	tr := newBlockingTransport()
+	l := newTestLogger(t, map[string]string{ModeKey: NonBlockingMode, MaxBufferKey: "2"}, tr)
+
+	// logging doesn't block although nothing is written
+	for i := 0; i < 10; i++ {
+		loggertest.Log(t, l, strings.Repeat("x", i))
+	}
+	assert.True(t, atomic.LoadUint64(&l.dropped) > 0)
+
+	tr.Close()
+	require.Nil(t, l.Close())
+}
+
+func TestCloseTimeout(t *testing.T) {
+	l := newTestLogger(t, map[string]string{TimeoutKey: "100ms"}, newBlockingTransport())
+	loggertest.Log(t, l, "hello")
+
+	closed := make(chan error)
+	go func() { closed <- l.Close() }()
+	assert.Nil(t, loggertest.Receive(t, closed))
+}
+
+func TestCloseWhileLogBlocked(t *testing.T) {
+	l := newTestLogger(t, map[string]string{MaxBufferKey: "1", TimeoutKey: "100ms"}, newBlockingTransport())
+
+	// nothing is written, so logging blocks once the buffer is full
+	logged := make(chan error, 3)
+	go func() {
+		for i := 0; i < 3; i++ {
+			msg := logger.NewMessage()
+			msg.Line = []byte("hello")
+			logged <- l.Log(msg)
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, loggertest.Receive(t, logged))
+	}
+	select {
+	case <-logged:
+		t.Fatal("logging didn't block")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	closed := make(chan error)
+	go func() { closed <- l.Close() }()
+	assert.Nil(t, loggertest.Receive(t, closed))
+	// the blocked call returns once the logger is closed
+	assert.Equal(t, errLoggerClosed, loggertest.Receive(t, logged))
+}
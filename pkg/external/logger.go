@@ -0,0 +1,249 @@
+package external
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/plugins/logdriver"
+	"github.com/docker/docker/daemon/logger"
+	protoio "github.com/gogo/protobuf/io"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+var (
+	// errLoggerClosed is returned when logging after closing the logger
+	errLoggerClosed = errors.New("external: logger is closed")
+	// errAborted is returned when the external process didn't keep up
+	// while closing the logger
+	errAborted = errors.New("external: aborted on close")
+)
+
+// externalLogger forwards the messages to the external process from a
+// background goroutine, reconnecting or restarting the process when needed.
+type externalLogger struct {
+	name      string
+	id        string
+	cfg       config
+	transport transport
+	header    []byte
+
+	// mu is held by Log while queueing, so entries isn't closed meanwhile
+	mu      sync.RWMutex
+	closed  bool
+	entries chan *logdriver.LogEntry
+	// number of messages dropped while the buffer was full
+	dropped uint64
+
+	// connMu guards the connection, which is only used by the background
+	// goroutine unless it's aborted
+	connMu  sync.Mutex
+	conn    conn
+	aborted bool
+
+	// closed when the logger is closed, so failed messages are not retried
+	// and blocked calls to Log return
+	quit     chan struct{}
+	quitOnce sync.Once
+	done     chan struct{}
+}
+
+func newExternalLogger(name string, info logger.Info, cfg config, t transport) (*externalLogger, error) {
+	header, err := encodeHeader(info)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &externalLogger{
+		name:      name,
+		id:        info.ContainerID,
+		cfg:       cfg,
+		transport: t,
+		header:    header,
+		entries:   make(chan *logdriver.LogEntry, cfg.maxBuffer),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *externalLogger) Log(msg *logger.Message) error {
+	entry := &logdriver.LogEntry{
+		Source:   msg.Source,
+		TimeNano: msg.Timestamp.UnixNano(),
+		Line:     append([]byte(nil), msg.Line...),
+	}
+	if msg.PLogMetaData != nil {
+		entry.Partial = true
+		entry.PartialLogMetadata = &logdriver.PartialLogEntryMetadata{
+			Id:      msg.PLogMetaData.ID,
+			Last:    msg.PLogMetaData.Last,
+			Ordinal: int32(msg.PLogMetaData.Ordinal),
+		}
+	}
+	logger.PutMessage(msg)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return errLoggerClosed
+	}
+
+	if l.cfg.blocking {
+		select {
+		case l.entries <- entry:
+			return nil
+		case <-l.quit:
+			return errLoggerClosed
+		}
+	}
+	select {
+	case l.entries <- entry:
+	default:
+		atomic.AddUint64(&l.dropped, 1)
+	}
+	return nil
+}
+
+// Close stops accepting messages and waits until the buffered ones are sent,
+// without retrying failed ones. If it takes longer than the timeout, the
+// connection is closed and the remaining messages are dropped.
+func (l *externalLogger) Close() error {
+	// quit is closed before taking the lock, so the calls to Log blocked
+	// while the buffer is full release it
+	l.quitOnce.Do(func() { close(l.quit) })
+
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.entries)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-l.done:
+	case <-time.After(l.cfg.timeout):
+		logrus.WithField("id", l.id).Errorf("%s: dropping %d messages, the external process doesn't keep up", l.name, len(l.entries))
+		l.connMu.Lock()
+		l.aborted = true
+		if l.conn != nil {
+			l.conn.Close()
+		}
+		l.connMu.Unlock()
+		<-l.done
+	}
+	return nil
+}
+
+func (l *externalLogger) Name() string {
+	return l.name
+}
+
+func (l *externalLogger) run() {
+	defer close(l.done)
+	defer l.disconnect()
+
+	for entry := range l.entries {
+		if n := atomic.SwapUint64(&l.dropped, 0); n > 0 {
+			logrus.WithField("id", l.id).Warnf("%s: dropped %d messages while the buffer was full", l.name, n)
+		}
+		l.send(entry)
+	}
+}
+
+// send writes a message, retrying with an exponential backoff on errors. The
+// message is dropped if it can't be sent when closing the logger.
+func (l *externalLogger) send(entry *logdriver.LogEntry) {
+	backoff := minBackoff
+	for {
+		err := l.write(entry)
+		if err == nil || err == errAborted {
+			return
+		}
+
+		select {
+		case <-l.quit:
+			logrus.WithField("id", l.id).WithError(err).Errorf("%s: dropping message on close", l.name)
+			return
+		default:
+		}
+
+		logrus.WithField("id", l.id).WithError(err).Warnf("%s: error forwarding message, retrying in %s", l.name, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-l.quit:
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// write sends a message, connecting and sending the header first if needed
+func (l *externalLogger) write(entry *logdriver.LogEntry) error {
+	conn, err := l.connect()
+	if err != nil {
+		return err
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(l.cfg.timeout)); err != nil {
+		l.disconnect()
+		return err
+	}
+	if err := protoio.NewUint32DelimitedWriter(conn, binary.BigEndian).WriteMsg(entry); err != nil {
+		l.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (l *externalLogger) connect() (conn, error) {
+	l.connMu.Lock()
+	if l.aborted {
+		l.connMu.Unlock()
+		return nil, errAborted
+	}
+	if conn := l.conn; conn != nil {
+		l.connMu.Unlock()
+		return conn, nil
+	}
+	conn, err := l.transport.open(l.cfg.timeout)
+	if err != nil {
+		l.connMu.Unlock()
+		return nil, err
+	}
+	// the connection is set before writing the header, so it's closed if
+	// the logger is aborted
+	l.conn = conn
+	l.connMu.Unlock()
+
+	frame := make([]byte, 4+len(l.header))
+	binary.BigEndian.PutUint32(frame, uint32(len(l.header)))
+	copy(frame[4:], l.header)
+	if err := conn.SetWriteDeadline(time.Now().Add(l.cfg.timeout)); err != nil {
+		l.disconnect()
+		return nil, err
+	}
+	if _, err := conn.Write(frame); err != nil {
+		l.disconnect()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (l *externalLogger) disconnect() {
+	l.connMu.Lock()
+	defer l.connMu.Unlock()
+
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
@@ -0,0 +1,91 @@
+package external
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// transport opens a connection to the external process
+type transport interface {
+	open(timeout time.Duration) (conn, error)
+}
+
+// conn is a connection to the external process. The writes fail after the
+// deadline, so a process not reading its input is restarted or reconnected.
+type conn interface {
+	io.WriteCloser
+	SetWriteDeadline(t time.Time) error
+}
+
+// unixTransport connects to the path of a unix socket
+type unixTransport string
+
+func (t unixTransport) open(timeout time.Duration) (conn, error) {
+	return net.DialTimeout("unix", string(t), timeout)
+}
+
+// execTransport starts a command
+type execTransport []string
+
+func (t execTransport) open(timeout time.Duration) (conn, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(t[0], t[1:]...)
+	cmd.Stdin = r
+	// the output goes to the plugin log
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	r.Close()
+
+	p := &process{
+		cmd:     cmd,
+		stdin:   w,
+		timeout: timeout,
+		exited:  make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// process writes to the standard input of a command
+type process struct {
+	cmd     *exec.Cmd
+	stdin   *os.File
+	timeout time.Duration
+	exited  chan struct{}
+}
+
+func (p *process) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+func (p *process) SetWriteDeadline(t time.Time) error {
+	return p.stdin.SetWriteDeadline(t)
+}
+
+// Close closes the standard input, and kills the process if it doesn't exit
+// in time
+func (p *process) Close() error {
+	err := p.stdin.Close()
+	select {
+	case <-p.exited:
+	case <-time.After(p.timeout):
+		p.cmd.Process.Kill()
+		<-p.exited
+	}
+	return err
+}
@@ -0,0 +1,228 @@
+// Package filelog provides a log driver for writing container logs to plain
+// files, with rotation and retention.
+package filelog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"text/template"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/templates"
+	"github.com/docker/docker/errdefs"
+	units "github.com/docker/go-units"
+)
+
+// Driver name & available keys
+const (
+	DriverName        = "file"
+	PathKey           = DriverName + "-path"
+	FormatKey         = DriverName + "-format"
+	TemplateKey       = DriverName + "-template"
+	MaxSizeKey        = DriverName + "-max-size"
+	RotateIntervalKey = DriverName + "-rotate-interval"
+	CompressKey       = DriverName + "-compress"
+	MaxFilesKey       = DriverName + "-max-files"
+	MaxAgeKey         = DriverName + "-max-age"
+	EnvKey            = "env"
+	EnvRegexKey       = "env-regex"
+	LabelsKey         = "labels"
+	LabelsRegexKey    = "labels-regex"
+)
+
+// Available line formats
+const (
+	RawFormat      = "raw"
+	TemplateFormat = "template"
+)
+
+const defaultPath = "/var/log/docker-file/{{.FullID}}.log"
+
+// TemplateData is the data the line template is executed with
+type TemplateData = loggerutil.TemplateData
+
+type fileLogger struct {
+	info  logger.Info
+	tmpl  *template.Template
+	attrs map[string]string
+
+	mu   sync.Mutex
+	file *rotatingFile
+	buf  bytes.Buffer
+}
+
+// New creates a file logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := parsePath(info, cfg.path)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+
+	file, err := openRotatingFile(path, cfg.rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileLogger{
+		info:  info,
+		tmpl:  cfg.tmpl,
+		attrs: attrs,
+		file:  file,
+	}, nil
+}
+
+func (l *fileLogger) Log(msg *logger.Message) error {
+	defer logger.PutMessage(msg)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf.Reset()
+	if l.tmpl != nil {
+		err := l.tmpl.Execute(&l.buf, &TemplateData{
+			Info:      &l.info,
+			Timestamp: msg.Timestamp,
+			Message:   string(msg.Line),
+			Source:    msg.Source,
+			Attrs:     l.attrs,
+		})
+		if err != nil {
+			return err
+		}
+		l.buf.WriteByte('\n')
+	} else {
+		l.buf.Write(msg.Line)
+		// the line goes on with the next message if it's partial
+		if msg.PLogMetaData == nil || msg.PLogMetaData.Last {
+			l.buf.WriteByte('\n')
+		}
+	}
+
+	_, err := l.file.Write(l.buf.Bytes())
+	return err
+}
+
+func (l *fileLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+func (l *fileLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for file specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case PathKey:
+		case FormatKey:
+		case TemplateKey:
+		case MaxSizeKey:
+		case RotateIntervalKey:
+		case CompressKey:
+		case MaxFilesKey:
+		case MaxAgeKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for file log driver", key)
+		}
+	}
+
+	c, err := parseConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := templates.NewParse("path", c.path); err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+	return nil
+}
+
+// config holds the parsed options
+type config struct {
+	path     string
+	tmpl     *template.Template
+	rotation rotation
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	if c.path = cfg[PathKey]; c.path == "" {
+		c.path = defaultPath
+	}
+
+	switch format := cfg[FormatKey]; format {
+	case "", RawFormat:
+		if cfg[TemplateKey] != "" {
+			return c, errors.New("file template requires the template format")
+		}
+	case TemplateFormat:
+		if cfg[TemplateKey] == "" {
+			return c, errors.New("file template is required by the template format")
+		}
+		if c.tmpl, err = templates.NewParse("line", cfg[TemplateKey]); err != nil {
+			return c, errdefs.InvalidParameter(err)
+		}
+	default:
+		return c, fmt.Errorf("invalid file format %q, use %s or %s", format, RawFormat, TemplateFormat)
+	}
+
+	if v := cfg[MaxSizeKey]; v != "" {
+		if c.rotation.maxSize, err = units.RAMInBytes(v); err != nil {
+			return c, errdefs.InvalidParameter(err)
+		}
+		if c.rotation.maxSize <= 0 {
+			return c, fmt.Errorf("%s must be a positive size", MaxSizeKey)
+		}
+	}
+	if c.rotation.interval, err = loggerutil.ParsePositiveDuration(cfg, RotateIntervalKey, 0); err != nil {
+		return
+	}
+	if c.rotation.compress, err = loggerutil.ParseBool(cfg, CompressKey); err != nil {
+		return
+	}
+	if c.rotation.maxFiles, err = loggerutil.ParseInt(cfg, MaxFilesKey, 0, 1); err != nil {
+		return
+	}
+	if c.rotation.maxAge, err = loggerutil.ParsePositiveDuration(cfg, MaxAgeKey, 0); err != nil {
+		return
+	}
+
+	return c, nil
+}
+
+// parsePath renders the path template using the container info
+func parsePath(info logger.Info, path string) (string, error) {
+	tmpl, err := templates.NewParse("path", path)
+	if err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, &info); err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+
+	if !filepath.IsAbs(buf.String()) {
+		return "", errdefs.InvalidParameter(fmt.Errorf("file path %q must be absolute", buf.String()))
+	}
+	return filepath.Clean(buf.String()), nil
+}
@@ -0,0 +1,114 @@
+package filelog
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"empty", map[string]string{}, true},
+		{"full", map[string]string{
+			PathKey:           "/var/log/containers/{{.Name}}/{{.ContainerID}}.log",
+			FormatKey:         TemplateFormat,
+			TemplateKey:       "{{.Name}} {{.Message}}",
+			MaxSizeKey:        "10m",
+			RotateIntervalKey: "24h",
+			CompressKey:       "true",
+			MaxFilesKey:       "5",
+			MaxAgeKey:         "168h",
+			LabelsKey:         "team",
+			EnvKey:            "STAGE",
+		}, true},
+		{"unknown key", map[string]string{"file-foo": "bar"}, false},
+		{"invalid path", map[string]string{PathKey: "/var/log/{{.Name"}, false},
+		{"invalid format", map[string]string{FormatKey: "json"}, false},
+		{"template without format", map[string]string{TemplateKey: "{{.Message}}"}, false},
+		{"format without template", map[string]string{FormatKey: TemplateFormat}, false},
+		{"invalid template", map[string]string{FormatKey: TemplateFormat, TemplateKey: "{{.Message"}, false},
+		{"invalid max size", map[string]string{MaxSizeKey: "ten"}, false},
+		{"zero max size", map[string]string{MaxSizeKey: "0"}, false},
+		{"invalid rotate interval", map[string]string{RotateIntervalKey: "-1h"}, false},
+		{"invalid compress", map[string]string{CompressKey: "maybe"}, false},
+		{"invalid max files", map[string]string{MaxFilesKey: "0"}, false},
+		{"invalid max age", map[string]string{MaxAgeKey: "week"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+// logPartial logs a part of a line
+func logPartial(t *testing.T, l logger.Logger, line string, plog *backend.PartialLogMetaData) {
+	msg := logger.NewMessage()
+	msg.Line = []byte(line)
+	msg.Source = "stdout"
+	msg.Timestamp = time.Now()
+	msg.PLogMetaData = plog
+	require.Nil(t, l.Log(msg))
+}
+
+func TestLogRaw(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelog")
+	require.Nil(t, err)
+	defer removeAll(dir)
+
+	l := loggertest.New(t, New, map[string]string{
+		PathKey: dir + "/{{.Name}}/{{.ContainerID}}.log",
+	})
+
+	loggertest.Log(t, l, "hello")
+	logPartial(t, l, "par", &backend.PartialLogMetaData{ID: "1", Ordinal: 1})
+	logPartial(t, l, "tial", &backend.PartialLogMetaData{ID: "1", Ordinal: 2, Last: true})
+	require.Nil(t, l.Close())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "web", loggertest.ContainerID+".log"))
+	require.Nil(t, err)
+	assert.Equal(t, "hello\npartial\n", string(b))
+}
+
+func TestLogTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelog")
+	require.Nil(t, err)
+	defer removeAll(dir)
+
+	info := loggertest.Info(map[string]string{
+		PathKey:     dir + "/web.log",
+		FormatKey:   TemplateFormat,
+		TemplateKey: `{{.Timestamp.UTC.Format "15:04:05"}} {{.Name}}/{{.ID}} [{{.Source}}] {{.Attrs.team}}: {{.Message}}`,
+		LabelsKey:   "team",
+	})
+	info.ContainerLabels = map[string]string{"team": "core"}
+	l, err := New(info)
+	require.Nil(t, err)
+
+	loggertest.LogAt(t, l, "hello", "stdout", time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC))
+	require.Nil(t, l.Close())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "web.log"))
+	require.Nil(t, err)
+	assert.Equal(t, "03:04:05 web/7f0ebc7d0b9a [stdout] core: hello\n", string(b))
+}
+
+func TestRelativePath(t *testing.T) {
+	_, err := New(loggertest.Info(map[string]string{PathKey: "logs/{{.Name}}.log"}))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,246 @@
+package filelog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// suffix of the rotated files, which sorts them by age
+	rotatedLayout = "20060102T150405.000000000"
+	gzipExt       = ".gz"
+)
+
+// rotation holds the rotation and retention settings, where the zero values
+// disable them
+type rotation struct {
+	maxSize  int64
+	interval time.Duration
+	compress bool
+	maxFiles int
+	maxAge   time.Duration
+}
+
+// rotatingFile is a file which is rotated when it's too large or old. The
+// rotated files are compressed and deleted in the background.
+type rotatingFile struct {
+	path string
+	rotation
+
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// serializes the compression and deletion of the rotated files
+	cleanupMu sync.Mutex
+	cleanups  sync.WaitGroup
+
+	now func() time.Time
+}
+
+func openRotatingFile(path string, r rotation) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:     path,
+		rotation: r,
+		now:      time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return fmt.Errorf("error setting up logger dir: %v", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = stat.Size()
+	f.opened = f.now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if needed.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.size > 0 && f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) shouldRotate(n int) bool {
+	if f.maxSize > 0 && f.size+int64(n) > f.maxSize {
+		return true
+	}
+	return f.interval > 0 && f.now().Sub(f.opened) >= f.interval
+}
+
+// rotate renames the file after the rotation time and opens a new one. If
+// that fails, the original file is reopened, so the next write is not lost
+// and the rotation is tried again.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return f.reopen(err)
+	}
+
+	now := f.now()
+	rotated := f.path + "." + now.UTC().Format(rotatedLayout)
+	if err := os.Rename(f.path, rotated); err != nil {
+		return f.reopen(err)
+	}
+	if err := f.open(); err != nil {
+		// put the file back, so it's the one reopened
+		_ = os.Rename(rotated, f.path)
+		return f.reopen(err)
+	}
+
+	f.cleanups.Add(1)
+	go f.cleanup(rotated, now)
+	return nil
+}
+
+// reopen opens the file again after a failed rotation, returning the
+// rotation error
+func (f *rotatingFile) reopen(err error) error {
+	if openErr := f.open(); openErr != nil {
+		logrus.WithError(openErr).WithField("file", f.path).Error("file: unable to reopen log file")
+	}
+	return err
+}
+
+// cleanup compresses the rotated file if needed, and deletes the rotated
+// files beyond the retention settings at the rotation time
+func (f *rotatingFile) cleanup(rotated string, now time.Time) {
+	defer f.cleanups.Done()
+
+	f.cleanupMu.Lock()
+	defer f.cleanupMu.Unlock()
+
+	if f.compress {
+		if err := compressFile(rotated); err != nil {
+			logrus.WithError(err).WithField("file", rotated).Error("file: unable to compress rotated log file")
+		}
+	}
+
+	if f.maxFiles == 0 && f.maxAge == 0 {
+		return
+	}
+
+	files, err := f.rotatedFiles()
+	if err != nil {
+		logrus.WithError(err).WithField("file", f.path).Error("file: unable to list rotated log files")
+		return
+	}
+	for i, file := range files {
+		expired := f.maxAge > 0 && now.Sub(file.rotatedAt) > f.maxAge
+		if (f.maxFiles > 0 && i >= f.maxFiles) || expired {
+			if err := os.Remove(file.path); err != nil {
+				logrus.WithError(err).WithField("file", file.path).Error("file: unable to remove rotated log file")
+			}
+		}
+	}
+}
+
+type rotatedFile struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// rotatedFiles returns the rotated files, newest first. The directory is
+// listed rather than globbed, as the path may contain glob metacharacters.
+func (f *rotatingFile) rotatedFiles() ([]rotatedFile, error) {
+	dir, prefix := filepath.Split(f.path)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix += "."
+	var files []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, prefix), gzipExt)
+		rotatedAt, err := time.Parse(rotatedLayout, suffix)
+		if err != nil {
+			// not one of our files
+			continue
+		}
+		files = append(files, rotatedFile{filepath.Join(dir, name), rotatedAt})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].rotatedAt.After(files[j].rotatedAt) })
+	return files, nil
+}
+
+// compressFile replaces the file with a gzip compressed one
+func compressFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + gzipExt + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, path+gzipExt); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Close closes the file and waits until the rotated files are cleaned up.
+func (f *rotatingFile) Close() error {
+	err := f.file.Close()
+	f.cleanups.Wait()
+	return err
+}
@@ -0,0 +1,185 @@
+package filelog
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func removeAll(dir string) {
+	_ = os.RemoveAll(dir)
+}
+
+// testFile opens a rotating file in a temporary directory with a fake clock,
+// which is advanced by step on every call.
+func testFile(t *testing.T, r rotation, step time.Duration) (*rotatingFile, string) {
+	dir, err := ioutil.TempDir("", "filelog")
+	require.Nil(t, err)
+
+	f, err := openRotatingFile(filepath.Join(dir, "web.log"), r)
+	require.Nil(t, err)
+
+	now := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+	f.opened = now
+	return f, dir
+}
+
+func write(t *testing.T, f *rotatingFile, s string) {
+	_, err := f.Write([]byte(s))
+	require.Nil(t, err)
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	return string(b)
+}
+
+func TestRotateBySize(t *testing.T) {
+	f, dir := testFile(t, rotation{maxSize: 10}, time.Second)
+	defer removeAll(dir)
+
+	write(t, f, "first\n")
+	write(t, f, "second\n")
+	write(t, f, "third\n")
+	require.Nil(t, f.Close())
+
+	assert.Equal(t, "third\n", readFile(t, f.path))
+
+	files, err := f.rotatedFiles()
+	require.Nil(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "second\n", readFile(t, files[0].path))
+	assert.Equal(t, "first\n", readFile(t, files[1].path))
+}
+
+func TestRotateByInterval(t *testing.T) {
+	f, dir := testFile(t, rotation{interval: 90 * time.Second}, time.Minute)
+	defer removeAll(dir)
+
+	write(t, f, "first\n")
+	write(t, f, "second\n")
+	write(t, f, "third\n")
+	require.Nil(t, f.Close())
+
+	// the clock moves a minute on every check, so the second write is within
+	// the interval and the third one isn't
+	assert.Equal(t, "third\n", readFile(t, f.path))
+	files, err := f.rotatedFiles()
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "first\nsecond\n", readFile(t, files[0].path))
+}
+
+func TestRotateCompressed(t *testing.T) {
+	f, dir := testFile(t, rotation{maxSize: 1, compress: true}, time.Second)
+	defer removeAll(dir)
+
+	write(t, f, "first\n")
+	write(t, f, "second\n")
+	require.Nil(t, f.Close())
+
+	files, err := f.rotatedFiles()
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, gzipExt, filepath.Ext(files[0].path))
+
+	gz, err := os.Open(files[0].path)
+	require.Nil(t, err)
+	defer gz.Close()
+	zr, err := gzip.NewReader(gz)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(zr)
+	require.Nil(t, err)
+	assert.Equal(t, "first\n", string(b))
+}
+
+func TestRetention(t *testing.T) {
+	f, dir := testFile(t, rotation{maxSize: 1, maxFiles: 2}, time.Second)
+	defer removeAll(dir)
+
+	// unrelated files are kept
+	other := f.path + ".bak"
+	require.Nil(t, ioutil.WriteFile(other, []byte("backup"), 0640))
+
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		write(t, f, line)
+	}
+	require.Nil(t, f.Close())
+
+	files, err := f.rotatedFiles()
+	require.Nil(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "c\n", readFile(t, files[0].path))
+	assert.Equal(t, "b\n", readFile(t, files[1].path))
+	assert.Equal(t, "backup", readFile(t, other))
+}
+
+func TestRetentionByAge(t *testing.T) {
+	f, dir := testFile(t, rotation{maxSize: 1, maxAge: time.Hour}, time.Second)
+	defer removeAll(dir)
+
+	old := f.path + "." + time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC).Format(rotatedLayout)
+	require.Nil(t, ioutil.WriteFile(old, []byte("old\n"), 0640))
+
+	write(t, f, "first\n")
+	write(t, f, "second\n")
+	require.Nil(t, f.Close())
+
+	_, err := os.Stat(old)
+	assert.True(t, os.IsNotExist(err))
+	files, err := f.rotatedFiles()
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "first\n", readFile(t, files[0].path))
+}
+
+func TestRotateFailure(t *testing.T) {
+	f, dir := testFile(t, rotation{maxSize: 1}, time.Second)
+	defer removeAll(dir)
+
+	// a directory in the way of the first rotated file makes the rename fail
+	blocker := f.path + "." + time.Date(2020, time.January, 2, 3, 4, 6, 0, time.UTC).Format(rotatedLayout)
+	require.Nil(t, os.MkdirAll(filepath.Join(blocker, "dir"), 0755))
+
+	write(t, f, "first\n")
+	_, err := f.Write([]byte("second\n"))
+	assert.NotNil(t, err)
+
+	// the original file is reopened, and the rotation tried again
+	write(t, f, "third\n")
+	require.Nil(t, f.Close())
+
+	assert.Equal(t, "third\n", readFile(t, f.path))
+	files, err := f.rotatedFiles()
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "first\n", readFile(t, files[0].path))
+}
+
+func TestRotatedFilesWithGlobCharacters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelog")
+	require.Nil(t, err)
+	defer removeAll(dir)
+
+	f := &rotatingFile{path: filepath.Join(dir, "web[1].log")}
+	suffix := "." + time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC).Format(rotatedLayout)
+	for _, name := range []string{"web[1].log" + suffix, "web1.log" + suffix} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0640))
+	}
+
+	files, err := f.rotatedFiles()
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, f.path+suffix, files[0].path)
+}
@@ -0,0 +1,132 @@
+package httplog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/batcher"
+	"github.com/sirupsen/logrus"
+)
+
+// client batches the message payloads and sends them from a background
+// goroutine.
+type client struct {
+	cfg     config
+	http    *http.Client
+	batcher *batcher.Batcher
+}
+
+func newClient(cfg config) *client {
+	c := &client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: cfg.timeout},
+	}
+	c.batcher = batcher.New(batcher.Config{
+		Wait:     cfg.batchWait,
+		MaxItems: cfg.batchCount,
+		MaxSize:  cfg.batchSize,
+		Size:     func(item interface{}) int { return len(item.([]byte)) },
+	}, c.send)
+	return c
+}
+
+// push queues a payload, blocking if the queue is full.
+func (c *client) push(item []byte) error {
+	return c.batcher.Push(item)
+}
+
+// close stops accepting payloads and waits until the queued ones are sent,
+// without retrying failed requests.
+func (c *client) close() error {
+	c.batcher.Close()
+	return nil
+}
+
+// send posts a batch, retrying with an exponential backoff on network
+// errors, rate limiting and server errors. The batch is dropped if it can't
+// be sent.
+func (c *client) send(batch []interface{}) {
+	items := make([][]byte, 0, len(batch))
+	for _, item := range batch {
+		items = append(items, item.([]byte))
+	}
+
+	body, err := c.encode(items)
+	if err != nil {
+		logrus.WithError(err).Error("http: unable to encode batch")
+		return
+	}
+
+	status, err := c.batcher.RetryHTTP(c.http, c.cfg.retries, func() (*http.Request, error) {
+		return c.request(body)
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("status", status).Errorf("http: dropping %d messages", len(items))
+	}
+}
+
+// encode returns the request body of a batch, compressed if needed
+func (c *client) encode(items [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := io.Writer(&buf)
+
+	var zw *gzip.Writer
+	if c.cfg.gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+
+	var sep, end []byte
+	switch c.cfg.format {
+	case JSONArrayFormat:
+		if _, err := w.Write([]byte{'['}); err != nil {
+			return nil, err
+		}
+		sep, end = []byte{','}, []byte{']'}
+	default:
+		sep, end = []byte{'\n'}, []byte{'\n'}
+	}
+
+	for i, item := range items {
+		if i > 0 {
+			if _, err := w.Write(sep); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := w.Write(item); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := w.Write(end); err != nil {
+		return nil, err
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// request returns the request sending the body
+func (c *client) request(body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(c.cfg.method, c.cfg.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.cfg.headers {
+		req.Header[k] = v
+	}
+	if c.cfg.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.cfg.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.bearerToken)
+	} else if c.cfg.username != "" {
+		req.SetBasicAuth(c.cfg.username, c.cfg.password)
+	}
+	return req, nil
+}
@@ -0,0 +1,166 @@
+package httplog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// startServer runs an HTTP endpoint stand-in which replies with the given
+// status codes, in order, and then with 200. Every request is sent to the
+// returned channel, with its body decompressed. The server must be closed by
+// the caller.
+func startServer(t *testing.T, statuses ...int) (*httptest.Server, <-chan request) {
+	var calls int32
+	requests := make(chan request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			require.Nil(t, err)
+			body = zr
+		}
+		b, err := ioutil.ReadAll(body)
+		require.Nil(t, err)
+		requests <- request{method: r.Method, header: r.Header, body: string(b)}
+
+		if n := int(atomic.AddInt32(&calls, 1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	return srv, requests
+}
+
+func TestSendNDJSON(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startServer(t)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:         srv.URL,
+		HeadersKey:     "X-Team=core",
+		GzipKey:        "true",
+		BearerTokenKey: "token",
+	})
+
+	ts := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	loggertest.LogAt(t, l, "world", "stdout", ts)
+	require.Nil(l.Close())
+
+	req := loggertest.Receive(t, requests).(request)
+	assert.Equal(http.MethodPost, req.method)
+	assert.Equal("application/x-ndjson", req.header.Get("Content-Type"))
+	assert.Equal("core", req.header.Get("X-Team"))
+	assert.Equal("Bearer token", req.header.Get("Authorization"))
+
+	lines := strings.Split(strings.TrimSuffix(req.body, "\n"), "\n")
+	require.Len(lines, 2)
+	for i, message := range []string{"hello", "world"} {
+		var fields map[string]interface{}
+		require.Nil(json.Unmarshal([]byte(lines[i]), &fields))
+		assert.Equal(message, fields["message"])
+		assert.Equal("stdout", fields["source"])
+		assert.Equal("web", fields["container_name"])
+		assert.Equal("2020-01-02T03:04:05Z", fields["timestamp"])
+	}
+}
+
+func TestSendJSONArrayInBatches(t *testing.T) {
+	srv, requests := startServer(t)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:        srv.URL,
+		FormatKey:     JSONArrayFormat,
+		BatchCountKey: "2",
+	})
+
+	for _, line := range []string{"a", "b", "c"} {
+		loggertest.Log(t, l, line)
+	}
+	require.Nil(t, l.Close())
+
+	for _, expected := range [][]string{{"a", "b"}, {"c"}} {
+		req := loggertest.Receive(t, requests).(request)
+		assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+
+		var batch []map[string]interface{}
+		require.Nil(t, json.Unmarshal([]byte(req.body), &batch))
+		require.Len(t, batch, len(expected))
+		for i, message := range expected {
+			assert.Equal(t, message, batch[i]["message"])
+		}
+	}
+}
+
+func TestSendTemplateWithRetries(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startServer(t, http.StatusServiceUnavailable)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:         srv.URL,
+		MethodKey:      http.MethodPut,
+		FormatKey:      TemplateFormat,
+		TemplateKey:    `{"text": {{json (printf "%s: %s" .Name .Message)}}}`,
+		ContentTypeKey: "application/json",
+		BatchCountKey:  "1",
+		UsernameKey:    "user",
+		PasswordKey:    "secret",
+	})
+	defer l.Close()
+
+	loggertest.Log(t, l, "hello")
+
+	// the unavailable endpoint is retried
+	for i := 0; i < 2; i++ {
+		req := loggertest.Receive(t, requests).(request)
+		assert.Equal(http.MethodPut, req.method)
+		assert.Equal("application/json", req.header.Get("Content-Type"))
+		user, pass, ok := (&http.Request{Header: req.header}).BasicAuth()
+		require.True(ok)
+		assert.Equal("user", user)
+		assert.Equal("secret", pass)
+		assert.Equal("{\"text\": \"web: hello\"}\n", req.body)
+	}
+}
+
+func TestSendDropsRejectedBatch(t *testing.T) {
+	srv, requests := startServer(t, http.StatusBadRequest)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:        srv.URL,
+		BatchCountKey: "1",
+	})
+	defer l.Close()
+
+	loggertest.Log(t, l, "rejected")
+	assert.Contains(t, loggertest.Receive(t, requests).(request).body, "rejected")
+
+	// the rejected batch isn't retried, so the next request holds a new line
+	loggertest.Log(t, l, "accepted")
+	assert.Contains(t, loggertest.Receive(t, requests).(request).body, "accepted")
+}
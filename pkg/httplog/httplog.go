@@ -0,0 +1,302 @@
+// Package httplog provides a log driver for posting container logs to any
+// HTTP endpoint, like webhooks.
+package httplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/templates"
+	"github.com/docker/docker/errdefs"
+)
+
+// Driver name & available keys
+const (
+	DriverName     = "http"
+	URLKey         = DriverName + "-url"
+	MethodKey      = DriverName + "-method"
+	HeadersKey     = DriverName + "-headers"
+	FormatKey      = DriverName + "-format"
+	TemplateKey    = DriverName + "-template"
+	ContentTypeKey = DriverName + "-content-type"
+	BatchCountKey  = DriverName + "-batch-count"
+	BatchSizeKey   = DriverName + "-batch-size"
+	BatchWaitKey   = DriverName + "-batch-wait"
+	GzipKey        = DriverName + "-gzip"
+	RetriesKey     = DriverName + "-retries"
+	TimeoutKey     = DriverName + "-timeout"
+	BearerTokenKey = DriverName + "-bearer-token"
+	UsernameKey    = DriverName + "-username"
+	PasswordKey    = DriverName + "-password"
+	EnvKey         = "env"
+	EnvRegexKey    = "env-regex"
+	LabelsKey      = "labels"
+	LabelsRegexKey = "labels-regex"
+)
+
+// Available payload formats
+const (
+	NDJSONFormat    = "ndjson"
+	JSONArrayFormat = "json-array"
+	TemplateFormat  = "template"
+)
+
+const (
+	defaultBatchCount = 100
+	defaultBatchSize  = 1024 * 1024
+	defaultBatchWait  = time.Second
+	defaultRetries    = 3
+	defaultTimeout    = 10 * time.Second
+)
+
+// TemplateData is the data the payload template is executed with
+type TemplateData = loggerutil.TemplateData
+
+type httpLogger struct {
+	client *client
+	info   logger.Info
+	tmpl   *template.Template
+	attrs  map[string]string
+	// fields added to every JSON payload
+	fields map[string]interface{}
+}
+
+// New creates an http logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	fields, err := loggerutil.ContainerFields(info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpLogger{
+		client: newClient(cfg),
+		info:   info,
+		tmpl:   cfg.tmpl,
+		attrs:  attrs,
+		fields: fields,
+	}, nil
+}
+
+func (l *httpLogger) Log(msg *logger.Message) error {
+	if len(msg.Line) == 0 {
+		logger.PutMessage(msg)
+		return nil
+	}
+
+	item, err := l.encode(msg)
+	logger.PutMessage(msg)
+	if err != nil {
+		return err
+	}
+	return l.client.push(item)
+}
+
+// encode returns the payload of a message
+func (l *httpLogger) encode(msg *logger.Message) ([]byte, error) {
+	if l.tmpl != nil {
+		buf := new(bytes.Buffer)
+		err := l.tmpl.Execute(buf, &TemplateData{
+			Info:      &l.info,
+			Timestamp: msg.Timestamp,
+			Message:   string(msg.Line),
+			Source:    msg.Source,
+			Attrs:     l.attrs,
+		})
+		return buf.Bytes(), err
+	}
+
+	fields := make(map[string]interface{}, len(l.fields)+3)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields["timestamp"] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+	fields["message"] = string(msg.Line)
+	fields["source"] = msg.Source
+	return json.Marshal(fields)
+}
+
+func (l *httpLogger) Close() error {
+	return l.client.close()
+}
+
+func (l *httpLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for http specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case URLKey:
+		case MethodKey:
+		case HeadersKey:
+		case FormatKey:
+		case TemplateKey:
+		case ContentTypeKey:
+		case BatchCountKey:
+		case BatchSizeKey:
+		case BatchWaitKey:
+		case GzipKey:
+		case RetriesKey:
+		case TimeoutKey:
+		case BearerTokenKey:
+		case UsernameKey:
+		case PasswordKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for http log driver", key)
+		}
+	}
+	_, err := parseConfig(cfg)
+	return err
+}
+
+// config holds the parsed options
+type config struct {
+	url         string
+	method      string
+	headers     http.Header
+	format      string
+	tmpl        *template.Template
+	batchCount  int
+	batchSize   int
+	batchWait   time.Duration
+	gzip        bool
+	retries     int
+	timeout     time.Duration
+	bearerToken string
+	username    string
+	password    string
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	if c.url, err = parseURL(cfg[URLKey]); err != nil {
+		return
+	}
+
+	switch c.method = strings.ToUpper(cfg[MethodKey]); c.method {
+	case "":
+		c.method = http.MethodPost
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return c, fmt.Errorf("invalid http method %q, use POST, PUT or PATCH", cfg[MethodKey])
+	}
+
+	if c.headers, err = parseHeaders(cfg[HeadersKey]); err != nil {
+		return
+	}
+
+	contentType := cfg[ContentTypeKey]
+	switch c.format = cfg[FormatKey]; c.format {
+	case "", NDJSONFormat:
+		c.format = NDJSONFormat
+		if contentType == "" {
+			contentType = "application/x-ndjson"
+		}
+	case JSONArrayFormat:
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	case TemplateFormat:
+		if cfg[TemplateKey] == "" {
+			return c, errors.New("http template is required by the template format")
+		}
+		if c.tmpl, err = templates.NewParse("payload", cfg[TemplateKey]); err != nil {
+			return c, errdefs.InvalidParameter(err)
+		}
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+	default:
+		return c, fmt.Errorf("invalid http format %q, use %s, %s or %s", c.format, NDJSONFormat, JSONArrayFormat, TemplateFormat)
+	}
+	if c.format != TemplateFormat && cfg[TemplateKey] != "" {
+		return c, errors.New("http template requires the template format")
+	}
+	c.headers.Set("Content-Type", contentType)
+
+	if c.batchCount, err = loggerutil.ParseInt(cfg, BatchCountKey, defaultBatchCount, 1); err != nil {
+		return
+	}
+	if c.batchSize, err = loggerutil.ParseInt(cfg, BatchSizeKey, defaultBatchSize, 1); err != nil {
+		return
+	}
+	if c.batchWait, err = loggerutil.ParsePositiveDuration(cfg, BatchWaitKey, defaultBatchWait); err != nil {
+		return
+	}
+	if c.gzip, err = loggerutil.ParseBool(cfg, GzipKey); err != nil {
+		return
+	}
+	if c.retries, err = loggerutil.ParseInt(cfg, RetriesKey, defaultRetries, 0); err != nil {
+		return
+	}
+	if c.timeout, err = loggerutil.ParsePositiveDuration(cfg, TimeoutKey, defaultTimeout); err != nil {
+		return
+	}
+
+	c.bearerToken = cfg[BearerTokenKey]
+	c.username = cfg[UsernameKey]
+	c.password = cfg[PasswordKey]
+	if c.password != "" && c.username == "" {
+		return c, errors.New("http password requires a username")
+	}
+	if c.bearerToken != "" && c.username != "" {
+		return c, errors.New("http bearer token and basic authentication can't be used together")
+	}
+
+	return c, nil
+}
+
+func parseURL(address string) (string, error) {
+	if address == "" {
+		return "", errors.New("http url is required")
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("http url should be in form http[s]://host[:port][/path], got %v", address)
+	}
+	return u.String(), nil
+}
+
+// parseHeaders parses a comma-separated list of name=value headers
+func parseHeaders(headers string) (http.Header, error) {
+	result := make(http.Header)
+	if headers == "" {
+		return result, nil
+	}
+
+	for _, header := range strings.Split(headers, ",") {
+		kv := strings.SplitN(strings.TrimSpace(header), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid http header %q, use name=value", header)
+		}
+		result.Add(kv[0], kv[1])
+	}
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package httplog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{URLKey: "http://hooks"}, true},
+		{"full", map[string]string{
+			URLKey:         "https://hooks/logs",
+			MethodKey:      "put",
+			HeadersKey:     "X-Team=core,X-Env=prod",
+			FormatKey:      TemplateFormat,
+			TemplateKey:    `{"text": {{json .Message}}}`,
+			ContentTypeKey: "application/json",
+			BatchCountKey:  "1",
+			BatchSizeKey:   "4096",
+			BatchWaitKey:   "5s",
+			GzipKey:        "true",
+			RetriesKey:     "0",
+			TimeoutKey:     "30s",
+			BearerTokenKey: "token",
+			LabelsKey:      "team",
+			EnvKey:         "STAGE",
+		}, true},
+		{"basic auth", map[string]string{URLKey: "http://hooks", UsernameKey: "user", PasswordKey: "secret"}, true},
+		{"no url", map[string]string{}, false},
+		{"invalid url", map[string]string{URLKey: "hooks:80"}, false},
+		{"unknown key", map[string]string{URLKey: "http://hooks", "http-foo": "bar"}, false},
+		{"invalid method", map[string]string{URLKey: "http://hooks", MethodKey: "GET"}, false},
+		{"invalid header", map[string]string{URLKey: "http://hooks", HeadersKey: "X-Team"}, false},
+		{"invalid format", map[string]string{URLKey: "http://hooks", FormatKey: "xml"}, false},
+		{"template without format", map[string]string{URLKey: "http://hooks", TemplateKey: "{{.Message}}"}, false},
+		{"format without template", map[string]string{URLKey: "http://hooks", FormatKey: TemplateFormat}, false},
+		{"invalid template", map[string]string{URLKey: "http://hooks", FormatKey: TemplateFormat, TemplateKey: "{{.Message"}, false},
+		{"invalid batch count", map[string]string{URLKey: "http://hooks", BatchCountKey: "0"}, false},
+		{"invalid gzip", map[string]string{URLKey: "http://hooks", GzipKey: "maybe"}, false},
+		{"password without username", map[string]string{URLKey: "http://hooks", PasswordKey: "secret"}, false},
+		{"bearer and basic auth", map[string]string{URLKey: "http://hooks", BearerTokenKey: "token", UsernameKey: "user"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestEncodeTemplate(t *testing.T) {
+	info := logger.Info{
+		ContainerID:     "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		ContainerName:   "/web",
+		ContainerLabels: map[string]string{"team": "core"},
+		Config: map[string]string{
+			URLKey:      "http://hooks",
+			FormatKey:   TemplateFormat,
+			TemplateKey: `{{.Timestamp.UTC.Format "15:04:05"}} {{.Name}}/{{.ID}} [{{.Source}}] {{.Attrs.team}}: {{json .Message}}`,
+			LabelsKey:   "team",
+		},
+	}
+
+	l, err := New(info)
+	require.Nil(t, err)
+	defer l.Close()
+
+	msg := logger.NewMessage()
+	msg.Line = []byte(`say "hi"`)
+	msg.Source = "stderr"
+	msg.Timestamp = time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	item, err := l.(*httpLogger).encode(msg)
+	require.Nil(t, err)
+	assert.Equal(t, `03:04:05 web/7f0ebc7d0b9a [stderr] core: "say \"hi\""`, string(item))
+}
@@ -0,0 +1,417 @@
+// Package kafka provides a log driver for publishing container logs to
+// Kafka topics.
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/templates"
+	"github.com/docker/docker/errdefs"
+	"github.com/sirupsen/logrus"
+)
+
+// Driver name & available keys
+const (
+	DriverName       = "kafka"
+	BrokersKey       = DriverName + "-brokers"
+	TopicKey         = DriverName + "-topic"
+	KeyKey           = DriverName + "-key"
+	FormatKey        = DriverName + "-format"
+	CompressionKey   = DriverName + "-compression"
+	AcksKey          = DriverName + "-acks"
+	BatchSizeKey     = DriverName + "-batch-size"
+	BatchWaitKey     = DriverName + "-batch-wait"
+	RetriesKey       = DriverName + "-retries"
+	VersionKey       = DriverName + "-version"
+	SASLMechanismKey = DriverName + "-sasl-mechanism"
+	SASLUsernameKey  = DriverName + "-sasl-username"
+	SASLPasswordKey  = DriverName + "-sasl-password"
+	TLSKey           = DriverName + "-tls"
+	TLSCACertKey     = DriverName + "-tls-ca-cert"
+	TLSCertKey       = DriverName + "-tls-cert"
+	TLSKeyKey        = DriverName + "-tls-key"
+	TLSSkipVerifyKey = DriverName + "-tls-skip-verify"
+	EnvKey           = "env"
+	EnvRegexKey      = "env-regex"
+	LabelsKey        = "labels"
+	LabelsRegexKey   = "labels-regex"
+)
+
+// Available message keys
+const (
+	ContainerIDMsgKey   = "container-id"
+	ContainerNameMsgKey = "container-name"
+	NoMsgKey            = "none"
+)
+
+// Available message formats
+const (
+	JSONFormat = "json"
+	RawFormat  = "raw"
+)
+
+const (
+	clientID = "docker-multilogger"
+
+	defaultBatchSize = 16 * 1024
+	defaultBatchWait = 100 * time.Millisecond
+	defaultRetries   = 3
+)
+
+var (
+	defaultVersion = sarama.V1_0_0_0
+
+	// Kafka topic names may only contain these characters
+	validTopic = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+	// errLoggerClosed is returned when logging after closing the logger
+	errLoggerClosed = errors.New("kafka: logger is closed")
+)
+
+type kafkaLogger struct {
+	producer sarama.AsyncProducer
+	topic    string
+	key      sarama.Encoder
+	raw      bool
+	// fields added to every JSON message
+	fields map[string]interface{}
+
+	mu     sync.RWMutex
+	closed bool
+	// closed when the producer errors are drained
+	done chan struct{}
+}
+
+// New creates a kafka logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewAsyncProducer(cfg.brokers, cfg.sarama)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := newKafkaLogger(info, cfg, producer)
+	if err != nil {
+		producer.AsyncClose()
+		return nil, err
+	}
+	return l, nil
+}
+
+// newKafkaLogger creates a kafka logger publishing through the given
+// producer, which must return its errors.
+func newKafkaLogger(info logger.Info, cfg config, producer sarama.AsyncProducer) (*kafkaLogger, error) {
+	topic, err := parseTopic(info, cfg.topic)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &kafkaLogger{
+		producer: producer,
+		topic:    topic,
+		raw:      cfg.format == RawFormat,
+		done:     make(chan struct{}),
+	}
+
+	switch cfg.key {
+	case ContainerIDMsgKey:
+		l.key = sarama.StringEncoder(info.ContainerID)
+	case ContainerNameMsgKey:
+		l.key = sarama.StringEncoder(info.Name())
+	}
+
+	if !l.raw {
+		if l.fields, err = loggerutil.ContainerFields(info); err != nil {
+			return nil, err
+		}
+	}
+
+	go l.drainErrors()
+	return l, nil
+}
+
+func (l *kafkaLogger) Log(msg *logger.Message) error {
+	if len(msg.Line) == 0 {
+		logger.PutMessage(msg)
+		return nil
+	}
+
+	var value []byte
+	if l.raw {
+		// the line is copied, as the message is reused after returning it
+		value = append(value, msg.Line...)
+	} else {
+		fields := make(map[string]interface{}, len(l.fields)+3)
+		for k, v := range l.fields {
+			fields[k] = v
+		}
+		fields["timestamp"] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+		fields["message"] = string(msg.Line)
+		fields["source"] = msg.Source
+
+		var err error
+		if value, err = json.Marshal(fields); err != nil {
+			logger.PutMessage(msg)
+			return err
+		}
+	}
+
+	pm := &sarama.ProducerMessage{
+		Topic:     l.topic,
+		Key:       l.key,
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: msg.Timestamp,
+	}
+	logger.PutMessage(msg)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return errLoggerClosed
+	}
+	l.producer.Input() <- pm
+	return nil
+}
+
+// drainErrors logs the messages which couldn't be published, until the
+// producer is closed
+func (l *kafkaLogger) drainErrors() {
+	defer close(l.done)
+	for err := range l.producer.Errors() {
+		logrus.WithError(err.Err).WithField("topic", err.Msg.Topic).Error("kafka: dropping message")
+	}
+}
+
+// Close flushes the pending messages and closes the producer
+func (l *kafkaLogger) Close() error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		l.producer.AsyncClose()
+	}
+	l.mu.Unlock()
+
+	<-l.done
+	return nil
+}
+
+func (l *kafkaLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for kafka specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case BrokersKey:
+		case TopicKey:
+		case KeyKey:
+		case FormatKey:
+		case CompressionKey:
+		case AcksKey:
+		case BatchSizeKey:
+		case BatchWaitKey:
+		case RetriesKey:
+		case VersionKey:
+		case SASLMechanismKey:
+		case SASLUsernameKey:
+		case SASLPasswordKey:
+		case TLSKey:
+		case TLSCACertKey:
+		case TLSCertKey:
+		case TLSKeyKey:
+		case TLSSkipVerifyKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for kafka log driver", key)
+		}
+	}
+
+	c, err := parseConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := templates.NewParse("topic", c.topic); err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+	return nil
+}
+
+// config holds the parsed options
+type config struct {
+	brokers []string
+	topic   string
+	key     string
+	format  string
+	sarama  *sarama.Config
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	for _, broker := range strings.Split(cfg[BrokersKey], ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			c.brokers = append(c.brokers, broker)
+		}
+	}
+	if len(c.brokers) == 0 {
+		return c, errors.New("kafka brokers are required")
+	}
+
+	if c.topic = cfg[TopicKey]; c.topic == "" {
+		return c, errors.New("kafka topic is required")
+	}
+
+	switch c.key = cfg[KeyKey]; c.key {
+	case "":
+		c.key = ContainerIDMsgKey
+	case ContainerIDMsgKey, ContainerNameMsgKey, NoMsgKey:
+	default:
+		return c, fmt.Errorf("invalid kafka key %q, use %s, %s or %s", c.key, ContainerIDMsgKey, ContainerNameMsgKey, NoMsgKey)
+	}
+
+	switch c.format = cfg[FormatKey]; c.format {
+	case "":
+		c.format = JSONFormat
+	case JSONFormat, RawFormat:
+	default:
+		return c, fmt.Errorf("invalid kafka format %q, use %s or %s", c.format, JSONFormat, RawFormat)
+	}
+
+	c.sarama = sarama.NewConfig()
+	c.sarama.ClientID = clientID
+	c.sarama.Producer.Return.Errors = true
+
+	if err = parseProducerConfig(cfg, c.sarama); err != nil {
+		return
+	}
+	if err = parseNetConfig(cfg, c.sarama); err != nil {
+		return
+	}
+
+	if err = c.sarama.Validate(); err != nil {
+		return c, errdefs.InvalidParameter(err)
+	}
+	return c, nil
+}
+
+func parseProducerConfig(cfg map[string]string, sc *sarama.Config) (err error) {
+	switch compression := cfg[CompressionKey]; compression {
+	case "", "none":
+		sc.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		sc.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		sc.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		sc.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		sc.Producer.Compression = sarama.CompressionZSTD
+	default:
+		return fmt.Errorf("invalid kafka compression %q, use none, gzip, snappy, lz4 or zstd", compression)
+	}
+
+	switch acks := cfg[AcksKey]; acks {
+	case "", "all":
+		sc.Producer.RequiredAcks = sarama.WaitForAll
+	case "1":
+		sc.Producer.RequiredAcks = sarama.WaitForLocal
+	case "0":
+		sc.Producer.RequiredAcks = sarama.NoResponse
+	default:
+		return fmt.Errorf("invalid kafka acks %q, use 0, 1 or all", acks)
+	}
+
+	if sc.Producer.Flush.Bytes, err = loggerutil.ParseInt(cfg, BatchSizeKey, defaultBatchSize, 1); err != nil {
+		return
+	}
+	if sc.Producer.Flush.Frequency, err = loggerutil.ParsePositiveDuration(cfg, BatchWaitKey, defaultBatchWait); err != nil {
+		return
+	}
+	if sc.Producer.Retry.Max, err = loggerutil.ParseInt(cfg, RetriesKey, defaultRetries, 0); err != nil {
+		return
+	}
+
+	// zstd requires a newer protocol version than the default one
+	sc.Version = defaultVersion
+	if sc.Producer.Compression == sarama.CompressionZSTD {
+		sc.Version = sarama.V2_1_0_0
+	}
+	if v := cfg[VersionKey]; v != "" {
+		if sc.Version, err = sarama.ParseKafkaVersion(v); err != nil {
+			return errdefs.InvalidParameter(err)
+		}
+	}
+
+	return nil
+}
+
+func parseNetConfig(cfg map[string]string, sc *sarama.Config) (err error) {
+	mechanism, username, password := cfg[SASLMechanismKey], cfg[SASLUsernameKey], cfg[SASLPasswordKey]
+	if mechanism != "" || username != "" {
+		if username == "" || password == "" {
+			return errors.New("kafka sasl requires a username and a password")
+		}
+
+		sc.Net.SASL.Enable = true
+		sc.Net.SASL.User = username
+		sc.Net.SASL.Password = password
+
+		switch mechanism {
+		case "", sarama.SASLTypePlaintext:
+			sc.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			sc.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			sc.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha256Generator} }
+		case sarama.SASLTypeSCRAMSHA512:
+			sc.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			sc.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha512Generator} }
+		default:
+			return fmt.Errorf("invalid kafka sasl mechanism %q, use %s, %s or %s", mechanism,
+				sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512)
+		}
+	}
+
+	sc.Net.TLS.Config, err = loggerutil.ParseTLS(cfg, loggerutil.TLSKeys{
+		Enable:     TLSKey,
+		CACert:     TLSCACertKey,
+		Cert:       TLSCertKey,
+		Key:        TLSKeyKey,
+		SkipVerify: TLSSkipVerifyKey,
+	})
+	sc.Net.TLS.Enable = sc.Net.TLS.Config != nil
+	return
+}
+
+// parseTopic renders the topic template using the container info
+func parseTopic(info logger.Info, topic string) (string, error) {
+	tmpl, err := templates.NewParse("topic", topic)
+	if err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, &info); err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+
+	if !validTopic.MatchString(buf.String()) {
+		return "", errdefs.InvalidParameter(fmt.Errorf("invalid kafka topic %q", buf.String()))
+	}
+	return buf.String(), nil
+}
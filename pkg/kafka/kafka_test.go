@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs"}, true},
+		{"full", map[string]string{
+			BrokersKey:       "kafka-1:9092, kafka-2:9092",
+			TopicKey:         `logs-{{index .ContainerLabels "com.docker.compose.project"}}`,
+			KeyKey:           ContainerNameMsgKey,
+			FormatKey:        RawFormat,
+			CompressionKey:   "zstd",
+			AcksKey:          "1",
+			BatchSizeKey:     "65536",
+			BatchWaitKey:     "500ms",
+			RetriesKey:       "0",
+			SASLMechanismKey: sarama.SASLTypeSCRAMSHA512,
+			SASLUsernameKey:  "user",
+			SASLPasswordKey:  "secret",
+			TLSKey:           "true",
+			TLSSkipVerifyKey: "true",
+			LabelsKey:        "team",
+			EnvKey:           "STAGE",
+		}, true},
+		{"no brokers", map[string]string{TopicKey: "logs"}, false},
+		{"no topic", map[string]string{BrokersKey: "kafka:9092"}, false},
+		{"invalid topic template", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs-{{.Name"}, false},
+		{"unknown key", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", "kafka-foo": "bar"}, false},
+		{"invalid key", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", KeyKey: "image"}, false},
+		{"invalid format", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", FormatKey: "avro"}, false},
+		{"invalid compression", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", CompressionKey: "brotli"}, false},
+		{"invalid acks", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", AcksKey: "2"}, false},
+		{"invalid version", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", VersionKey: "latest"}, false},
+		{"zstd on old version", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", CompressionKey: "zstd", VersionKey: "1.0.0"}, false},
+		{"sasl without password", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", SASLUsernameKey: "user"}, false},
+		{"invalid sasl mechanism", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", SASLMechanismKey: "GSSAPI", SASLUsernameKey: "user", SASLPasswordKey: "secret"}, false},
+		{"invalid tls", map[string]string{BrokersKey: "kafka:9092", TopicKey: "logs", TLSKey: "maybe"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestParseTopic(t *testing.T) {
+	info := logger.Info{
+		ContainerName:   "/web",
+		ContainerLabels: map[string]string{"com.docker.compose.project": "shop"},
+	}
+
+	topic, err := parseTopic(info, `logs.{{index .ContainerLabels "com.docker.compose.project"}}`)
+	require.Nil(t, err)
+	assert.Equal(t, "logs.shop", topic)
+
+	_, err = parseTopic(info, "logs/{{.Name}}")
+	assert.NotNil(t, err, "topics can't contain slashes")
+
+	_, err = parseTopic(logger.Info{}, `{{index .ContainerLabels "missing"}}`)
+	assert.NotNil(t, err, "topics can't be empty")
+}
+
+func TestLogJSON(t *testing.T) {
+	info := loggertest.Info(map[string]string{
+		BrokersKey: "kafka:9092",
+		TopicKey:   "logs-{{.Name}}",
+		LabelsKey:  "team",
+	})
+	info.ContainerImageName = "nginx:latest"
+	info.ContainerLabels = map[string]string{"team": "core"}
+	cfg, err := parseConfig(info.Config)
+	require.Nil(t, err)
+
+	ts := time.Date(2020, time.January, 2, 3, 4, 5, 6, time.UTC)
+	producer := mocks.NewAsyncProducer(t, cfg.sarama)
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "logs-web", msg.Topic)
+		assert.Equal(t, sarama.StringEncoder(info.ContainerID), msg.Key)
+		assert.Equal(t, ts, msg.Timestamp)
+
+		value, err := msg.Value.Encode()
+		require.Nil(t, err)
+		var fields map[string]interface{}
+		require.Nil(t, json.Unmarshal(value, &fields))
+		assert.Equal(t, map[string]interface{}{
+			"timestamp":      "2020-01-02T03:04:05.000000006Z",
+			"message":        "hello",
+			"source":         "stdout",
+			"container_id":   info.ContainerID,
+			"container_name": "web",
+			"image_id":       "",
+			"image_name":     "nginx:latest",
+			"team":           "core",
+		}, fields)
+		return nil
+	})
+
+	l, err := newKafkaLogger(info, cfg, producer)
+	require.Nil(t, err)
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	require.Nil(t, l.Close())
+
+	msg := logger.NewMessage()
+	msg.Line = []byte("late")
+	assert.Equal(t, errLoggerClosed, l.Log(msg))
+}
+
+func TestLogRawWithoutKey(t *testing.T) {
+	info := loggertest.Info(map[string]string{
+		BrokersKey: "kafka:9092",
+		TopicKey:   "logs",
+		KeyKey:     NoMsgKey,
+		FormatKey:  RawFormat,
+	})
+	cfg, err := parseConfig(info.Config)
+	require.Nil(t, err)
+
+	producer := mocks.NewAsyncProducer(t, cfg.sarama)
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Nil(t, msg.Key)
+		value, err := msg.Value.Encode()
+		require.Nil(t, err)
+		assert.Equal(t, "hello", string(value))
+		return nil
+	})
+	// failed messages are logged and dropped
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	l, err := newKafkaLogger(info, cfg, producer)
+	require.Nil(t, err)
+	loggertest.Log(t, l, "hello")
+	loggertest.Log(t, l, "lost")
+	require.Nil(t, l.Close())
+}
+
+func TestPublishToBroker(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("logs-web", 0, broker.BrokerID()),
+		// the default protocol version sends v3 produce requests
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	l := loggertest.New(t, New, map[string]string{
+		BrokersKey:     broker.Addr(),
+		TopicKey:       "logs-{{.Name}}",
+		CompressionKey: "gzip",
+	})
+	loggertest.Log(t, l, "hello")
+	require.Nil(t, l.Close())
+
+	var produced bool
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced = true
+		}
+	}
+	assert.True(t, produced, "the message should be published on close")
+}
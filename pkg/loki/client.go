@@ -0,0 +1,120 @@
+package loki
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/batcher"
+	"github.com/sirupsen/logrus"
+)
+
+// entry is a log line of a stream
+type entry struct {
+	labels    *labelSet
+	timestamp time.Time
+	line      string
+}
+
+// stream holds the entries of a batch with the same labels
+type stream struct {
+	labels  *labelSet
+	entries []entry
+}
+
+// batch groups the entries by stream, keeping the order in which the
+// streams were added
+type batch struct {
+	streams map[string]*stream
+	order   []*stream
+	size    int
+}
+
+func newBatch() *batch {
+	return &batch{streams: make(map[string]*stream)}
+}
+
+func (b *batch) add(e entry) {
+	s, ok := b.streams[e.labels.key]
+	if !ok {
+		s = &stream{labels: e.labels}
+		b.streams[e.labels.key] = s
+		b.order = append(b.order, s)
+	}
+	s.entries = append(s.entries, e)
+	b.size += len(e.line)
+}
+
+// client batches entries and pushes them to Loki from a background
+// goroutine.
+type client struct {
+	cfg     config
+	http    *http.Client
+	batcher *batcher.Batcher
+}
+
+func newClient(cfg config) *client {
+	c := &client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: cfg.timeout},
+	}
+	c.batcher = batcher.New(batcher.Config{
+		Wait:       cfg.batchWait,
+		MaxSize:    cfg.batchSize,
+		Size:       func(e interface{}) int { return len(e.(entry).line) },
+		MinBackoff: cfg.minBackoff,
+		MaxBackoff: cfg.maxBackoff,
+	}, c.send)
+	return c
+}
+
+// push queues an entry, blocking if the queue is full.
+func (c *client) push(e entry) error {
+	return c.batcher.Push(e)
+}
+
+// close stops accepting entries and waits until the queued ones are pushed,
+// without retrying failed pushes.
+func (c *client) close() error {
+	c.batcher.Close()
+	return nil
+}
+
+// send pushes a batch, retrying with an exponential backoff on network
+// errors, rate limiting and server errors. The batch is dropped if it can't
+// be pushed.
+func (c *client) send(entries []interface{}) {
+	b := newBatch()
+	for _, e := range entries {
+		b.add(e.(entry))
+	}
+
+	body, contentType, err := encode(c.cfg.format, b)
+	if err != nil {
+		logrus.WithError(err).Error("loki: unable to encode batch")
+		return
+	}
+
+	status, err := c.batcher.RetryHTTP(c.http, c.cfg.retries, func() (*http.Request, error) {
+		return c.request(body, contentType)
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("status", status).Error("loki: dropping batch")
+	}
+}
+
+// request returns the request pushing the body to Loki
+func (c *client) request(body []byte, contentType string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, c.cfg.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.cfg.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.cfg.tenantID)
+	}
+	if c.cfg.username != "" {
+		req.SetBasicAuth(c.cfg.username, c.cfg.password)
+	}
+	return req, nil
+}
@@ -0,0 +1,176 @@
+package loki
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/allgdante/docker-multilogger-plugin/internal/protowire"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pushRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// startLokiServer runs a Loki stand-in which replies with the given status
+// codes, in order, and then with 204. Every request is sent to the returned
+// channel. The server must be closed by the caller.
+func startLokiServer(t *testing.T, statuses ...int) (*httptest.Server, <-chan pushRequest) {
+	var calls int32
+	requests := make(chan pushRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, pushPath, r.URL.Path)
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+		requests <- pushRequest{header: r.Header, body: body}
+
+		if n := int(atomic.AddInt32(&calls, 1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return srv, requests
+}
+
+func TestPushJSON(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startLokiServer(t)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:          srv.URL,
+		FormatKey:       JSONFormat,
+		TenantIDKey:     "tenant-1",
+		UsernameKey:     "user",
+		PasswordKey:     "secret",
+		StreamLabelsKey: "container_name,source",
+	})
+
+	ts := time.Unix(1577934245, 123)
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	loggertest.LogAt(t, l, "oops", "stderr", ts)
+	require.Nil(l.Close())
+
+	req := loggertest.Receive(t, requests).(pushRequest)
+	assert.Equal("application/json", req.header.Get("Content-Type"))
+	assert.Equal("tenant-1", req.header.Get("X-Scope-OrgID"))
+	user, pass, ok := (&http.Request{Header: req.header}).BasicAuth()
+	require.True(ok)
+	assert.Equal("user", user)
+	assert.Equal("secret", pass)
+
+	var push jsonPushRequest
+	require.Nil(json.Unmarshal(req.body, &push))
+	assert.Equal([]jsonStream{
+		{
+			Stream: map[string]string{"container_name": "web", "source": "stdout"},
+			Values: [][2]string{{"1577934245000000123", "hello"}},
+		},
+		{
+			Stream: map[string]string{"container_name": "web", "source": "stderr"},
+			Values: [][2]string{{"1577934245000000123", "oops"}},
+		},
+	}, push.Streams)
+}
+
+// protoFields decodes the fields of a protobuf message
+func protoFields(t *testing.T, b []byte) map[int][]interface{} {
+	fields, err := protowire.Fields(b)
+	require.Nil(t, err)
+	return fields
+}
+
+func TestPushProtobuf(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startLokiServer(t)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{URLKey: srv.URL})
+
+	ts := time.Unix(1577934245, 123)
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	loggertest.LogAt(t, l, "world", "stdout", ts.Add(time.Second))
+	require.Nil(l.Close())
+
+	req := loggertest.Receive(t, requests).(pushRequest)
+	assert.Equal("application/x-protobuf", req.header.Get("Content-Type"))
+	assert.Empty(req.header.Get("X-Scope-OrgID"))
+
+	body, err := snappy.Decode(nil, req.body)
+	require.Nil(err)
+
+	streams := protoFields(t, body)[1]
+	require.Len(streams, 1)
+	stream := protoFields(t, streams[0].([]byte))
+	assert.Equal(`{container_name="web"}`, string(stream[1][0].([]byte)))
+
+	entries := stream[2]
+	require.Len(entries, 2)
+	for i, line := range []string{"hello", "world"} {
+		e := protoFields(t, entries[i].([]byte))
+		assert.Equal(line, string(e[2][0].([]byte)))
+
+		timestamp := protoFields(t, e[1][0].([]byte))
+		assert.EqualValues(ts.Unix()+int64(i), timestamp[1][0])
+		assert.EqualValues(123, timestamp[2][0])
+	}
+}
+
+func TestPushRetries(t *testing.T) {
+	srv, requests := startLokiServer(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:        srv.URL,
+		FormatKey:     JSONFormat,
+		BatchWaitKey:  "10ms",
+		MinBackoffKey: "10ms",
+	})
+	defer l.Close()
+
+	loggertest.Log(t, l, "hello")
+
+	// the batch is retried until it is accepted
+	var bodies []string
+	for i := 0; i < 3; i++ {
+		bodies = append(bodies, string(loggertest.Receive(t, requests).(pushRequest).body))
+	}
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, bodies[0], bodies[2])
+}
+
+func TestPushDropsRejectedBatch(t *testing.T) {
+	srv, requests := startLokiServer(t, http.StatusBadRequest)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:        srv.URL,
+		FormatKey:     JSONFormat,
+		BatchWaitKey:  "10ms",
+		MinBackoffKey: "10ms",
+	})
+	defer l.Close()
+
+	loggertest.Log(t, l, "rejected")
+	assert.Contains(t, string(loggertest.Receive(t, requests).(pushRequest).body), "rejected")
+
+	// the rejected batch isn't retried, so the next one holds a new line
+	loggertest.Log(t, l, "accepted")
+	body := string(loggertest.Receive(t, requests).(pushRequest).body)
+	assert.Contains(t, body, "accepted")
+	assert.NotContains(t, body, "rejected")
+}
@@ -0,0 +1,392 @@
+// Package loki provides a log driver for pushing container logs to Grafana Loki.
+package loki
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/errdefs"
+)
+
+// Driver name & available keys
+const (
+	DriverName        = "loki"
+	URLKey            = DriverName + "-url"
+	TenantIDKey       = DriverName + "-tenant-id"
+	UsernameKey       = DriverName + "-username"
+	PasswordKey       = DriverName + "-password"
+	FormatKey         = DriverName + "-format"
+	StreamLabelsKey   = DriverName + "-stream-labels"
+	ExternalLabelsKey = DriverName + "-external-labels"
+	BatchSizeKey      = DriverName + "-batch-size"
+	BatchWaitKey      = DriverName + "-batch-wait"
+	RetriesKey        = DriverName + "-retries"
+	MinBackoffKey     = DriverName + "-min-backoff"
+	MaxBackoffKey     = DriverName + "-max-backoff"
+	TimeoutKey        = DriverName + "-timeout"
+	EnvKey            = "env"
+	EnvRegexKey       = "env-regex"
+	LabelsKey         = "labels"
+	LabelsRegexKey    = "labels-regex"
+)
+
+// Available push formats
+const (
+	ProtobufFormat = "protobuf"
+	JSONFormat     = "json"
+)
+
+// Available stream labels
+const (
+	ContainerNameLabel  = "container_name"
+	ContainerIDLabel    = "container_id"
+	ImageLabel          = "image"
+	ComposeServiceLabel = "compose_service"
+	ComposeProjectLabel = "compose_project"
+	HostLabel           = "host"
+	SourceLabel         = "source"
+)
+
+const (
+	pushPath = "/loki/api/v1/push"
+
+	defaultBatchSize  = 1024 * 1024
+	defaultBatchWait  = time.Second
+	defaultRetries    = 10
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+	defaultTimeout    = 10 * time.Second
+
+	composeServiceLabel = "com.docker.compose.service"
+	composeProjectLabel = "com.docker.compose.project"
+)
+
+var (
+	defaultStreamLabels = []string{ContainerNameLabel, ComposeServiceLabel, ComposeProjectLabel}
+
+	invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+type lokiLogger struct {
+	client *client
+	// stream labels by message source, or a single one with the "" key if
+	// the source is not a label
+	streams map[string]*labelSet
+}
+
+// New creates a loki logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := streamLabels(info, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make(map[string]*labelSet)
+	if containsLabel(cfg.streamLabels, SourceLabel) {
+		for _, source := range []string{"stdout", "stderr"} {
+			l := copyLabels(labels)
+			l[SourceLabel] = source
+			streams[source] = newLabelSet(l)
+		}
+	} else {
+		streams[""] = newLabelSet(labels)
+	}
+
+	return &lokiLogger{
+		client:  newClient(cfg),
+		streams: streams,
+	}, nil
+}
+
+func (l *lokiLogger) Log(msg *logger.Message) error {
+	if len(msg.Line) == 0 {
+		logger.PutMessage(msg)
+		return nil
+	}
+
+	labels, ok := l.streams[""]
+	if !ok {
+		if labels, ok = l.streams[msg.Source]; !ok {
+			labels = l.streams["stdout"]
+		}
+	}
+
+	// the line is copied, as the message is reused after returning it
+	err := l.client.push(entry{
+		labels:    labels,
+		timestamp: msg.Timestamp,
+		line:      string(msg.Line),
+	})
+	logger.PutMessage(msg)
+	return err
+}
+
+func (l *lokiLogger) Close() error {
+	return l.client.close()
+}
+
+func (l *lokiLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for loki specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case URLKey:
+		case TenantIDKey:
+		case UsernameKey:
+		case PasswordKey:
+		case FormatKey:
+		case StreamLabelsKey:
+		case ExternalLabelsKey:
+		case BatchSizeKey:
+		case BatchWaitKey:
+		case RetriesKey:
+		case MinBackoffKey:
+		case MaxBackoffKey:
+		case TimeoutKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for loki log driver", key)
+		}
+	}
+	_, err := parseConfig(cfg)
+	return err
+}
+
+// config holds the parsed options
+type config struct {
+	url            string
+	tenantID       string
+	username       string
+	password       string
+	format         string
+	streamLabels   []string
+	externalLabels map[string]string
+	batchSize      int
+	batchWait      time.Duration
+	retries        int
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	if c.url, err = parseURL(cfg[URLKey]); err != nil {
+		return
+	}
+
+	c.tenantID = cfg[TenantIDKey]
+	c.username = cfg[UsernameKey]
+	c.password = cfg[PasswordKey]
+	if c.password != "" && c.username == "" {
+		return c, errors.New("loki password requires a username")
+	}
+
+	switch c.format = cfg[FormatKey]; c.format {
+	case "":
+		c.format = ProtobufFormat
+	case ProtobufFormat, JSONFormat:
+	default:
+		return c, fmt.Errorf("invalid loki format %q, use %s or %s", c.format, ProtobufFormat, JSONFormat)
+	}
+
+	if c.streamLabels, err = parseStreamLabels(cfg[StreamLabelsKey]); err != nil {
+		return
+	}
+	if c.externalLabels, err = parseExternalLabels(cfg[ExternalLabelsKey]); err != nil {
+		return
+	}
+
+	if c.batchSize, err = loggerutil.ParseInt(cfg, BatchSizeKey, defaultBatchSize, 1); err != nil {
+		return
+	}
+	if c.batchWait, err = loggerutil.ParsePositiveDuration(cfg, BatchWaitKey, defaultBatchWait); err != nil {
+		return
+	}
+	if c.retries, err = loggerutil.ParseInt(cfg, RetriesKey, defaultRetries, 0); err != nil {
+		return
+	}
+	if c.minBackoff, err = loggerutil.ParsePositiveDuration(cfg, MinBackoffKey, defaultMinBackoff); err != nil {
+		return
+	}
+	if c.maxBackoff, err = loggerutil.ParsePositiveDuration(cfg, MaxBackoffKey, defaultMaxBackoff); err != nil {
+		return
+	}
+	if c.maxBackoff < c.minBackoff {
+		return c, errors.New("loki max backoff must not be less than the min backoff")
+	}
+	if c.timeout, err = loggerutil.ParsePositiveDuration(cfg, TimeoutKey, defaultTimeout); err != nil {
+		return
+	}
+
+	return c, nil
+}
+
+// parseURL parses the Loki URL, adding the push path if there is none
+func parseURL(address string) (string, error) {
+	if address == "" {
+		return "", errors.New("loki url is required")
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("loki url should be in form http[s]://host[:port][/path], got %v", address)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = pushPath
+	}
+	return u.String(), nil
+}
+
+func parseStreamLabels(labels string) ([]string, error) {
+	if labels == "" {
+		return defaultStreamLabels, nil
+	}
+
+	var result []string
+	for _, label := range strings.Split(labels, ",") {
+		switch label = strings.TrimSpace(label); label {
+		case ContainerNameLabel, ContainerIDLabel, ImageLabel,
+			ComposeServiceLabel, ComposeProjectLabel, HostLabel, SourceLabel:
+			result = append(result, label)
+		default:
+			return nil, fmt.Errorf("unknown loki stream label %q", label)
+		}
+	}
+	return result, nil
+}
+
+// parseExternalLabels parses a comma-separated list of name=value labels
+func parseExternalLabels(labels string) (map[string]string, error) {
+	result := make(map[string]string)
+	if labels == "" {
+		return result, nil
+	}
+
+	for _, label := range strings.Split(labels, ",") {
+		kv := strings.SplitN(strings.TrimSpace(label), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid loki external label %q, use name=value", label)
+		}
+		result[sanitizeLabelName(kv[0])] = kv[1]
+	}
+	return result, nil
+}
+
+// streamLabels returns the labels of the container streams, except for the
+// source, which changes with every message.
+func streamLabels(info logger.Info, cfg config) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	extra, err := info.ExtraAttributes(sanitizeLabelName)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+
+	for k, v := range cfg.externalLabels {
+		labels[k] = v
+	}
+
+	for _, label := range cfg.streamLabels {
+		var value string
+		switch label {
+		case ContainerNameLabel:
+			value = info.Name()
+		case ContainerIDLabel:
+			value = info.ID()
+		case ImageLabel:
+			value = info.ImageName()
+		case ComposeServiceLabel:
+			value = info.ContainerLabels[composeServiceLabel]
+		case ComposeProjectLabel:
+			value = info.ContainerLabels[composeProjectLabel]
+		case HostLabel:
+			value, _ = info.Hostname()
+		}
+		if value != "" {
+			labels[label] = value
+		}
+	}
+
+	return labels, nil
+}
+
+// sanitizeLabelName replaces the characters not allowed in label names
+func sanitizeLabelName(name string) string {
+	name = invalidLabelChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func containsLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	return result
+}
+
+// labelSet is a set of stream labels with its string representation, which
+// identifies the stream
+type labelSet struct {
+	labels map[string]string
+	key    string
+}
+
+func newLabelSet(labels map[string]string) *labelSet {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s=%q", name, labels[name])
+	}
+	b.WriteString("}")
+
+	return &labelSet{
+		labels: labels,
+		key:    b.String(),
+	}
+}
@@ -0,0 +1,112 @@
+package loki
+
+import (
+	"testing"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{URLKey: "http://loki:3100"}, true},
+		{"full", map[string]string{
+			URLKey:            "https://loki:3100/custom/push",
+			TenantIDKey:       "tenant",
+			UsernameKey:       "user",
+			PasswordKey:       "secret",
+			FormatKey:         JSONFormat,
+			StreamLabelsKey:   "container_name, source",
+			ExternalLabelsKey: "env=prod,region=eu",
+			BatchSizeKey:      "4096",
+			BatchWaitKey:      "2s",
+			RetriesKey:        "0",
+			MinBackoffKey:     "1s",
+			MaxBackoffKey:     "1m",
+			TimeoutKey:        "5s",
+			LabelsKey:         "team",
+			EnvKey:            "STAGE",
+		}, true},
+		{"no url", map[string]string{}, false},
+		{"invalid scheme", map[string]string{URLKey: "tcp://loki:3100"}, false},
+		{"unknown key", map[string]string{URLKey: "http://loki:3100", "loki-foo": "bar"}, false},
+		{"password without username", map[string]string{URLKey: "http://loki:3100", PasswordKey: "secret"}, false},
+		{"invalid format", map[string]string{URLKey: "http://loki:3100", FormatKey: "xml"}, false},
+		{"unknown stream label", map[string]string{URLKey: "http://loki:3100", StreamLabelsKey: "pod"}, false},
+		{"invalid external label", map[string]string{URLKey: "http://loki:3100", ExternalLabelsKey: "env"}, false},
+		{"invalid batch size", map[string]string{URLKey: "http://loki:3100", BatchSizeKey: "0"}, false},
+		{"negative retries", map[string]string{URLKey: "http://loki:3100", RetriesKey: "-1"}, false},
+		{"invalid batch wait", map[string]string{URLKey: "http://loki:3100", BatchWaitKey: "soon"}, false},
+		{"inverted backoff", map[string]string{URLKey: "http://loki:3100", MinBackoffKey: "1m", MaxBackoffKey: "1s"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestParseURLAddsPushPath(t *testing.T) {
+	u, err := parseURL("http://loki:3100")
+	require.Nil(t, err)
+	assert.Equal(t, "http://loki:3100/loki/api/v1/push", u)
+
+	u, err = parseURL("http://gateway/custom/push")
+	require.Nil(t, err)
+	assert.Equal(t, "http://gateway/custom/push", u)
+}
+
+func TestStreamLabels(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	info := logger.Info{
+		ContainerID:        "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		ContainerName:      "/web",
+		ContainerImageName: "nginx:latest",
+		ContainerLabels: map[string]string{
+			"com.docker.compose.service": "frontend",
+			"com.docker.compose.project": "shop",
+			"team.name":                  "core",
+		},
+		Config: map[string]string{
+			URLKey:            "http://loki:3100",
+			StreamLabelsKey:   "container_name,image,compose_service,compose_project",
+			ExternalLabelsKey: "env=prod",
+			LabelsKey:         "team.name",
+		},
+	}
+
+	cfg, err := parseConfig(info.Config)
+	require.Nil(err)
+
+	labels, err := streamLabels(info, cfg)
+	require.Nil(err)
+	assert.Equal(map[string]string{
+		"container_name":  "web",
+		"image":           "nginx:latest",
+		"compose_service": "frontend",
+		"compose_project": "shop",
+		"env":             "prod",
+		"team_name":       "core",
+	}, labels)
+
+	set := newLabelSet(labels)
+	assert.Equal(`{compose_project="shop", compose_service="frontend", container_name="web", env="prod", image="nginx:latest", team_name="core"}`, set.key)
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	assert.Equal(t, "com_example_label", sanitizeLabelName("com.example-label"))
+	assert.Equal(t, "_1st", sanitizeLabelName("1st"))
+}
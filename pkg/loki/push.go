@@ -0,0 +1,65 @@
+package loki
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/protowire"
+	"github.com/golang/snappy"
+)
+
+// encode returns the push request body for the batch and its content type
+func encode(format string, b *batch) ([]byte, string, error) {
+	if format == JSONFormat {
+		body, err := encodeJSON(b)
+		return body, "application/json", err
+	}
+	return encodeProtobuf(b), "application/x-protobuf", nil
+}
+
+type jsonPushRequest struct {
+	Streams []jsonStream `json:"streams"`
+}
+
+type jsonStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// encodeJSON encodes the batch as a JSON push request
+func encodeJSON(b *batch) ([]byte, error) {
+	req := jsonPushRequest{Streams: make([]jsonStream, 0, len(b.order))}
+	for _, s := range b.order {
+		js := jsonStream{
+			Stream: s.labels.labels,
+			Values: make([][2]string, 0, len(s.entries)),
+		}
+		for _, e := range s.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(e.timestamp.UnixNano(), 10), e.line})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// encodeProtobuf encodes the batch as a snappy compressed protobuf push
+// request. The messages are simple enough to be encoded by hand:
+//
+//	message PushRequest { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func encodeProtobuf(b *batch) []byte {
+	var req, st, en, ts []byte
+	for _, s := range b.order {
+		st = protowire.AppendBytesField(st[:0], 1, []byte(s.labels.key))
+		for _, e := range s.entries {
+			ts = protowire.AppendVarintField(ts[:0], 1, uint64(e.timestamp.Unix()))
+			ts = protowire.AppendVarintField(ts, 2, uint64(e.timestamp.Nanosecond()))
+			en = protowire.AppendBytesField(en[:0], 1, ts)
+			en = protowire.AppendBytesField(en, 2, []byte(e.line))
+			st = protowire.AppendBytesField(st, 2, en)
+		}
+		req = protowire.AppendBytesField(req, 1, st)
+	}
+	return snappy.Encode(nil, req)
+}
@@ -13,6 +13,9 @@ func TestBlueprint(t *testing.T) {
 		"labels":              "foo",
 		"max-size":            "20",
 		"awslogs-group":       "foo",
+		"fluentd-address":     "tcp://127.0.0.1:24224",
+		"fluentd-tag":         "docker.{{.Name}}",
+		"fluentd-env":         "STAGE",
 		"gcp-project":         "foobar",
 		"gcp-labels":          "bar",
 		"gelf-address":        "tcp://127.0.0.1:1234",
@@ -41,6 +44,16 @@ func TestBlueprint(t *testing.T) {
 		}, cfg)
 	})
 
+	t.Run("Fluentd Blueprint", func(t *testing.T) {
+		cfg, err := FluentdBlueprint.Config(globalcfg)
+		assert.Nil(err)
+		assert.Equal(map[string]string{
+			"fluentd-address": "tcp://127.0.0.1:24224",
+			"tag":             "docker.{{.Name}}",
+			"env":             "STAGE",
+		}, cfg)
+	})
+
 	t.Run("GCPLogs Blueprint Blueprint", func(t *testing.T) {
 		cfg, err := GCPLogsBlueprint.Config(globalcfg)
 		assert.Nil(err)
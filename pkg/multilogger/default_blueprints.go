@@ -2,6 +2,18 @@ package multilogger
 
 import (
 	"github.com/allgdante/docker-multilogger-plugin/internal/jsonfilelog"
+	"github.com/allgdante/docker-multilogger-plugin/internal/local"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/console"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/elasticsearch"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/external"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/filelog"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/httplog"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/kafka"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/loki"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/natslog"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/otlp"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/redislog"
+	"github.com/allgdante/docker-multilogger-plugin/pkg/s3archive"
 	"github.com/allgdante/docker-multilogger-plugin/pkg/syslog5424"
 
 	"github.com/docker/docker/daemon/logger/awslogs"
@@ -33,6 +45,19 @@ var (
 		jsonfilelog.ValidateLogOpt,
 	}
 
+	// LocalBlueprint is the blueprint for our customized local driver
+	LocalBlueprint = Blueprint{
+		"local",
+		[]string{
+			"local-max-size",
+			"local-max-file",
+			"local-compress",
+			"local-log-dir",
+		},
+		local.New,
+		local.ValidateLogOpt,
+	}
+
 	// AWSLogsBlueprint is the blueprint for the original awslogs docker driver
 	AWSLogsBlueprint = Blueprint{
 		"awslogs",
@@ -191,13 +216,35 @@ var (
 			syslog5424.AddressKey,
 			syslog5424.FacilityKey,
 			syslog5424.TimeFormatKey,
+			syslog5424.TimeUTCKey,
 			syslog5424.TLSCACertKey,
 			syslog5424.TLSCertKey,
 			syslog5424.TLSKeyKey,
 			syslog5424.TLSSkipVerifyKey,
+			syslog5424.TLSMinVersionKey,
+			syslog5424.TLSCiphersKey,
+			syslog5424.TLSServerNameKey,
+			syslog5424.TLSPinKey,
 			syslog5424.HostnameKey,
 			syslog5424.MSGIDKey,
+			syslog5424.MSGIDRegexKey,
+			syslog5424.AppNameKey,
+			syslog5424.ProcIDKey,
 			syslog5424.DisableFramerKey,
+			syslog5424.AsyncKey,
+			syslog5424.BufferSizeKey,
+			syslog5424.ConnectOptKey,
+			syslog5424.ReconnectMaxKey,
+			syslog5424.DialTimeoutKey,
+			syslog5424.WriteTimeoutKey,
+			syslog5424.KeepAliveKey,
+			syslog5424.BalanceKey,
+			syslog5424.MaxLifetimeKey,
+			syslog5424.ResolveKey,
+			syslog5424.RELPWindowKey,
+			syslog5424.LocalSocketKey,
+			syslog5424.MaxMsgSizeKey,
+			syslog5424.MaxMsgModeKey,
 			syslog5424.DriverName + "-" + syslog5424.LabelsKey,
 			syslog5424.DriverName + "-" + syslog5424.LabelsRegexKey,
 			syslog5424.DriverName + "-" + syslog5424.EnvKey,
@@ -208,11 +255,286 @@ var (
 		syslog5424.ValidateLogOpt,
 	}
 
+	// LokiBlueprint is the blueprint for our own loki driver
+	LokiBlueprint = Blueprint{
+		loki.DriverName,
+		[]string{
+			loki.URLKey,
+			loki.TenantIDKey,
+			loki.UsernameKey,
+			loki.PasswordKey,
+			loki.FormatKey,
+			loki.StreamLabelsKey,
+			loki.ExternalLabelsKey,
+			loki.BatchSizeKey,
+			loki.BatchWaitKey,
+			loki.RetriesKey,
+			loki.MinBackoffKey,
+			loki.MaxBackoffKey,
+			loki.TimeoutKey,
+			loki.DriverName + "-" + loki.LabelsKey,
+			loki.DriverName + "-" + loki.LabelsRegexKey,
+			loki.DriverName + "-" + loki.EnvKey,
+			loki.DriverName + "-" + loki.EnvRegexKey,
+		},
+		loki.New,
+		loki.ValidateLogOpt,
+	}
+
+	// ElasticsearchBlueprint is the blueprint for our own elasticsearch driver
+	ElasticsearchBlueprint = Blueprint{
+		elasticsearch.DriverName,
+		[]string{
+			elasticsearch.URLKey,
+			elasticsearch.IndexKey,
+			elasticsearch.PipelineKey,
+			elasticsearch.UsernameKey,
+			elasticsearch.PasswordKey,
+			elasticsearch.APIKeyKey,
+			elasticsearch.GzipKey,
+			elasticsearch.BulkSizeKey,
+			elasticsearch.FlushIntervalKey,
+			elasticsearch.RetriesKey,
+			elasticsearch.TimeoutKey,
+			elasticsearch.DeadLetterIndexKey,
+			elasticsearch.ActionKey,
+			elasticsearch.DriverName + "-" + elasticsearch.LabelsKey,
+			elasticsearch.DriverName + "-" + elasticsearch.LabelsRegexKey,
+			elasticsearch.DriverName + "-" + elasticsearch.EnvKey,
+			elasticsearch.DriverName + "-" + elasticsearch.EnvRegexKey,
+		},
+		elasticsearch.New,
+		elasticsearch.ValidateLogOpt,
+	}
+
+	// OTLPBlueprint is the blueprint for our own otlp driver
+	OTLPBlueprint = Blueprint{
+		otlp.DriverName,
+		[]string{
+			otlp.EndpointKey,
+			otlp.ProtocolKey,
+			otlp.HeadersKey,
+			otlp.ResourceAttrsKey,
+			otlp.BatchSizeKey,
+			otlp.BatchWaitKey,
+			otlp.RetriesKey,
+			otlp.TimeoutKey,
+			otlp.TLSCACertKey,
+			otlp.TLSCertKey,
+			otlp.TLSKeyKey,
+			otlp.TLSSkipVerifyKey,
+			otlp.DriverName + "-" + otlp.LabelsKey,
+			otlp.DriverName + "-" + otlp.LabelsRegexKey,
+			otlp.DriverName + "-" + otlp.EnvKey,
+			otlp.DriverName + "-" + otlp.EnvRegexKey,
+		},
+		otlp.New,
+		otlp.ValidateLogOpt,
+	}
+
+	// KafkaBlueprint is the blueprint for our own kafka driver
+	KafkaBlueprint = Blueprint{
+		kafka.DriverName,
+		[]string{
+			kafka.BrokersKey,
+			kafka.TopicKey,
+			kafka.KeyKey,
+			kafka.FormatKey,
+			kafka.CompressionKey,
+			kafka.AcksKey,
+			kafka.BatchSizeKey,
+			kafka.BatchWaitKey,
+			kafka.RetriesKey,
+			kafka.VersionKey,
+			kafka.SASLMechanismKey,
+			kafka.SASLUsernameKey,
+			kafka.SASLPasswordKey,
+			kafka.TLSKey,
+			kafka.TLSCACertKey,
+			kafka.TLSCertKey,
+			kafka.TLSKeyKey,
+			kafka.TLSSkipVerifyKey,
+			kafka.DriverName + "-" + kafka.LabelsKey,
+			kafka.DriverName + "-" + kafka.LabelsRegexKey,
+			kafka.DriverName + "-" + kafka.EnvKey,
+			kafka.DriverName + "-" + kafka.EnvRegexKey,
+		},
+		kafka.New,
+		kafka.ValidateLogOpt,
+	}
+
+	// HTTPBlueprint is the blueprint for our own http driver
+	HTTPBlueprint = Blueprint{
+		httplog.DriverName,
+		[]string{
+			httplog.URLKey,
+			httplog.MethodKey,
+			httplog.HeadersKey,
+			httplog.FormatKey,
+			httplog.TemplateKey,
+			httplog.ContentTypeKey,
+			httplog.BatchCountKey,
+			httplog.BatchSizeKey,
+			httplog.BatchWaitKey,
+			httplog.GzipKey,
+			httplog.RetriesKey,
+			httplog.TimeoutKey,
+			httplog.BearerTokenKey,
+			httplog.UsernameKey,
+			httplog.PasswordKey,
+			httplog.DriverName + "-" + httplog.LabelsKey,
+			httplog.DriverName + "-" + httplog.LabelsRegexKey,
+			httplog.DriverName + "-" + httplog.EnvKey,
+			httplog.DriverName + "-" + httplog.EnvRegexKey,
+		},
+		httplog.New,
+		httplog.ValidateLogOpt,
+	}
+
+	// FileBlueprint is the blueprint for our own file driver
+	FileBlueprint = Blueprint{
+		filelog.DriverName,
+		[]string{
+			filelog.PathKey,
+			filelog.FormatKey,
+			filelog.TemplateKey,
+			filelog.MaxSizeKey,
+			filelog.RotateIntervalKey,
+			filelog.CompressKey,
+			filelog.MaxFilesKey,
+			filelog.MaxAgeKey,
+			filelog.DriverName + "-" + filelog.LabelsKey,
+			filelog.DriverName + "-" + filelog.LabelsRegexKey,
+			filelog.DriverName + "-" + filelog.EnvKey,
+			filelog.DriverName + "-" + filelog.EnvRegexKey,
+		},
+		filelog.New,
+		filelog.ValidateLogOpt,
+	}
+
+	// S3ArchiveBlueprint is the blueprint for our own s3archive driver
+	S3ArchiveBlueprint = Blueprint{
+		s3archive.DriverName,
+		[]string{
+			s3archive.EndpointKey,
+			s3archive.RegionKey,
+			s3archive.BucketKey,
+			s3archive.PrefixKey,
+			s3archive.AccessKeyIDKey,
+			s3archive.SecretAccessKeyKey,
+			s3archive.PathStyleKey,
+			s3archive.ChunkSizeKey,
+			s3archive.ChunkAgeKey,
+			s3archive.BufferDirKey,
+			s3archive.TimeoutKey,
+			s3archive.DriverName + "-" + s3archive.LabelsKey,
+			s3archive.DriverName + "-" + s3archive.LabelsRegexKey,
+			s3archive.DriverName + "-" + s3archive.EnvKey,
+			s3archive.DriverName + "-" + s3archive.EnvRegexKey,
+		},
+		s3archive.New,
+		s3archive.ValidateLogOpt,
+	}
+
+	// NATSBlueprint is the blueprint for our own nats driver
+	NATSBlueprint = Blueprint{
+		natslog.DriverName,
+		[]string{
+			natslog.URLKey,
+			natslog.SubjectKey,
+			natslog.FormatKey,
+			natslog.JetStreamKey,
+			natslog.StreamKey,
+			natslog.AckWaitKey,
+			natslog.CredsKey,
+			natslog.NKeyKey,
+			natslog.ReconnectBufferKey,
+			natslog.ReconnectWaitKey,
+			natslog.TLSKey,
+			natslog.TLSCACertKey,
+			natslog.TLSCertKey,
+			natslog.TLSKeyKey,
+			natslog.TLSSkipVerifyKey,
+			natslog.DriverName + "-" + natslog.LabelsKey,
+			natslog.DriverName + "-" + natslog.LabelsRegexKey,
+			natslog.DriverName + "-" + natslog.EnvKey,
+			natslog.DriverName + "-" + natslog.EnvRegexKey,
+		},
+		natslog.New,
+		natslog.ValidateLogOpt,
+	}
+
+	// RedisBlueprint is the blueprint for our own redis driver
+	RedisBlueprint = Blueprint{
+		redislog.DriverName,
+		[]string{
+			redislog.AddressKey,
+			redislog.KeyKey,
+			redislog.DBKey,
+			redislog.UsernameKey,
+			redislog.PasswordKey,
+			redislog.MaxLenKey,
+			redislog.ApproximateKey,
+			redislog.BatchSizeKey,
+			redislog.BatchWaitKey,
+			redislog.RetriesKey,
+			redislog.TimeoutKey,
+			redislog.TLSKey,
+			redislog.TLSCACertKey,
+			redislog.TLSCertKey,
+			redislog.TLSKeyKey,
+			redislog.TLSSkipVerifyKey,
+			redislog.DriverName + "-" + redislog.LabelsKey,
+			redislog.DriverName + "-" + redislog.LabelsRegexKey,
+			redislog.DriverName + "-" + redislog.EnvKey,
+			redislog.DriverName + "-" + redislog.EnvRegexKey,
+		},
+		redislog.New,
+		redislog.ValidateLogOpt,
+	}
+
+	// ConsoleBlueprint is the blueprint for our own console driver
+	ConsoleBlueprint = Blueprint{
+		console.DriverName,
+		[]string{
+			console.OutputKey,
+			console.FormatKey,
+			console.RateKey,
+			console.BurstKey,
+			console.DriverName + "-" + console.LabelsKey,
+			console.DriverName + "-" + console.LabelsRegexKey,
+			console.DriverName + "-" + console.EnvKey,
+			console.DriverName + "-" + console.EnvRegexKey,
+		},
+		console.New,
+		console.ValidateLogOpt,
+	}
+
+	// ExternalBlueprint is the blueprint for our own external driver
+	ExternalBlueprint = Blueprint{
+		external.DriverName,
+		[]string{
+			external.AddressKey,
+			external.ModeKey,
+			external.MaxBufferKey,
+			external.TimeoutKey,
+			external.DriverName + "-" + external.LabelsKey,
+			external.DriverName + "-" + external.LabelsRegexKey,
+			external.DriverName + "-" + external.EnvKey,
+			external.DriverName + "-" + external.EnvRegexKey,
+		},
+		external.New,
+		external.ValidateLogOpt,
+	}
+
 	// DefaultBlueprints represents the builtin docker log drivers with our
-	// custom syslog5424 driver
+	// custom syslog5424, loki, elasticsearch, otlp, kafka, http, file,
+	// s3archive, nats, redis, console and external drivers
 	DefaultBlueprints = []Blueprint{
 		JSONFileLogBlueprint,
+		LocalBlueprint,
 		AWSLogsBlueprint,
+		FluentdBlueprint,
 		GCPLogsBlueprint,
 		GelfBlueprint,
 		JournaldBlueprint,
@@ -220,5 +542,23 @@ var (
 		SplunkBlueprint,
 		SyslogBlueprint,
 		Syslog5424Blueprint,
+		LokiBlueprint,
+		ElasticsearchBlueprint,
+		OTLPBlueprint,
+		KafkaBlueprint,
+		HTTPBlueprint,
+		FileBlueprint,
+		S3ArchiveBlueprint,
+		NATSBlueprint,
+		RedisBlueprint,
+		ConsoleBlueprint,
+		ExternalBlueprint,
 	}
 )
+
+// ExecBlueprint returns the blueprint of a driver which runs the command for
+// every container, writing the logs to its standard input
+func ExecBlueprint(name string, command ...string) Blueprint {
+	create, validate := external.NewExec(name, command)
+	return Blueprint{name, external.ExecOptions(name), create, validate}
+}
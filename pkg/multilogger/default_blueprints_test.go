@@ -0,0 +1,103 @@
+package multilogger
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// startForwardServer runs a minimal fluentd forward protocol server, which
+// decodes every message it receives and sends it to the returned channel.
+func startForwardServer(t *testing.T) (string, <-chan []interface{}) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	messages := make(chan []interface{}, 10)
+	go func() {
+		defer l.Close()
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		r := msgp.NewReader(c)
+		for {
+			v, err := r.ReadIntf()
+			if err != nil {
+				close(messages)
+				return
+			}
+			if msg, ok := v.([]interface{}); ok {
+				messages <- msg
+			}
+		}
+	}()
+	return l.Addr().String(), messages
+}
+
+func TestFluentdBlueprint(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	addr, messages := startForwardServer(t)
+
+	info := logger.Info{
+		ContainerID:     "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		ContainerName:   "/web",
+		ContainerLabels: map[string]string{"team": "core", "other": "ignored"},
+		ContainerEnv:    []string{"STAGE=prod", "SECRET=ignored"},
+		Config: map[string]string{
+			"fluentd-enabled": "true",
+			"fluentd-address": "tcp://" + addr,
+			"fluentd-tag":     "docker.{{.Name}}",
+			"fluentd-labels":  "team",
+			"fluentd-env":     "STAGE",
+		},
+	}
+
+	require.Nil(Validator(DefaultBlueprints)(info.Config))
+
+	l, err := Creator(DefaultBlueprints)(info)
+	require.Nil(err)
+	defer l.Close()
+
+	ml, ok := l.(*multiLogger)
+	require.True(ok)
+	require.Len(ml.loggers, 1)
+	require.Equal("fluentd", ml.loggers[0].Name())
+
+	timestamp := time.Unix(1577934245, 0)
+	msg := logger.NewMessage()
+	msg.Line = []byte("hello")
+	msg.Source = "stdout"
+	msg.Timestamp = timestamp
+	require.Nil(l.Log(msg))
+
+	var forwarded []interface{}
+	select {
+	case forwarded = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the fluentd message")
+	}
+
+	// [tag, time, record, option]
+	require.True(len(forwarded) >= 3, "unexpected message %v", forwarded)
+	assert.Equal("docker.web", forwarded[0])
+	assert.EqualValues(timestamp.Unix(), forwarded[1])
+	assert.Equal(map[string]interface{}{
+		"container_id":   info.ContainerID,
+		"container_name": "/web",
+		"source":         "stdout",
+		"log":            "hello",
+		"team":           "core",
+		"STAGE":          "prod",
+	}, forwarded[2])
+}
@@ -49,7 +49,6 @@ func (ml *multiLogger) Log(origmsg *logger.Message) (err error) {
 			}
 			if lerr := l.Log(msg); lerr != nil {
 				err = multierror.Append(err, fmt.Errorf("%s: %w", l.Name(), lerr))
-				fmt.Println(lerr.Error())
 			}
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/daemon/logger"
 	"github.com/stretchr/testify/assert"
@@ -45,3 +46,50 @@ func TestAddedJSONFileDriverIfNeeded(t *testing.T) {
 	assert.Equal(1, len(ml.loggers))
 	require.Equal("json-file", ml.loggers[0].Name())
 }
+
+func TestReadLogsFromLocalDriver(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	logDir, err := ioutil.TempDir("", "xxxx")
+	require.Nil(err)
+	defer os.RemoveAll(logDir)
+
+	var info logger.Info
+	info.ContainerID = "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e"
+	info.Config = map[string]string{
+		"local-enabled": "true",
+		"local-log-dir": logDir,
+	}
+
+	l, err := Creator(DefaultBlueprints)(info)
+	require.Nil(err)
+	defer l.Close()
+
+	ml, ok := l.(*multiLogger)
+	require.True(ok)
+	require.Equal(1, len(ml.loggers), "json-file shouldn't be added")
+	require.Equal("local", ml.loggers[0].Name())
+
+	msg := logger.NewMessage()
+	msg.Line = []byte("hello")
+	msg.Source = "stdout"
+	msg.Timestamp = time.Now()
+	require.Nil(l.Log(msg))
+
+	watcher := ml.ReadLogs(logger.ReadConfig{Tail: -1})
+	require.NotNil(watcher, "should read logs from the local driver")
+	defer watcher.ConsumerGone()
+
+	select {
+	case msg := <-watcher.Msg:
+		require.NotNil(msg)
+		assert.Equal("hello\n", string(msg.Line))
+	case err := <-watcher.Err:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout reading logs")
+	}
+}
@@ -0,0 +1,254 @@
+package multilogger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Registry holds the blueprints available to the multilogger driver, and
+// which of them are enabled. Registered blueprints are enabled by default.
+type Registry struct {
+	mu         sync.RWMutex
+	blueprints []Blueprint
+	disabled   map[string]bool
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{disabled: make(map[string]bool)}
+}
+
+// Register adds a blueprint to the registry, failing if there's already a
+// blueprint with the same name
+func (r *Registry) Register(b Blueprint) error {
+	switch {
+	case b.Name == "":
+		return fmt.Errorf("blueprint name can't be empty")
+	case b.Name == DriverName:
+		return fmt.Errorf("blueprint name %q is reserved", b.Name)
+	case b.Create == nil || b.Validate == nil:
+		return fmt.Errorf("blueprint %q must have a creator and a validator", b.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.lookup(b.Name); ok {
+		return fmt.Errorf("blueprint %q is already registered", b.Name)
+	}
+	r.blueprints = append(r.blueprints, b)
+	return nil
+}
+
+// Lookup returns the blueprint registered with the given name, whether it's
+// enabled or not
+func (r *Registry) Lookup(name string) (Blueprint, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lookup(name)
+}
+
+// lookup must be called with the lock held
+func (r *Registry) lookup(name string) (Blueprint, bool) {
+	for _, b := range r.blueprints {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Blueprint{}, false
+}
+
+// Enable enables the given blueprints
+func (r *Registry) Enable(names ...string) error {
+	return r.setDisabled(false, names)
+}
+
+// Disable disables the given blueprints
+func (r *Registry) Disable(names ...string) error {
+	return r.setDisabled(true, names)
+}
+
+func (r *Registry) setDisabled(disabled bool, names []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkNames(names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		r.disabled[name] = disabled
+	}
+	return nil
+}
+
+// EnableOnly enables the given blueprints and disables the rest
+func (r *Registry) EnableOnly(names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkNames(names); err != nil {
+		return err
+	}
+	for _, b := range r.blueprints {
+		r.disabled[b.Name] = true
+	}
+	for _, name := range names {
+		r.disabled[name] = false
+	}
+	return nil
+}
+
+// checkNames fails if any of the names isn't registered. It must be called
+// with the lock held.
+func (r *Registry) checkNames(names []string) (err error) {
+	for _, name := range names {
+		if _, ok := r.lookup(name); !ok {
+			err = multierror.Append(err, fmt.Errorf("unknown blueprint %q", name))
+		}
+	}
+	return
+}
+
+// Blueprints returns the enabled blueprints in registration order
+func (r *Registry) Blueprints() []Blueprint {
+	enabled, _ := r.split()
+	return enabled
+}
+
+// split returns the enabled and disabled blueprints
+func (r *Registry) split() (enabled, disabled []Blueprint) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, b := range r.blueprints {
+		if r.disabled[b.Name] {
+			disabled = append(disabled, b)
+		} else {
+			enabled = append(enabled, b)
+		}
+	}
+	return
+}
+
+// Validator returns a logger.LogOptValidator like Validator, using the
+// blueprints enabled when it's called, which fails if the config enables a
+// disabled blueprint
+func (r *Registry) Validator() logger.LogOptValidator {
+	return func(cfg map[string]string) error {
+		enabled, disabled := r.split()
+		if err := checkDisabled(cfg, disabled); err != nil {
+			return err
+		}
+		return Validator(enabled)(cfg)
+	}
+}
+
+// Creator returns a logger.Creator like Creator, using the blueprints enabled
+// when it's called, which fails if the config enables a disabled blueprint
+func (r *Registry) Creator() logger.Creator {
+	return func(info logger.Info) (logger.Logger, error) {
+		enabled, disabled := r.split()
+		if err := checkDisabled(info.Config, disabled); err != nil {
+			return nil, err
+		}
+		return Creator(enabled)(info)
+	}
+}
+
+// checkDisabled fails if any of the disabled blueprints is enabled in the
+// config, so it isn't silently ignored
+func checkDisabled(cfg map[string]string, disabled []Blueprint) (err error) {
+	for _, b := range disabled {
+		if parseLogOptBoolean(cfg, b.EnabledKey()) {
+			err = multierror.Append(err, fmt.Errorf("%s: logging driver is disabled", b.Name))
+		}
+	}
+	return
+}
+
+// ParseDriverList parses a comma-separated list of blueprint names, like the
+// one in the MULTILOGGER_DRIVERS environment variable
+func ParseDriverList(list string) (names []string) {
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// ParseExecDrivers parses a semicolon-separated list of drivers running a
+// command, in form name=command args, like the one in the
+// MULTILOGGER_EXEC_DRIVERS environment variable
+func ParseExecDrivers(list string) (blueprints []Blueprint, err error) {
+	for _, driver := range strings.Split(list, ";") {
+		if driver = strings.TrimSpace(driver); driver == "" {
+			continue
+		}
+		parts := strings.SplitN(driver, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || len(strings.Fields(parts[1])) == 0 {
+			return nil, fmt.Errorf("invalid exec driver %q, use name=command", driver)
+		}
+		blueprints = append(blueprints, ExecBlueprint(strings.TrimSpace(parts[0]), strings.Fields(parts[1])...))
+	}
+	return
+}
+
+// defaultRegistry holds the DefaultBlueprints along with the blueprints
+// registered by the programs importing this package
+var defaultRegistry = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, b := range DefaultBlueprints {
+		if err := r.Register(b); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds a blueprint to the default registry
+func Register(b Blueprint) error {
+	return defaultRegistry.Register(b)
+}
+
+// Lookup returns a blueprint of the default registry
+func Lookup(name string) (Blueprint, bool) {
+	return defaultRegistry.Lookup(name)
+}
+
+// Enable enables blueprints of the default registry
+func Enable(names ...string) error {
+	return defaultRegistry.Enable(names...)
+}
+
+// Disable disables blueprints of the default registry
+func Disable(names ...string) error {
+	return defaultRegistry.Disable(names...)
+}
+
+// EnableOnly enables the given blueprints of the default registry and
+// disables the rest
+func EnableOnly(names ...string) error {
+	return defaultRegistry.EnableOnly(names...)
+}
+
+// Blueprints returns the enabled blueprints of the default registry
+func Blueprints() []Blueprint {
+	return defaultRegistry.Blueprints()
+}
+
+// DefaultValidator returns the validator of the default registry
+func DefaultValidator() logger.LogOptValidator {
+	return defaultRegistry.Validator()
+}
+
+// DefaultCreator returns the creator of the default registry
+func DefaultCreator() logger.Creator {
+	return defaultRegistry.Creator()
+}
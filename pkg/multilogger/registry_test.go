@@ -0,0 +1,153 @@
+package multilogger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLogger is a logger.Logger which only has a name
+type testLogger struct {
+	name string
+}
+
+func (l *testLogger) Log(msg *logger.Message) error {
+	logger.PutMessage(msg)
+	return nil
+}
+
+func (l *testLogger) Name() string {
+	return l.name
+}
+
+func (l *testLogger) Close() error {
+	return nil
+}
+
+func testBlueprint(name string) Blueprint {
+	return Blueprint{
+		name,
+		[]string{name + "-address"},
+		func(info logger.Info) (logger.Logger, error) {
+			return &testLogger{name}, nil
+		},
+		func(cfg map[string]string) error {
+			for key := range cfg {
+				if key != name+"-address" {
+					return fmt.Errorf("unknown log opt '%s'", key)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func names(blueprints []Blueprint) (names []string) {
+	for _, b := range blueprints {
+		names = append(names, b.Name)
+	}
+	return
+}
+
+func TestRegistry(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r := NewRegistry()
+	require.Nil(r.Register(testBlueprint("foo")))
+	require.Nil(r.Register(testBlueprint("bar")))
+	require.Nil(r.Register(testBlueprint("baz")))
+	assert.Equal([]string{"foo", "bar", "baz"}, names(r.Blueprints()))
+
+	assert.NotNil(r.Register(testBlueprint("foo")))
+	assert.NotNil(r.Register(testBlueprint("")))
+	assert.NotNil(r.Register(testBlueprint(DriverName)))
+	assert.NotNil(r.Register(Blueprint{Name: "qux"}))
+
+	b, ok := r.Lookup("bar")
+	assert.True(ok)
+	assert.Equal("bar", b.Name)
+	_, ok = r.Lookup("qux")
+	assert.False(ok)
+
+	require.Nil(r.Disable("bar"))
+	assert.Equal([]string{"foo", "baz"}, names(r.Blueprints()))
+	// disabled blueprints can still be looked up
+	_, ok = r.Lookup("bar")
+	assert.True(ok)
+
+	require.Nil(r.EnableOnly("bar", "baz"))
+	assert.Equal([]string{"bar", "baz"}, names(r.Blueprints()))
+
+	require.Nil(r.Enable("foo"))
+	assert.Equal([]string{"foo", "bar", "baz"}, names(r.Blueprints()))
+
+	assert.NotNil(r.Disable("foo", "qux"))
+	assert.NotNil(r.EnableOnly("qux"))
+	// nothing changes on errors
+	assert.Equal([]string{"foo", "bar", "baz"}, names(r.Blueprints()))
+}
+
+func TestRegistryDisabledDriver(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r := NewRegistry()
+	require.Nil(r.Register(testBlueprint("foo")))
+	require.Nil(r.Register(testBlueprint("bar")))
+	require.Nil(r.Disable("bar"))
+
+	info := logger.Info{
+		ContainerID: "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		Config: map[string]string{
+			"foo-enabled": "true",
+			"foo-address": "localhost",
+		},
+	}
+	validate := r.Validator()
+	require.Nil(validate(info.Config))
+	l, err := r.Creator()(info)
+	require.Nil(err)
+	require.Len(l.(*multiLogger).loggers, 1)
+	assert.Equal("foo", l.(*multiLogger).loggers[0].Name())
+	require.Nil(l.Close())
+
+	info.Config["bar-enabled"] = "true"
+	assert.NotNil(r.Validator()(info.Config))
+	_, err = r.Creator()(info)
+	assert.NotNil(err)
+
+	// changes are used by the existing validators and creators
+	require.Nil(r.Enable("bar"))
+	assert.Nil(validate(info.Config))
+}
+
+func TestParseDriverList(t *testing.T) {
+	assert.Equal(t, []string{"json-file", "syslog5424"}, ParseDriverList("json-file, syslog5424,"))
+	assert.Empty(t, ParseDriverList(""))
+}
+
+func TestParseExecDrivers(t *testing.T) {
+	blueprints, err := ParseExecDrivers("audit=/usr/bin/audit-logger --verbose; metrics=/usr/bin/metrics;")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"audit", "metrics"}, names(blueprints))
+	assert.Contains(t, blueprints[0].Options, "audit-mode")
+
+	for _, list := range []string{"audit", "audit=", "=/usr/bin/audit-logger"} {
+		_, err := ParseExecDrivers(list)
+		assert.NotNil(t, err, list)
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	assert.Equal(t, names(DefaultBlueprints), names(Blueprints()))
+	_, ok := Lookup(JSONFileLogBlueprint.Name)
+	assert.True(t, ok)
+}
@@ -0,0 +1,467 @@
+// Package natslog provides a log driver for publishing container logs to NATS
+// subjects, optionally through JetStream.
+package natslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/templates"
+	"github.com/docker/docker/errdefs"
+	units "github.com/docker/go-units"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+// Driver name & available keys
+const (
+	DriverName         = "nats"
+	URLKey             = DriverName + "-url"
+	SubjectKey         = DriverName + "-subject"
+	FormatKey          = DriverName + "-format"
+	JetStreamKey       = DriverName + "-jetstream"
+	StreamKey          = DriverName + "-stream"
+	AckWaitKey         = DriverName + "-ack-wait"
+	CredsKey           = DriverName + "-creds"
+	NKeyKey            = DriverName + "-nkey"
+	ReconnectBufferKey = DriverName + "-reconnect-buffer"
+	ReconnectWaitKey   = DriverName + "-reconnect-wait"
+	TLSKey             = DriverName + "-tls"
+	TLSCACertKey       = DriverName + "-tls-ca-cert"
+	TLSCertKey         = DriverName + "-tls-cert"
+	TLSKeyKey          = DriverName + "-tls-key"
+	TLSSkipVerifyKey   = DriverName + "-tls-skip-verify"
+	EnvKey             = "env"
+	EnvRegexKey        = "env-regex"
+	LabelsKey          = "labels"
+	LabelsRegexKey     = "labels-regex"
+)
+
+// Available message formats
+const (
+	JSONFormat = "json"
+	RawFormat  = "raw"
+)
+
+// Headers set on every message
+const (
+	StreamHeader      = "Docker-Stream"
+	TimestampHeader   = "Docker-Timestamp"
+	ContainerIDHeader = "Docker-Container-Id"
+)
+
+const (
+	clientName = "docker-multilogger"
+
+	defaultAckWait         = 5 * time.Second
+	defaultReconnectBuffer = 8 * 1024 * 1024
+	defaultReconnectWait   = 2 * time.Second
+)
+
+var (
+	// NATS subjects are dot separated tokens without whitespace, where the
+	// wildcards can't be used for publishing
+	validSubject = regexp.MustCompile(`^[^\s.*>]+(\.[^\s.*>]+)*$`)
+
+	// errLoggerClosed is returned when logging after closing the logger
+	errLoggerClosed = errors.New("nats: logger is closed")
+)
+
+type natsLogger struct {
+	conn        *nats.Conn
+	js          nats.JetStreamContext
+	pubOpts     []nats.PubOpt
+	ackWait     time.Duration
+	subject     string
+	containerID string
+	raw         bool
+	// fields added to every JSON message
+	fields map[string]interface{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	// The client can't publish messages with headers until the server INFO
+	// says it supports them, so they are buffered here until the first
+	// connection, up to the reconnect buffer size.
+	pendingMu   sync.Mutex
+	connected   bool
+	pending     []*nats.Msg
+	pendingSize int64
+	maxPending  int64
+}
+
+// New creates a nats logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := parseSubject(info, cfg.subject)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &natsLogger{
+		ackWait:     cfg.ackWait,
+		subject:     subject,
+		containerID: info.ContainerID,
+		raw:         cfg.format == RawFormat,
+		maxPending:  cfg.reconnectBuffer,
+	}
+	if !l.raw {
+		if l.fields, err = loggerutil.ContainerFields(info); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.connect(cfg); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// connect connects to the servers, retrying in the background. The pending
+// lock is held until the logger is set up, as the connected handler may
+// publish the buffered messages right away.
+func (l *natsLogger) connect(cfg config) error {
+	opts, err := connectOptions(cfg, l.flushPending)
+	if err != nil {
+		return err
+	}
+
+	l.pendingMu.Lock()
+	defer l.pendingMu.Unlock()
+
+	// the connection is retried in the background, buffering the messages
+	if l.conn, err = nats.Connect(cfg.url, opts...); err != nil {
+		return err
+	}
+
+	if cfg.jetStream {
+		l.js, err = l.conn.JetStream(nats.PublishAsyncErrHandler(func(_ nats.JetStream, msg *nats.Msg, err error) {
+			logrus.WithError(err).WithField("subject", msg.Subject).Error("nats: message not acknowledged")
+		}))
+		if err != nil {
+			l.conn.Close()
+			return err
+		}
+		if cfg.stream != "" {
+			l.pubOpts = append(l.pubOpts, nats.ExpectStream(cfg.stream))
+		}
+	}
+
+	// the handler isn't called if the first connection succeeded
+	l.connected = l.conn.HeadersSupported()
+	return nil
+}
+
+// connectOptions returns the options of the connection, which is reconnected
+// forever. The connected handler is called on every connection, including
+// the first one when it's retried in the background.
+func connectOptions(cfg config, connected nats.ConnHandler) ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Name(clientName),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(cfg.reconnectWait),
+		nats.ReconnectBufSize(int(cfg.reconnectBuffer)),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			if err != nil {
+				logrus.WithError(err).WithField("url", nc.ConnectedUrl()).Warn("nats: disconnected, buffering messages")
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logrus.WithField("url", nc.ConnectedUrl()).Info("nats: reconnected")
+			connected(nc)
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			logrus.WithError(err).Error("nats: asynchronous error")
+		}),
+	}
+
+	if cfg.creds != "" {
+		opts = append(opts, nats.UserCredentials(cfg.creds))
+	}
+	if cfg.nkey != "" {
+		opt, err := nats.NkeyOptionFromSeed(cfg.nkey)
+		if err != nil {
+			return nil, errdefs.InvalidParameter(err)
+		}
+		opts = append(opts, opt)
+	}
+	if cfg.tls != nil {
+		opts = append(opts, nats.Secure(cfg.tls))
+	}
+	return opts, nil
+}
+
+func (l *natsLogger) Log(msg *logger.Message) error {
+	if len(msg.Line) == 0 {
+		logger.PutMessage(msg)
+		return nil
+	}
+
+	var data []byte
+	if l.raw {
+		// the line is copied, as the message is reused after returning it
+		data = append(data, msg.Line...)
+	} else {
+		fields := make(map[string]interface{}, len(l.fields)+3)
+		for k, v := range l.fields {
+			fields[k] = v
+		}
+		fields["timestamp"] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+		fields["message"] = string(msg.Line)
+		fields["source"] = msg.Source
+
+		var err error
+		if data, err = json.Marshal(fields); err != nil {
+			logger.PutMessage(msg)
+			return err
+		}
+	}
+
+	nm := nats.NewMsg(l.subject)
+	nm.Data = data
+	nm.Header.Set(StreamHeader, msg.Source)
+	nm.Header.Set(TimestampHeader, msg.Timestamp.UTC().Format(time.RFC3339Nano))
+	nm.Header.Set(ContainerIDHeader, l.containerID)
+	logger.PutMessage(msg)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return errLoggerClosed
+	}
+
+	if buffered, err := l.buffer(nm); buffered {
+		return err
+	}
+	return l.publish(nm)
+}
+
+func (l *natsLogger) publish(nm *nats.Msg) error {
+	if l.js != nil {
+		_, err := l.js.PublishMsgAsync(nm, l.pubOpts...)
+		return err
+	}
+	return l.conn.PublishMsg(nm)
+}
+
+// buffer keeps the message until the first connection, telling if it did.
+// The messages beyond the reconnect buffer size are rejected, like the
+// client does while reconnecting.
+func (l *natsLogger) buffer(nm *nats.Msg) (bool, error) {
+	l.pendingMu.Lock()
+	defer l.pendingMu.Unlock()
+	if l.connected {
+		return false, nil
+	}
+
+	size := int64(len(nm.Subject) + len(nm.Data))
+	if l.pendingSize+size > l.maxPending {
+		return true, nats.ErrReconnectBufExceeded
+	}
+	l.pending = append(l.pending, nm)
+	l.pendingSize += size
+	return true, nil
+}
+
+// flushPending publishes the messages buffered until the first connection,
+// once the server INFO is known.
+func (l *natsLogger) flushPending(_ *nats.Conn) {
+	l.pendingMu.Lock()
+	defer l.pendingMu.Unlock()
+	if l.connected {
+		return
+	}
+	l.connected = true
+
+	for _, nm := range l.pending {
+		if err := l.publish(nm); err != nil {
+			logrus.WithError(err).WithField("subject", nm.Subject).Error("nats: unable to publish buffered message")
+		}
+	}
+	l.pending, l.pendingSize = nil, 0
+}
+
+// Close waits until the pending messages are flushed, or acknowledged when
+// using JetStream, and closes the connection.
+func (l *natsLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	l.pendingMu.Lock()
+	if n := len(l.pending); n > 0 {
+		logrus.WithField("subject", l.subject).Errorf("nats: dropping %d messages, never connected to the server", n)
+	}
+	l.pending, l.connected = nil, true
+	l.pendingMu.Unlock()
+
+	if l.js != nil {
+		select {
+		case <-l.js.PublishAsyncComplete():
+		case <-time.After(l.ackWait):
+			logrus.WithField("subject", l.subject).Errorf("nats: %d messages not acknowledged on close", l.js.PublishAsyncPending())
+		}
+	} else if err := l.conn.FlushTimeout(l.ackWait); err != nil {
+		logrus.WithError(err).WithField("subject", l.subject).Error("nats: unable to flush messages on close")
+	}
+
+	l.conn.Close()
+	return nil
+}
+
+func (l *natsLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for nats specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case URLKey:
+		case SubjectKey:
+		case FormatKey:
+		case JetStreamKey:
+		case StreamKey:
+		case AckWaitKey:
+		case CredsKey:
+		case NKeyKey:
+		case ReconnectBufferKey:
+		case ReconnectWaitKey:
+		case TLSKey:
+		case TLSCACertKey:
+		case TLSCertKey:
+		case TLSKeyKey:
+		case TLSSkipVerifyKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for nats log driver", key)
+		}
+	}
+
+	c, err := parseConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := templates.NewParse("subject", c.subject); err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+	return nil
+}
+
+// config holds the parsed options
+type config struct {
+	url             string
+	subject         string
+	format          string
+	jetStream       bool
+	stream          string
+	ackWait         time.Duration
+	creds           string
+	nkey            string
+	reconnectBuffer int64
+	reconnectWait   time.Duration
+	tls             *tls.Config
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	var servers []string
+	for _, server := range strings.Split(cfg[URLKey], ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return c, errors.New("nats url is required")
+	}
+	c.url = strings.Join(servers, ",")
+
+	if c.subject = cfg[SubjectKey]; c.subject == "" {
+		return c, errors.New("nats subject is required")
+	}
+
+	switch c.format = cfg[FormatKey]; c.format {
+	case "":
+		c.format = JSONFormat
+	case JSONFormat, RawFormat:
+	default:
+		return c, fmt.Errorf("invalid nats format %q, use %s or %s", c.format, JSONFormat, RawFormat)
+	}
+
+	if c.jetStream, err = loggerutil.ParseBool(cfg, JetStreamKey); err != nil {
+		return
+	}
+	if c.stream = cfg[StreamKey]; c.stream != "" && !c.jetStream {
+		return c, errors.New("nats stream requires jetstream")
+	}
+	if c.ackWait, err = loggerutil.ParsePositiveDuration(cfg, AckWaitKey, defaultAckWait); err != nil {
+		return
+	}
+
+	c.creds, c.nkey = cfg[CredsKey], cfg[NKeyKey]
+	if c.creds != "" && c.nkey != "" {
+		return c, errors.New("nats credentials file and nkey can't be used together")
+	}
+
+	c.reconnectBuffer = defaultReconnectBuffer
+	if v := cfg[ReconnectBufferKey]; v != "" {
+		if c.reconnectBuffer, err = units.RAMInBytes(v); err != nil {
+			return c, errdefs.InvalidParameter(err)
+		}
+		if c.reconnectBuffer <= 0 {
+			return c, fmt.Errorf("%s must be a positive size", ReconnectBufferKey)
+		}
+	}
+	if c.reconnectWait, err = loggerutil.ParsePositiveDuration(cfg, ReconnectWaitKey, defaultReconnectWait); err != nil {
+		return
+	}
+
+	if c.tls, err = loggerutil.ParseTLS(cfg, loggerutil.TLSKeys{
+		Enable:     TLSKey,
+		CACert:     TLSCACertKey,
+		Cert:       TLSCertKey,
+		Key:        TLSKeyKey,
+		SkipVerify: TLSSkipVerifyKey,
+	}); err != nil {
+		return
+	}
+	return c, nil
+}
+
+// parseSubject renders the subject template using the container info
+func parseSubject(info logger.Info, subject string) (string, error) {
+	tmpl, err := templates.NewParse("subject", subject)
+	if err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, &info); err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+
+	if !validSubject.MatchString(buf.String()) {
+		return "", errdefs.InvalidParameter(fmt.Errorf("invalid nats subject %q", buf.String()))
+	}
+	return buf.String(), nil
+}
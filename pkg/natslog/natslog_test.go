@@ -0,0 +1,312 @@
+package natslog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs"}, true},
+		{"full", map[string]string{
+			URLKey:             "tls://nats1:4222, tls://nats2:4222",
+			SubjectKey:         "logs.{{.Name}}",
+			FormatKey:          RawFormat,
+			JetStreamKey:       "true",
+			StreamKey:          "LOGS",
+			AckWaitKey:         "10s",
+			CredsKey:           "/etc/nats/user.creds",
+			ReconnectBufferKey: "16m",
+			ReconnectWaitKey:   "1s",
+			TLSKey:             "true",
+			TLSSkipVerifyKey:   "true",
+			LabelsKey:          "team",
+			EnvKey:             "STAGE",
+		}, true},
+		{"no url", map[string]string{SubjectKey: "logs"}, false},
+		{"no subject", map[string]string{URLKey: "nats://nats:4222"}, false},
+		{"unknown key", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs", "nats-foo": "bar"}, false},
+		{"invalid subject template", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs.{{.Name"}, false},
+		{"invalid format", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs", FormatKey: "xml"}, false},
+		{"invalid jetstream", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs", JetStreamKey: "maybe"}, false},
+		{"stream without jetstream", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs", StreamKey: "LOGS"}, false},
+		{"invalid ack wait", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs", AckWaitKey: "0s"}, false},
+		{"creds and nkey", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs", CredsKey: "user.creds", NKeyKey: "user.nk"}, false},
+		{"invalid reconnect buffer", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs", ReconnectBufferKey: "big"}, false},
+		{"tls cert without key", map[string]string{URLKey: "nats://nats:4222", SubjectKey: "logs", TLSKey: "true", TLSCertKey: "cert.pem"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestParseSubject(t *testing.T) {
+	info := logger.Info{
+		ContainerID:   "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		ContainerName: "/web",
+	}
+
+	subject, err := parseSubject(info, "logs.{{.Name}}.{{.ID}}")
+	require.Nil(t, err)
+	assert.Equal(t, "logs.web.7f0ebc7d0b9a", subject)
+
+	for _, invalid := range []string{"", "logs.*", "logs.>", "logs..web", "logs.{{.Name}} app"} {
+		_, err := parseSubject(info, invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+// runServer runs a NATS server on the given port, or a random one if -1, with
+// JetStream enabled if there is a store dir. The server must be shut down by
+// the caller.
+func runServer(t *testing.T, port int, storeDir string) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      port,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: storeDir != "",
+		StoreDir:  storeDir,
+	})
+	require.Nil(t, err)
+	go s.Start()
+	require.True(t, s.ReadyForConnections(5*time.Second))
+	return s
+}
+
+// ts is the timestamp of the logged messages
+var ts = time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+func assertHeaders(t *testing.T, header nats.Header) {
+	assert.Equal(t, "stdout", header.Get(StreamHeader))
+	assert.Equal(t, "2020-01-02T03:04:05Z", header.Get(TimestampHeader))
+	assert.Equal(t, loggertest.ContainerID, header.Get(ContainerIDHeader))
+}
+
+func TestPublish(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	s := runServer(t, -1, "")
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	require.Nil(err)
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("logs.>")
+	require.Nil(err)
+	require.Nil(nc.Flush())
+
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:     s.ClientURL(),
+		SubjectKey: "logs.{{.Name}}",
+	})
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	require.Nil(l.Close())
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	require.Nil(err)
+	assert.Equal("logs.web", msg.Subject)
+	assertHeaders(t, msg.Header)
+
+	var fields map[string]interface{}
+	require.Nil(json.Unmarshal(msg.Data, &fields))
+	assert.Equal("hello", fields["message"])
+	assert.Equal("web", fields["container_name"])
+}
+
+func TestPublishJetStream(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir, err := ioutil.TempDir("", "natslog")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	s := runServer(t, -1, dir)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	require.Nil(err)
+	defer nc.Close()
+	js, err := nc.JetStream()
+	require.Nil(err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "LOGS", Subjects: []string{"logs.>"}})
+	require.Nil(err)
+
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:       s.ClientURL(),
+		SubjectKey:   "logs.{{.Name}}",
+		FormatKey:    RawFormat,
+		JetStreamKey: "true",
+		StreamKey:    "LOGS",
+	})
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	require.Nil(l.Close())
+
+	// the message is acknowledged when closing
+	msg, err := js.GetMsg("LOGS", 1)
+	require.Nil(err)
+	assert.Equal("logs.web", msg.Subject)
+	assert.Equal("hello", string(msg.Data))
+	assertHeaders(t, msg.Header)
+}
+
+func TestPublishBufferedWhileReconnecting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "natslog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// a fixed port, so the server can be restarted
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	require.Nil(t, ln.Close())
+
+	s := runServer(t, port, dir)
+	nc, err := nats.Connect(s.ClientURL())
+	require.Nil(t, err)
+	js, err := nc.JetStream()
+	require.Nil(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "LOGS", Subjects: []string{"logs.>"}})
+	require.Nil(t, err)
+	nc.Close()
+
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:           s.ClientURL(),
+		SubjectKey:       "logs.{{.Name}}",
+		FormatKey:        RawFormat,
+		JetStreamKey:     "true",
+		ReconnectWaitKey: "50ms",
+	})
+	loggertest.LogAt(t, l, "connected", "stdout", ts)
+	select {
+	case <-l.(*natsLogger).js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the acknowledgement")
+	}
+
+	// the message is buffered while the server is down, once the client
+	// notices it
+	s.Shutdown()
+	s.WaitForShutdown()
+	conn := l.(*natsLogger).conn
+	for i := 0; !conn.IsReconnecting(); i++ {
+		require.True(t, i < 100, "timeout waiting for the client to reconnect")
+		time.Sleep(10 * time.Millisecond)
+	}
+	loggertest.LogAt(t, l, "buffered", "stdout", ts)
+
+	s = runServer(t, port, dir)
+	defer s.Shutdown()
+	require.Nil(t, l.Close())
+
+	nc, err = nats.Connect(s.ClientURL())
+	require.Nil(t, err)
+	defer nc.Close()
+	js, err = nc.JetStream()
+	require.Nil(t, err)
+	for seq, expected := range []string{"connected", "buffered"} {
+		msg, err := js.GetMsg("LOGS", uint64(seq+1))
+		require.Nil(t, err)
+		assert.Equal(t, expected, string(msg.Data))
+	}
+}
+
+func TestPublishBufferedBeforeConnected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "natslog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// a fixed port, so the server can be started after the logger
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	require.Nil(t, ln.Close())
+
+	// the stream is kept in the store dir while the server is down
+	s := runServer(t, port, dir)
+	nc, err := nats.Connect(s.ClientURL())
+	require.Nil(t, err)
+	js, err := nc.JetStream()
+	require.Nil(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "LOGS", Subjects: []string{"logs.>"}})
+	require.Nil(t, err)
+	nc.Close()
+	url := s.ClientURL()
+	s.Shutdown()
+	s.WaitForShutdown()
+
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:           url,
+		SubjectKey:       "logs.{{.Name}}",
+		FormatKey:        RawFormat,
+		JetStreamKey:     "true",
+		ReconnectWaitKey: "50ms",
+	})
+	loggertest.LogAt(t, l, "early", "stdout", ts)
+
+	s = runServer(t, port, dir)
+	defer s.Shutdown()
+	for i := 0; !l.(*natsLogger).conn.IsConnected(); i++ {
+		require.True(t, i < 500, "timeout waiting for the client to connect")
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Nil(t, l.Close())
+
+	nc, err = nats.Connect(s.ClientURL())
+	require.Nil(t, err)
+	defer nc.Close()
+	js, err = nc.JetStream()
+	require.Nil(t, err)
+	msg, err := js.GetMsg("LOGS", 1)
+	require.Nil(t, err)
+	assert.Equal(t, "early", string(msg.Data))
+	assertHeaders(t, msg.Header)
+}
+
+func TestBufferBeforeConnectedIsBounded(t *testing.T) {
+	// nothing listens on the port, so the connection is retried
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	url := "nats://" + ln.Addr().String()
+	require.Nil(t, ln.Close())
+
+	l := loggertest.New(t, New, map[string]string{
+		URLKey:             url,
+		SubjectKey:         "logs",
+		FormatKey:          RawFormat,
+		AckWaitKey:         "50ms",
+		ReconnectBufferKey: "16",
+	})
+	defer l.Close()
+
+	loggertest.Log(t, l, "buffered")
+	msg := logger.NewMessage()
+	msg.Line = []byte("lost")
+	assert.Equal(t, nats.ErrReconnectBufExceeded, l.Log(msg))
+}
@@ -0,0 +1,76 @@
+package otlp
+
+import (
+	"context"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/batcher"
+	"github.com/sirupsen/logrus"
+)
+
+// record is a log record of the container
+type record struct {
+	timestamp time.Time
+	observed  time.Time
+	severity  int
+	source    string
+	body      string
+}
+
+// exporter sends records to the collector. If the export fails, it tells if
+// it could succeed later.
+type exporter interface {
+	export(ctx context.Context, res *resource, records []record) (retry bool, err error)
+	close() error
+}
+
+// client batches records and exports them from a background goroutine.
+type client struct {
+	cfg      config
+	resource *resource
+	exporter exporter
+	batcher  *batcher.Batcher
+}
+
+func newClient(cfg config, res *resource, exp exporter) *client {
+	c := &client{
+		cfg:      cfg,
+		resource: res,
+		exporter: exp,
+	}
+	c.batcher = batcher.New(batcher.Config{
+		Wait:     cfg.batchWait,
+		MaxItems: cfg.batchSize,
+	}, c.export)
+	return c
+}
+
+// push queues a record, blocking if the queue is full.
+func (c *client) push(r record) error {
+	return c.batcher.Push(r)
+}
+
+// close stops accepting records and waits until the queued ones are
+// exported, without retrying failed exports.
+func (c *client) close() error {
+	c.batcher.Close()
+	return c.exporter.close()
+}
+
+// export sends a batch, retrying with an exponential backoff the retryable
+// failures. The batch is dropped if it can't be exported.
+func (c *client) export(items []interface{}) {
+	records := make([]record, 0, len(items))
+	for _, item := range items {
+		records = append(records, item.(record))
+	}
+
+	err := c.batcher.Retry(c.cfg.retries, func() (bool, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), c.cfg.timeout)
+		defer cancel()
+		return c.exporter.export(ctx, c.resource, records)
+	})
+	if err != nil {
+		logrus.WithError(err).Errorf("otlp: dropping %d log records", len(records))
+	}
+}
@@ -0,0 +1,241 @@
+package otlp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/allgdante/docker-multilogger-plugin/internal/protowire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// collectorRequest is an export request received by a collector stand-in
+type collectorRequest struct {
+	path    string
+	headers map[string]string
+	body    []byte
+}
+
+// startHTTPCollector runs an OTLP/HTTP collector stand-in which replies with
+// the given status codes, in order, and then with 200. Every request is sent
+// to the returned channel. The server must be closed by the caller.
+func startHTTPCollector(t *testing.T, statuses ...int) (*httptest.Server, <-chan collectorRequest) {
+	var calls int32
+	requests := make(chan collectorRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+		requests <- collectorRequest{
+			path: r.URL.Path,
+			headers: map[string]string{
+				"content-type":  r.Header.Get("Content-Type"),
+				"authorization": r.Header.Get("Authorization"),
+			},
+			body: body,
+		}
+
+		if n := int(atomic.AddInt32(&calls, 1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	return srv, requests
+}
+
+// startGRPCCollector runs an OTLP/gRPC collector stand-in, which sends every
+// request to the returned channel. The server must be stopped by the caller.
+func startGRPCCollector(t *testing.T) (*grpc.Server, string, <-chan collectorRequest) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	requests := make(chan collectorRequest, 10)
+	srv := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			md, _ := metadata.FromIncomingContext(stream.Context())
+
+			var body []byte
+			if err := stream.RecvMsg(&body); err != nil {
+				return err
+			}
+			requests <- collectorRequest{
+				path:    method,
+				headers: map[string]string{"authorization": firstValue(md.Get("authorization"))},
+				body:    body,
+			}
+			return stream.SendMsg([]byte{})
+		}),
+	)
+	go srv.Serve(l)
+	return srv, l.Addr().String(), requests
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// protoFields decodes the fields of a protobuf message
+func protoFields(t *testing.T, b []byte) map[int][]interface{} {
+	fields, err := protowire.Fields(b)
+	require.Nil(t, err)
+	return fields
+}
+
+func protoString(v interface{}) string {
+	return string(v.([]byte))
+}
+
+// decodeKeyValue decodes a KeyValue holding a string
+func decodeKeyValue(t *testing.T, b []byte) (string, string) {
+	kv := protoFields(t, b)
+	value := protoFields(t, kv[2][0].([]byte))
+	return protoString(kv[1][0]), protoString(value[1][0])
+}
+
+// checkProtobufRequest checks the records of a protobuf encoded
+// ExportLogsServiceRequest
+func checkProtobufRequest(t *testing.T, body []byte, ts time.Time) {
+	assert := assert.New(t)
+
+	resourceLogs := protoFields(t, body)[1]
+	require.Len(t, resourceLogs, 1)
+	rl := protoFields(t, resourceLogs[0].([]byte))
+
+	attrs := make(map[string]string)
+	for _, kv := range protoFields(t, rl[1][0].([]byte))[1] {
+		k, v := decodeKeyValue(t, kv.([]byte))
+		attrs[k] = v
+	}
+	assert.Equal(loggertest.ContainerID, attrs["container.id"])
+	assert.Equal("web", attrs["container.name"])
+
+	scopeLogs := protoFields(t, rl[2][0].([]byte))
+	assert.Equal(scopeName, protoString(protoFields(t, scopeLogs[1][0].([]byte))[1][0]))
+
+	records := scopeLogs[2]
+	require.Len(t, records, 2)
+	for i, expected := range []struct {
+		body, severity, source string
+		number                 uint64
+	}{
+		{"hello", "INFO", "stdout", severityInfo},
+		{"oops", "ERROR", "stderr", severityError},
+	} {
+		r := protoFields(t, records[i].([]byte))
+		assert.EqualValues(ts.UnixNano(), r[1][0])
+		assert.Equal(expected.number, r[2][0])
+		assert.Equal(expected.severity, protoString(r[3][0]))
+		assert.Equal(expected.body, protoString(protoFields(t, r[5][0].([]byte))[1][0]))
+		k, v := decodeKeyValue(t, r[6][0].([]byte))
+		assert.Equal("log.iostream", k)
+		assert.Equal(expected.source, v)
+		assert.NotZero(r[11][0])
+	}
+}
+
+func TestExportHTTPProtobuf(t *testing.T) {
+	srv, requests := startHTTPCollector(t)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		EndpointKey: srv.URL,
+		HeadersKey:  "authorization=Bearer token",
+	})
+
+	ts := time.Unix(1577934245, 123)
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	loggertest.LogAt(t, l, "oops", "stderr", ts)
+	require.Nil(t, l.Close())
+
+	req := loggertest.Receive(t, requests).(collectorRequest)
+	assert.Equal(t, logsPath, req.path)
+	assert.Equal(t, "application/x-protobuf", req.headers["content-type"])
+	assert.Equal(t, "Bearer token", req.headers["authorization"])
+	checkProtobufRequest(t, req.body, ts)
+}
+
+func TestExportHTTPJSON(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	srv, requests := startHTTPCollector(t)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		EndpointKey: srv.URL,
+		ProtocolKey: HTTPJSONProtocol,
+	})
+
+	ts := time.Unix(1577934245, 123)
+	loggertest.LogAt(t, l, "oops", "stderr", ts)
+	require.Nil(l.Close())
+
+	req := loggertest.Receive(t, requests).(collectorRequest)
+	assert.Equal("application/json", req.headers["content-type"])
+
+	var export jsonRequest
+	require.Nil(json.Unmarshal(req.body, &export))
+	require.Len(export.ResourceLogs, 1)
+	assert.Contains(export.ResourceLogs[0].Resource.Attributes, jsonKeyValue{"container.name", jsonAnyValue{"web"}})
+
+	scopeLogs := export.ResourceLogs[0].ScopeLogs
+	require.Len(scopeLogs, 1)
+	require.Len(scopeLogs[0].LogRecords, 1)
+	r := scopeLogs[0].LogRecords[0]
+	assert.Equal("1577934245000000123", r.TimeUnixNano)
+	assert.Equal(severityError, r.SeverityNumber)
+	assert.Equal("ERROR", r.SeverityText)
+	assert.Equal("oops", r.Body.StringValue)
+	assert.Equal([]jsonKeyValue{{"log.iostream", jsonAnyValue{"stderr"}}}, r.Attributes)
+}
+
+func TestExportHTTPRetries(t *testing.T) {
+	srv, requests := startHTTPCollector(t, http.StatusServiceUnavailable, http.StatusBadRequest)
+	defer srv.Close()
+	l := loggertest.New(t, New, map[string]string{
+		EndpointKey:  srv.URL,
+		BatchWaitKey: "10ms",
+	})
+	defer l.Close()
+
+	loggertest.Log(t, l, "first")
+
+	// the unavailable collector is retried, but the bad request isn't
+	first := loggertest.Receive(t, requests).(collectorRequest).body
+	assert.Equal(t, first, loggertest.Receive(t, requests).(collectorRequest).body)
+
+	loggertest.Log(t, l, "second")
+	assert.NotEqual(t, first, loggertest.Receive(t, requests).(collectorRequest).body)
+}
+
+func TestExportGRPC(t *testing.T) {
+	srv, addr, requests := startGRPCCollector(t)
+	defer srv.Stop()
+	l := loggertest.New(t, New, map[string]string{
+		EndpointKey: "http://" + addr,
+		ProtocolKey: GRPCProtocol,
+		HeadersKey:  "authorization=Bearer token",
+	})
+
+	ts := time.Unix(1577934245, 123)
+	loggertest.LogAt(t, l, "hello", "stdout", ts)
+	loggertest.LogAt(t, l, "oops", "stderr", ts)
+	require.Nil(t, l.Close())
+
+	req := loggertest.Receive(t, requests).(collectorRequest)
+	assert.Equal(t, exportMethod, req.path)
+	assert.Equal(t, "Bearer token", req.headers["authorization"])
+	checkProtobufRequest(t, req.body, ts)
+}
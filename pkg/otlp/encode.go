@@ -0,0 +1,148 @@
+package otlp
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/protowire"
+)
+
+// instrumentation scope of the exported records
+const scopeName = "github.com/allgdante/docker-multilogger-plugin"
+
+// resource holds the container resource, encoded once for every format
+type resource struct {
+	proto []byte
+	json  jsonResource
+}
+
+func newResource(attrs []attribute) *resource {
+	r := &resource{json: jsonResource{Attributes: jsonAttributes(attrs)}}
+	for _, attr := range attrs {
+		r.proto = protowire.AppendBytesField(r.proto, 1, encodeKeyValue(attr))
+	}
+	return r
+}
+
+// encodeProtobuf encodes the records as an ExportLogsServiceRequest. The
+// messages are simple enough to be encoded by hand:
+//
+//	message ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+//	message ResourceLogs { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+//	message Resource { repeated KeyValue attributes = 1; }
+//	message ScopeLogs { InstrumentationScope scope = 1; repeated LogRecord log_records = 2; }
+//	message InstrumentationScope { string name = 1; }
+//	message LogRecord {
+//	  fixed64 time_unix_nano = 1; SeverityNumber severity_number = 2; string severity_text = 3;
+//	  AnyValue body = 5; repeated KeyValue attributes = 6; fixed64 observed_time_unix_nano = 11;
+//	}
+//	message KeyValue { string key = 1; AnyValue value = 2; }
+//	message AnyValue { string string_value = 1; }
+func encodeProtobuf(res *resource, records []record) []byte {
+	scope := protowire.AppendBytesField(nil, 1, protowire.AppendBytesField(nil, 1, []byte(scopeName)))
+
+	var lr []byte
+	for _, r := range records {
+		lr = protowire.AppendFixed64Field(lr[:0], 1, uint64(r.timestamp.UnixNano()))
+		lr = protowire.AppendVarintField(lr, 2, uint64(r.severity))
+		lr = protowire.AppendBytesField(lr, 3, []byte(severityText(r.severity)))
+		lr = protowire.AppendBytesField(lr, 5, encodeStringValue(r.body))
+		if r.source != "" {
+			lr = protowire.AppendBytesField(lr, 6, encodeKeyValue(attribute{"log.iostream", r.source}))
+		}
+		lr = protowire.AppendFixed64Field(lr, 11, uint64(r.observed.UnixNano()))
+		scope = protowire.AppendBytesField(scope, 2, lr)
+	}
+
+	rl := protowire.AppendBytesField(nil, 1, res.proto)
+	rl = protowire.AppendBytesField(rl, 2, scope)
+	return protowire.AppendBytesField(nil, 1, rl)
+}
+
+func encodeKeyValue(attr attribute) []byte {
+	kv := protowire.AppendBytesField(nil, 1, []byte(attr.key))
+	return protowire.AppendBytesField(kv, 2, encodeStringValue(attr.value))
+}
+
+func encodeStringValue(s string) []byte {
+	return protowire.AppendBytesField(nil, 1, []byte(s))
+}
+
+// OTLP/JSON messages, where 64 bit integers are encoded as strings
+type (
+	jsonRequest struct {
+		ResourceLogs []jsonResourceLogs `json:"resourceLogs"`
+	}
+	jsonResourceLogs struct {
+		Resource  jsonResource    `json:"resource"`
+		ScopeLogs []jsonScopeLogs `json:"scopeLogs"`
+	}
+	jsonResource struct {
+		Attributes []jsonKeyValue `json:"attributes"`
+	}
+	jsonScopeLogs struct {
+		Scope      jsonScope       `json:"scope"`
+		LogRecords []jsonLogRecord `json:"logRecords"`
+	}
+	jsonScope struct {
+		Name string `json:"name"`
+	}
+	jsonLogRecord struct {
+		TimeUnixNano         string         `json:"timeUnixNano"`
+		ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+		SeverityNumber       int            `json:"severityNumber"`
+		SeverityText         string         `json:"severityText"`
+		Body                 jsonAnyValue   `json:"body"`
+		Attributes           []jsonKeyValue `json:"attributes,omitempty"`
+	}
+	jsonKeyValue struct {
+		Key   string       `json:"key"`
+		Value jsonAnyValue `json:"value"`
+	}
+	jsonAnyValue struct {
+		StringValue string `json:"stringValue"`
+	}
+)
+
+// encodeJSON encodes the records as an OTLP/JSON ExportLogsServiceRequest
+func encodeJSON(res *resource, records []record) ([]byte, error) {
+	logRecords := make([]jsonLogRecord, 0, len(records))
+	for _, r := range records {
+		lr := jsonLogRecord{
+			TimeUnixNano:         strconv.FormatInt(r.timestamp.UnixNano(), 10),
+			ObservedTimeUnixNano: strconv.FormatInt(r.observed.UnixNano(), 10),
+			SeverityNumber:       r.severity,
+			SeverityText:         severityText(r.severity),
+			Body:                 jsonAnyValue{r.body},
+		}
+		if r.source != "" {
+			lr.Attributes = jsonAttributes([]attribute{{"log.iostream", r.source}})
+		}
+		logRecords = append(logRecords, lr)
+	}
+
+	return json.Marshal(jsonRequest{
+		ResourceLogs: []jsonResourceLogs{{
+			Resource: res.json,
+			ScopeLogs: []jsonScopeLogs{{
+				Scope:      jsonScope{scopeName},
+				LogRecords: logRecords,
+			}},
+		}},
+	})
+}
+
+func jsonAttributes(attrs []attribute) []jsonKeyValue {
+	result := make([]jsonKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		result = append(result, jsonKeyValue{attr.key, jsonAnyValue{attr.value}})
+	}
+	return result
+}
+
+func severityText(severity int) string {
+	if severity == severityError {
+		return "ERROR"
+	}
+	return "INFO"
+}
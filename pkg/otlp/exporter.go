@@ -0,0 +1,159 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// exportMethod is the gRPC method of the OTLP logs service
+const exportMethod = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+// httpExporter exports records through OTLP/HTTP, encoded as protobuf or
+// JSON
+type httpExporter struct {
+	url     string
+	json    bool
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPExporter(cfg config) (exporter, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg.tls
+
+	return &httpExporter{
+		url:     cfg.endpoint.String(),
+		json:    cfg.protocol == HTTPJSONProtocol,
+		headers: cfg.headers,
+		client:  &http.Client{Transport: transport},
+	}, nil
+}
+
+func (e *httpExporter) export(ctx context.Context, res *resource, records []record) (bool, error) {
+	var (
+		body        []byte
+		contentType = "application/x-protobuf"
+	)
+	if e.json {
+		var err error
+		if body, err = encodeJSON(res, records); err != nil {
+			return false, err
+		}
+		contentType = "application/json"
+	} else {
+		body = encodeProtobuf(res, records)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true, err
+		}
+		return false, err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return false, nil
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// grpcExporter exports records through OTLP/gRPC
+type grpcExporter struct {
+	conn     *grpc.ClientConn
+	metadata metadata.MD
+}
+
+func newGRPCExporter(cfg config) (exporter, error) {
+	creds := grpc.WithInsecure()
+	if cfg.tls != nil {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(cfg.tls))
+	}
+
+	// the connection is established in the background, and again after
+	// every failure
+	conn, err := grpc.Dial(cfg.endpoint.Host, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcExporter{
+		conn:     conn,
+		metadata: metadata.New(cfg.headers),
+	}, nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, res *resource, records []record) (bool, error) {
+	ctx = metadata.NewOutgoingContext(ctx, e.metadata)
+
+	var resp []byte
+	err := e.conn.Invoke(ctx, exportMethod, encodeProtobuf(res, records), &resp, grpc.ForceCodec(rawCodec{}))
+	if err == nil {
+		return false, nil
+	}
+
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+		codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return true, err
+	}
+	return false, err
+}
+
+func (e *grpcExporter) close() error {
+	return e.conn.Close()
+}
+
+// rawCodec passes the messages through, as they are already encoded
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("otlp: unexpected message type %T", v)
+	}
+	return b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("otlp: unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
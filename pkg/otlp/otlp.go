@@ -0,0 +1,305 @@
+// Package otlp provides a log driver for exporting container logs to an
+// OpenTelemetry collector through the OTLP protocol.
+package otlp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/errdefs"
+)
+
+// Driver name & available keys
+const (
+	DriverName       = "otlp"
+	EndpointKey      = DriverName + "-endpoint"
+	ProtocolKey      = DriverName + "-protocol"
+	HeadersKey       = DriverName + "-headers"
+	ResourceAttrsKey = DriverName + "-resource-attributes"
+	BatchSizeKey     = DriverName + "-batch-size"
+	BatchWaitKey     = DriverName + "-batch-wait"
+	RetriesKey       = DriverName + "-retries"
+	TimeoutKey       = DriverName + "-timeout"
+	TLSCACertKey     = DriverName + "-tls-ca-cert"
+	TLSCertKey       = DriverName + "-tls-cert"
+	TLSKeyKey        = DriverName + "-tls-key"
+	TLSSkipVerifyKey = DriverName + "-tls-skip-verify"
+	EnvKey           = "env"
+	EnvRegexKey      = "env-regex"
+	LabelsKey        = "labels"
+	LabelsRegexKey   = "labels-regex"
+)
+
+// Available export protocols, named like the OTEL_EXPORTER_OTLP_PROTOCOL
+// values
+const (
+	HTTPProtobufProtocol = "http/protobuf"
+	HTTPJSONProtocol     = "http/json"
+	GRPCProtocol         = "grpc"
+)
+
+const (
+	logsPath        = "/v1/logs"
+	defaultHTTPPort = "4318"
+	defaultGRPCPort = "4317"
+
+	defaultBatchSize = 512
+	defaultBatchWait = time.Second
+	defaultRetries   = 5
+	defaultTimeout   = 10 * time.Second
+)
+
+// Severity numbers of the OTLP log data model
+const (
+	severityInfo  = 9
+	severityError = 17
+)
+
+type otlpLogger struct {
+	client *client
+}
+
+// New creates an otlp logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := resourceAttributes(info, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var exp exporter
+	switch cfg.protocol {
+	case GRPCProtocol:
+		exp, err = newGRPCExporter(cfg)
+	default:
+		exp, err = newHTTPExporter(cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &otlpLogger{
+		client: newClient(cfg, newResource(attrs), exp),
+	}, nil
+}
+
+func (l *otlpLogger) Log(msg *logger.Message) error {
+	if len(msg.Line) == 0 {
+		logger.PutMessage(msg)
+		return nil
+	}
+
+	r := record{
+		timestamp: msg.Timestamp,
+		observed:  time.Now(),
+		severity:  severityInfo,
+		source:    msg.Source,
+		// the line is copied, as the message is reused after returning it
+		body: string(msg.Line),
+	}
+	if msg.Source == "stderr" {
+		r.severity = severityError
+	}
+	logger.PutMessage(msg)
+
+	return l.client.push(r)
+}
+
+func (l *otlpLogger) Close() error {
+	return l.client.close()
+}
+
+func (l *otlpLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for otlp specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case EndpointKey:
+		case ProtocolKey:
+		case HeadersKey:
+		case ResourceAttrsKey:
+		case BatchSizeKey:
+		case BatchWaitKey:
+		case RetriesKey:
+		case TimeoutKey:
+		case TLSCACertKey:
+		case TLSCertKey:
+		case TLSKeyKey:
+		case TLSSkipVerifyKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for otlp log driver", key)
+		}
+	}
+	_, err := parseConfig(cfg)
+	return err
+}
+
+// config holds the parsed options
+type config struct {
+	protocol      string
+	endpoint      *url.URL
+	headers       map[string]string
+	resourceAttrs map[string]string
+	batchSize     int
+	batchWait     time.Duration
+	retries       int
+	timeout       time.Duration
+	// nil unless the endpoint scheme is https
+	tls *tls.Config
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	switch c.protocol = cfg[ProtocolKey]; c.protocol {
+	case "":
+		c.protocol = HTTPProtobufProtocol
+	case HTTPProtobufProtocol, HTTPJSONProtocol, GRPCProtocol:
+	default:
+		return c, fmt.Errorf("invalid otlp protocol %q, use %s, %s or %s",
+			c.protocol, HTTPProtobufProtocol, HTTPJSONProtocol, GRPCProtocol)
+	}
+
+	if c.endpoint, err = parseEndpoint(cfg[EndpointKey], c.protocol); err != nil {
+		return
+	}
+
+	if c.headers, err = parseKeyValues(cfg[HeadersKey], "header"); err != nil {
+		return
+	}
+	if c.resourceAttrs, err = parseKeyValues(cfg[ResourceAttrsKey], "resource attribute"); err != nil {
+		return
+	}
+
+	if c.batchSize, err = loggerutil.ParseInt(cfg, BatchSizeKey, defaultBatchSize, 1); err != nil {
+		return
+	}
+	if c.batchWait, err = loggerutil.ParsePositiveDuration(cfg, BatchWaitKey, defaultBatchWait); err != nil {
+		return
+	}
+	if c.retries, err = loggerutil.ParseInt(cfg, RetriesKey, defaultRetries, 0); err != nil {
+		return
+	}
+	if c.timeout, err = loggerutil.ParsePositiveDuration(cfg, TimeoutKey, defaultTimeout); err != nil {
+		return
+	}
+
+	if c.endpoint.Scheme == "https" {
+		if c.tls, err = loggerutil.ParseTLS(cfg, loggerutil.TLSKeys{
+			CACert:     TLSCACertKey,
+			Cert:       TLSCertKey,
+			Key:        TLSKeyKey,
+			SkipVerify: TLSSkipVerifyKey,
+		}); err != nil {
+			return
+		}
+	}
+
+	return c, nil
+}
+
+// parseEndpoint parses the collector endpoint, adding the default port of
+// the protocol, and the logs path for OTLP/HTTP if there is no path
+func parseEndpoint(endpoint, protocol string) (*url.URL, error) {
+	if endpoint == "" {
+		return nil, errors.New("otlp endpoint is required")
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("otlp endpoint should be in form http[s]://host[:port][/path], got %v", endpoint)
+	}
+
+	port := defaultHTTPPort
+	if protocol == GRPCProtocol {
+		port = defaultGRPCPort
+		if u.Path != "" && u.Path != "/" {
+			return nil, fmt.Errorf("otlp grpc endpoint can't have a path, got %v", endpoint)
+		}
+	} else if u.Path == "" || u.Path == "/" {
+		u.Path = logsPath
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// parseKeyValues parses a comma-separated list of key=value pairs
+func parseKeyValues(s, what string) (map[string]string, error) {
+	result := make(map[string]string)
+	if s == "" {
+		return result, nil
+	}
+
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid otlp %s %q, use key=value", what, kv)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
+
+// attribute is a string key-value pair
+type attribute struct {
+	key   string
+	value string
+}
+
+// resourceAttributes returns the attributes describing the container, sorted
+// by key
+func resourceAttributes(info logger.Info, cfg config) ([]attribute, error) {
+	attrs := make(map[string]string)
+
+	extra, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	for k, v := range extra {
+		attrs[k] = v
+	}
+
+	attrs["container.id"] = info.ContainerID
+	attrs["container.name"] = info.Name()
+	if info.ContainerImageName != "" {
+		attrs["container.image.name"] = info.ContainerImageName
+	}
+	if hostname, err := info.Hostname(); err == nil && hostname != "" {
+		attrs["host.name"] = hostname
+	}
+
+	// the configured attributes take precedence
+	for k, v := range cfg.resourceAttrs {
+		attrs[k] = v
+	}
+
+	result := make([]attribute, 0, len(attrs))
+	for k, v := range attrs {
+		result = append(result, attribute{k, v})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].key < result[j].key })
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{EndpointKey: "http://collector"}, true},
+		{"full", map[string]string{
+			EndpointKey:      "https://collector:4318/custom/logs",
+			ProtocolKey:      HTTPJSONProtocol,
+			HeadersKey:       "authorization=Bearer token,x-team=core",
+			ResourceAttrsKey: "service.name=web,deployment.environment=prod",
+			BatchSizeKey:     "100",
+			BatchWaitKey:     "5s",
+			RetriesKey:       "0",
+			TimeoutKey:       "30s",
+			TLSSkipVerifyKey: "true",
+			LabelsKey:        "team",
+			EnvKey:           "STAGE",
+		}, true},
+		{"grpc", map[string]string{EndpointKey: "http://collector:4317", ProtocolKey: GRPCProtocol}, true},
+		{"no endpoint", map[string]string{}, false},
+		{"no scheme", map[string]string{EndpointKey: "collector:4317"}, false},
+		{"grpc with path", map[string]string{EndpointKey: "http://collector/v1/logs", ProtocolKey: GRPCProtocol}, false},
+		{"unknown key", map[string]string{EndpointKey: "http://collector", "otlp-foo": "bar"}, false},
+		{"invalid protocol", map[string]string{EndpointKey: "http://collector", ProtocolKey: "thrift"}, false},
+		{"invalid header", map[string]string{EndpointKey: "http://collector", HeadersKey: "authorization"}, false},
+		{"invalid batch size", map[string]string{EndpointKey: "http://collector", BatchSizeKey: "0"}, false},
+		{"invalid timeout", map[string]string{EndpointKey: "http://collector", TimeoutKey: "forever"}, false},
+		{"cert without key", map[string]string{EndpointKey: "https://collector", TLSCertKey: "/tmp/cert.pem"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		endpoint string
+		protocol string
+		expected string
+	}{
+		{"http://collector", HTTPProtobufProtocol, "http://collector:4318/v1/logs"},
+		{"https://collector:443/", HTTPJSONProtocol, "https://collector:443/v1/logs"},
+		{"http://collector/otlp/v1/logs", HTTPProtobufProtocol, "http://collector:4318/otlp/v1/logs"},
+		{"http://collector", GRPCProtocol, "http://collector:4317"},
+		{"http://[::1]", GRPCProtocol, "http://[::1]:4317"},
+	} {
+		u, err := parseEndpoint(tc.endpoint, tc.protocol)
+		require.Nil(t, err)
+		assert.Equal(t, tc.expected, u.String())
+	}
+}
+
+func TestResourceAttributes(t *testing.T) {
+	info := logger.Info{
+		ContainerID:        "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		ContainerName:      "/web",
+		ContainerImageName: "nginx:latest",
+		ContainerLabels:    map[string]string{"team": "core"},
+		Config: map[string]string{
+			EndpointKey:      "http://collector",
+			ResourceAttrsKey: "service.name=web,host.name=node-1",
+			LabelsKey:        "team",
+		},
+	}
+
+	cfg, err := parseConfig(info.Config)
+	require.Nil(t, err)
+
+	attrs, err := resourceAttributes(info, cfg)
+	require.Nil(t, err)
+	assert.Equal(t, []attribute{
+		{"container.id", "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e"},
+		{"container.image.name", "nginx:latest"},
+		{"container.name", "web"},
+		{"host.name", "node-1"},
+		{"service.name", "web"},
+		{"team", "core"},
+	}, attrs)
+}
@@ -0,0 +1,164 @@
+package redislog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/batcher"
+	"github.com/sirupsen/logrus"
+)
+
+// client batches the XADD commands and pipelines them from a background
+// goroutine, reconnecting when needed.
+type client struct {
+	cfg     config
+	batcher *batcher.Batcher
+
+	// only used by the batcher goroutine
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func newClient(cfg config) *client {
+	c := &client{cfg: cfg}
+	c.batcher = batcher.New(batcher.Config{
+		Wait:     cfg.batchWait,
+		MaxItems: cfg.batchSize,
+	}, c.send)
+	return c
+}
+
+// push queues a command, blocking if the queue is full.
+func (c *client) push(args [][]byte) error {
+	return c.batcher.Push(args)
+}
+
+// close stops accepting commands and waits until the queued ones are sent,
+// without retrying failed ones.
+func (c *client) close() error {
+	c.batcher.Close()
+	c.disconnect()
+	return nil
+}
+
+// send pipelines a batch, retrying the commands without a reply with an
+// exponential backoff on connection errors. Those commands are dropped if
+// they can't be sent.
+func (c *client) send(items []interface{}) {
+	batch := make([][][]byte, 0, len(items))
+	for _, item := range items {
+		batch = append(batch, item.([][]byte))
+	}
+
+	err := c.batcher.Retry(c.cfg.retries, func() (bool, error) {
+		n, err := c.pipeline(batch)
+		batch = batch[n:]
+		return true, err
+	})
+	if err != nil {
+		logrus.WithError(err).Errorf("redis: dropping %d messages", len(batch))
+	}
+}
+
+// pipeline writes the commands and reads their replies, returning how many
+// replies were read. Rejected commands are dropped, as sending them again
+// wouldn't help.
+func (c *client) pipeline(batch [][][]byte) (int, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.cfg.timeout)); err != nil {
+		c.disconnect()
+		return 0, err
+	}
+	for _, args := range batch {
+		if err := writeCommand(c.w, args); err != nil {
+			c.disconnect()
+			return 0, err
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		c.disconnect()
+		return 0, err
+	}
+
+	for i := range batch {
+		if _, err := readReply(c.r); err != nil {
+			if _, ok := err.(redisError); ok {
+				logrus.WithError(err).Error("redis: dropping rejected message")
+				continue
+			}
+			c.disconnect()
+			return i, err
+		}
+	}
+	return len(batch), nil
+}
+
+// connect dials the server, and authenticates and selects the database if
+// needed
+func (c *client) connect() error {
+	dialer := &net.Dialer{Timeout: c.cfg.timeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.cfg.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.cfg.address, c.cfg.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", c.cfg.address)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn, c.r, c.w = conn, bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	var setup [][][]byte
+	if c.cfg.password != "" {
+		auth := [][]byte{[]byte("AUTH")}
+		if c.cfg.username != "" {
+			auth = append(auth, []byte(c.cfg.username))
+		}
+		setup = append(setup, append(auth, []byte(c.cfg.password)))
+	}
+	if c.cfg.db > 0 {
+		setup = append(setup, [][]byte{[]byte("SELECT"), []byte(strconv.Itoa(c.cfg.db))})
+	}
+	for _, args := range setup {
+		if err := c.do(args); err != nil {
+			c.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a single command and waits for its reply
+func (c *client) do(args [][]byte) error {
+	if err := c.conn.SetDeadline(time.Now().Add(c.cfg.timeout)); err != nil {
+		return err
+	}
+	if err := writeCommand(c.w, args); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	_, err := readReply(c.r)
+	return err
+}
+
+func (c *client) disconnect() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn, c.r, c.w = nil, nil, nil
+	}
+}
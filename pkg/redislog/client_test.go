@@ -0,0 +1,296 @@
+package redislog
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redisServer is an in-memory Redis stand-in, which supports the AUTH,
+// SELECT and XADD commands. The XADD commands adding a "rejected" line are
+// replied with an error.
+type redisServer struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	streams  map[string][]map[string]string
+	commands [][]string
+	// number of XADD commands sent along with the previous ones
+	pipelined int
+	// number of connections to drop when receiving an XADD command
+	drops int
+	seq   int
+}
+
+// startRedisServer runs the stand-in, which must be closed by the caller.
+func startRedisServer(t *testing.T, password string) *redisServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	s := &redisServer{
+		ln:       ln,
+		password: password,
+		streams:  make(map[string][]map[string]string),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *redisServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *redisServer) close() {
+	s.ln.Close()
+}
+
+func (s *redisServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	authenticated := s.password == ""
+	for {
+		v, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range v.([]interface{}) {
+			args = append(args, arg.(string))
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		reply := ""
+		switch {
+		case args[0] == "AUTH":
+			if authenticated = args[len(args)-1] == s.password; authenticated {
+				reply = "+OK"
+			} else {
+				reply = "-WRONGPASS invalid password"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required"
+		case args[0] == "SELECT":
+			reply = "+OK"
+		case args[0] == "XADD":
+			if s.drops > 0 {
+				s.drops--
+				s.mu.Unlock()
+				return
+			}
+			if r.Buffered() > 0 {
+				s.pipelined++
+			}
+			reply = s.xadd(args[1:])
+		default:
+			reply = "-ERR unknown command"
+		}
+		s.mu.Unlock()
+
+		fmt.Fprintf(w, "%s\r\n", reply)
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// xadd adds an entry to a stream, trimming it exactly even if approximate
+// trimming is asked for. It must be called with the lock held.
+func (s *redisServer) xadd(args []string) string {
+	key, args := args[0], args[1:]
+	maxLen := -1
+	if args[0] == "MAXLEN" {
+		if args = args[1:]; args[0] == "~" || args[0] == "=" {
+			args = args[1:]
+		}
+		maxLen, _ = strconv.Atoi(args[0])
+		args = args[1:]
+	}
+	// the entry id
+	args = args[1:]
+
+	entry := make(map[string]string)
+	for i := 0; i+1 < len(args); i += 2 {
+		entry[args[i]] = args[i+1]
+	}
+	if entry["line"] == "rejected" {
+		return "-ERR rejected"
+	}
+
+	entries := append(s.streams[key], entry)
+	if maxLen >= 0 && len(entries) > maxLen {
+		entries = entries[len(entries)-maxLen:]
+	}
+	s.streams[key] = entries
+
+	s.seq++
+	id := fmt.Sprintf("1-%d", s.seq)
+	return fmt.Sprintf("$%d\r\n%s", len(id), id)
+}
+
+func (s *redisServer) stream(key string) []map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[key]
+}
+
+// lines returns the lines of a stream
+func (s *redisServer) lines(key string) []string {
+	var lines []string
+	for _, entry := range s.stream(key) {
+		lines = append(lines, entry["line"])
+	}
+	return lines
+}
+
+func (s *redisServer) count(command string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, args := range s.commands {
+		if args[0] == command {
+			n++
+		}
+	}
+	return n
+}
+
+func TestXAdd(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	s := startRedisServer(t, "secret")
+	defer s.close()
+
+	info := loggertest.Info(map[string]string{
+		AddressKey:     s.addr(),
+		UsernameKey:    "logger",
+		PasswordKey:    "secret",
+		DBKey:          "2",
+		MaxLenKey:      "2",
+		ApproximateKey: "false",
+		BatchWaitKey:   "1m",
+		LabelsKey:      "team",
+	})
+	info.ContainerLabels = map[string]string{"team": "core"}
+	l, err := New(info)
+	require.Nil(err)
+
+	ts := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	for _, line := range []string{"first", "second", "third"} {
+		loggertest.LogAt(t, l, line, "stdout", ts)
+	}
+	require.Nil(l.Close())
+
+	// the stream is trimmed to the last two entries
+	assert.Equal([]string{"second", "third"}, s.lines("docker-logs:web"))
+	entry := s.stream("docker-logs:web")[0]
+	assert.Equal("stdout", entry["source"])
+	assert.Equal("2020-01-02T03:04:05Z", entry["timestamp"])
+	assert.Equal(loggertest.ContainerID, entry["container_id"])
+	assert.Equal("web", entry["container_name"])
+	assert.Equal("core", entry["team"])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	require.True(len(s.commands) > 2)
+	assert.Equal([]string{"AUTH", "logger", "secret"}, s.commands[0])
+	assert.Equal([]string{"SELECT", "2"}, s.commands[1])
+	assert.Equal([]string{"XADD", "docker-logs:web", "MAXLEN", "2", "*", "line", "first"}, s.commands[2][:7])
+	// the batch is sent at once when closing
+	assert.Equal(2, s.pipelined)
+}
+
+func TestXAddApproximateMaxLen(t *testing.T) {
+	s := startRedisServer(t, "")
+	defer s.close()
+
+	info := loggertest.Info(map[string]string{
+		AddressKey: s.addr(),
+		KeyKey:     `logs:{{index .ContainerLabels "team"}}`,
+		MaxLenKey:  "1000",
+	})
+	info.ContainerLabels = map[string]string{"team": "core"}
+	l, err := New(info)
+	require.Nil(t, err)
+	loggertest.Log(t, l, "hello")
+	require.Nil(t, l.Close())
+
+	assert.Equal(t, []string{"hello"}, s.lines("logs:core"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, []string{"XADD", "logs:core", "MAXLEN", "~", "1000", "*"}, s.commands[0][:6])
+}
+
+func TestReconnect(t *testing.T) {
+	s := startRedisServer(t, "")
+	defer s.close()
+	s.drops = 1
+
+	l := loggertest.New(t, New, map[string]string{
+		AddressKey:   s.addr(),
+		BatchSizeKey: "1",
+	})
+	loggertest.Log(t, l, "hello")
+	// the close doesn't wait for retries, so the retry must happen first
+	for i := 0; len(s.lines("docker-logs:web")) == 0; i++ {
+		require.True(t, i < 500, "timeout waiting for the retry")
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Nil(t, l.Close())
+
+	assert.Equal(t, []string{"hello"}, s.lines("docker-logs:web"))
+	assert.Equal(t, 2, s.count("XADD"))
+}
+
+func TestRejectedNotRetried(t *testing.T) {
+	s := startRedisServer(t, "")
+	defer s.close()
+
+	l := loggertest.New(t, New, map[string]string{AddressKey: s.addr()})
+	loggertest.Log(t, l, "rejected")
+	loggertest.Log(t, l, "accepted")
+	require.Nil(t, l.Close())
+
+	assert.Equal(t, []string{"accepted"}, s.lines("docker-logs:web"))
+	assert.Equal(t, 2, s.count("XADD"))
+}
+
+func TestWrongPassword(t *testing.T) {
+	s := startRedisServer(t, "secret")
+	defer s.close()
+
+	l := loggertest.New(t, New, map[string]string{
+		AddressKey:  s.addr(),
+		PasswordKey: "wrong",
+		RetriesKey:  "0",
+	})
+	loggertest.Log(t, l, "hello")
+	require.Nil(t, l.Close())
+
+	assert.Empty(t, s.lines("docker-logs:web"))
+	assert.Equal(t, 0, s.count("XADD"))
+	assert.Equal(t, 1, s.count("AUTH"))
+}
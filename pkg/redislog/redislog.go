@@ -0,0 +1,265 @@
+// Package redislog provides a log driver for adding container logs to Redis
+// streams.
+package redislog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/templates"
+	"github.com/docker/docker/errdefs"
+)
+
+// Driver name & available keys
+const (
+	DriverName       = "redis"
+	AddressKey       = DriverName + "-address"
+	KeyKey           = DriverName + "-key"
+	DBKey            = DriverName + "-db"
+	UsernameKey      = DriverName + "-username"
+	PasswordKey      = DriverName + "-password"
+	MaxLenKey        = DriverName + "-maxlen"
+	ApproximateKey   = DriverName + "-maxlen-approximate"
+	BatchSizeKey     = DriverName + "-batch-size"
+	BatchWaitKey     = DriverName + "-batch-wait"
+	RetriesKey       = DriverName + "-retries"
+	TimeoutKey       = DriverName + "-timeout"
+	TLSKey           = DriverName + "-tls"
+	TLSCACertKey     = DriverName + "-tls-ca-cert"
+	TLSCertKey       = DriverName + "-tls-cert"
+	TLSKeyKey        = DriverName + "-tls-key"
+	TLSSkipVerifyKey = DriverName + "-tls-skip-verify"
+	EnvKey           = "env"
+	EnvRegexKey      = "env-regex"
+	LabelsKey        = "labels"
+	LabelsRegexKey   = "labels-regex"
+)
+
+const (
+	defaultKey       = "docker-logs:{{.Name}}"
+	defaultBatchSize = 100
+	defaultBatchWait = 100 * time.Millisecond
+	defaultRetries   = 3
+	defaultTimeout   = 5 * time.Second
+)
+
+type redisLogger struct {
+	client *client
+	// the XADD arguments before the entry ID
+	xadd [][]byte
+	// the fields added to every entry after the message ones
+	fields [][]byte
+}
+
+// New creates a redis logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parseKey(info, cfg.key)
+	if err != nil {
+		return nil, err
+	}
+
+	xadd := [][]byte{[]byte("XADD"), []byte(key)}
+	if cfg.maxLen > 0 {
+		xadd = append(xadd, []byte("MAXLEN"))
+		if cfg.approximate {
+			xadd = append(xadd, []byte("~"))
+		}
+		xadd = append(xadd, []byte(strconv.Itoa(cfg.maxLen)))
+	}
+	xadd = append(xadd, []byte("*"))
+
+	attrs, err := info.ExtraAttributes(nil)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	fields := [][]byte{
+		[]byte("container_id"), []byte(info.ContainerID),
+		[]byte("container_name"), []byte(info.Name()),
+		[]byte("image_id"), []byte(info.ContainerImageID),
+		[]byte("image_name"), []byte(info.ContainerImageName),
+	}
+	// sorted, so every entry has the same field order
+	names := make([]string, 0, len(attrs))
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fields = append(fields, []byte(k), []byte(attrs[k]))
+	}
+
+	return &redisLogger{
+		client: newClient(cfg),
+		xadd:   xadd,
+		fields: fields,
+	}, nil
+}
+
+func (l *redisLogger) Log(msg *logger.Message) error {
+	if len(msg.Line) == 0 {
+		logger.PutMessage(msg)
+		return nil
+	}
+
+	args := make([][]byte, 0, len(l.xadd)+6+len(l.fields))
+	args = append(args, l.xadd...)
+	args = append(args,
+		[]byte("line"), append([]byte(nil), msg.Line...),
+		[]byte("source"), []byte(msg.Source),
+		[]byte("timestamp"), []byte(msg.Timestamp.UTC().Format(time.RFC3339Nano)),
+	)
+	args = append(args, l.fields...)
+	logger.PutMessage(msg)
+
+	return l.client.push(args)
+}
+
+func (l *redisLogger) Close() error {
+	return l.client.close()
+}
+
+func (l *redisLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for redis specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case AddressKey:
+		case KeyKey:
+		case DBKey:
+		case UsernameKey:
+		case PasswordKey:
+		case MaxLenKey:
+		case ApproximateKey:
+		case BatchSizeKey:
+		case BatchWaitKey:
+		case RetriesKey:
+		case TimeoutKey:
+		case TLSKey:
+		case TLSCACertKey:
+		case TLSCertKey:
+		case TLSKeyKey:
+		case TLSSkipVerifyKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for redis log driver", key)
+		}
+	}
+
+	c, err := parseConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := templates.NewParse("key", c.key); err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+	return nil
+}
+
+// config holds the parsed options
+type config struct {
+	address     string
+	key         string
+	db          int
+	username    string
+	password    string
+	maxLen      int
+	approximate bool
+	batchSize   int
+	batchWait   time.Duration
+	retries     int
+	timeout     time.Duration
+	tls         *tls.Config
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	if c.address = cfg[AddressKey]; c.address == "" {
+		return c, errors.New("redis address is required")
+	}
+	if _, _, err := net.SplitHostPort(c.address); err != nil {
+		return c, errdefs.InvalidParameter(fmt.Errorf("redis address should be in form host:port, got %v", c.address))
+	}
+
+	if c.key = cfg[KeyKey]; c.key == "" {
+		c.key = defaultKey
+	}
+	if c.db, err = loggerutil.ParseInt(cfg, DBKey, 0, 0); err != nil {
+		return
+	}
+
+	c.username = cfg[UsernameKey]
+	c.password = cfg[PasswordKey]
+	if c.username != "" && c.password == "" {
+		return c, errors.New("redis username requires a password")
+	}
+
+	if c.maxLen, err = loggerutil.ParseInt(cfg, MaxLenKey, 0, 0); err != nil {
+		return
+	}
+	c.approximate = true
+	if v := cfg[ApproximateKey]; v != "" {
+		if c.approximate, err = strconv.ParseBool(v); err != nil {
+			return c, errdefs.InvalidParameter(err)
+		}
+	}
+
+	if c.batchSize, err = loggerutil.ParseInt(cfg, BatchSizeKey, defaultBatchSize, 1); err != nil {
+		return
+	}
+	if c.batchWait, err = loggerutil.ParsePositiveDuration(cfg, BatchWaitKey, defaultBatchWait); err != nil {
+		return
+	}
+	if c.retries, err = loggerutil.ParseInt(cfg, RetriesKey, defaultRetries, 0); err != nil {
+		return
+	}
+	if c.timeout, err = loggerutil.ParsePositiveDuration(cfg, TimeoutKey, defaultTimeout); err != nil {
+		return
+	}
+
+	if c.tls, err = loggerutil.ParseTLS(cfg, loggerutil.TLSKeys{
+		Enable:     TLSKey,
+		CACert:     TLSCACertKey,
+		Cert:       TLSCertKey,
+		Key:        TLSKeyKey,
+		SkipVerify: TLSSkipVerifyKey,
+	}); err != nil {
+		return
+	}
+	return c, nil
+}
+
+// parseKey renders the stream key template using the container info
+func parseKey(info logger.Info, key string) (string, error) {
+	tmpl, err := templates.NewParse("key", key)
+	if err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, &info); err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+
+	if buf.Len() == 0 {
+		return "", errdefs.InvalidParameter(errors.New("redis key is empty"))
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,75 @@
+package redislog
+
+import (
+	"testing"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{AddressKey: "redis:6379"}, true},
+		{"full", map[string]string{
+			AddressKey:       "redis:6379",
+			KeyKey:           `logs:{{index .ContainerLabels "com.docker.swarm.service.name"}}`,
+			DBKey:            "1",
+			UsernameKey:      "logger",
+			PasswordKey:      "secret",
+			MaxLenKey:        "10000",
+			ApproximateKey:   "false",
+			BatchSizeKey:     "500",
+			BatchWaitKey:     "1s",
+			RetriesKey:       "0",
+			TimeoutKey:       "10s",
+			TLSKey:           "true",
+			TLSSkipVerifyKey: "true",
+			LabelsKey:        "team",
+			EnvKey:           "STAGE",
+		}, true},
+		{"no address", map[string]string{}, false},
+		{"invalid address", map[string]string{AddressKey: "redis"}, false},
+		{"unknown key", map[string]string{AddressKey: "redis:6379", "redis-foo": "bar"}, false},
+		{"invalid key", map[string]string{AddressKey: "redis:6379", KeyKey: "logs:{{.Name"}, false},
+		{"invalid db", map[string]string{AddressKey: "redis:6379", DBKey: "-1"}, false},
+		{"username without password", map[string]string{AddressKey: "redis:6379", UsernameKey: "logger"}, false},
+		{"invalid maxlen", map[string]string{AddressKey: "redis:6379", MaxLenKey: "many"}, false},
+		{"invalid approximate", map[string]string{AddressKey: "redis:6379", ApproximateKey: "maybe"}, false},
+		{"invalid batch size", map[string]string{AddressKey: "redis:6379", BatchSizeKey: "0"}, false},
+		{"invalid batch wait", map[string]string{AddressKey: "redis:6379", BatchWaitKey: "0s"}, false},
+		{"tls cert without key", map[string]string{AddressKey: "redis:6379", TLSKey: "true", TLSCertKey: "cert.pem"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	info := logger.Info{
+		ContainerID:     "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		ContainerName:   "/web",
+		ContainerLabels: map[string]string{"com.docker.swarm.service.name": "api"},
+	}
+
+	key, err := parseKey(info, defaultKey)
+	require.Nil(t, err)
+	assert.Equal(t, "docker-logs:web", key)
+
+	key, err = parseKey(info, `logs:{{index .ContainerLabels "com.docker.swarm.service.name"}}`)
+	require.Nil(t, err)
+	assert.Equal(t, "logs:api", key)
+
+	_, err = parseKey(info, `{{index .ContainerLabels "missing"}}`)
+	assert.NotNil(t, err)
+}
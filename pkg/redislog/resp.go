@@ -0,0 +1,99 @@
+package redislog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// redisError is an error reply, like WRONGTYPE, which means the command was
+// rejected rather than the connection failing
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// writeCommand writes a command in the RESP protocol, as an array of bulk
+// strings
+func writeCommand(w *bufio.Writer, args [][]byte) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n", len(arg)); err != nil {
+			return err
+		}
+		if _, err := w.Write(arg); err != nil {
+			return err
+		}
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReply reads a reply in the RESP protocol. Simple and bulk strings are
+// returned as strings, integers as int64, arrays as []interface{} and error
+// replies as a redisError.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			// a nil bulk string
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			v, err := readReply(r)
+			if rerr, ok := err.(redisError); ok {
+				v = rerr
+			} else if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: invalid reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,110 @@
+package s3archive
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// chunks are named after their creation time, which sorts them by age
+	chunkLayout = "20060102T150405.000000000Z"
+	chunkExt    = ".log"
+	gzipExt     = ".gz"
+)
+
+func chunkName(t time.Time) string {
+	return t.UTC().Format(chunkLayout)
+}
+
+// chunkTime returns the creation time of a chunk file
+func chunkTime(path string) (time.Time, error) {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), gzipExt), chunkExt)
+	return time.Parse(chunkLayout, name)
+}
+
+// sealChunks compresses the chunks of a directory which weren't sealed
+func sealChunks(dir string) error {
+	chunks, err := listChunks(dir, chunkExt)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := compressChunk(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listChunks returns the chunks of a directory with the given extension,
+// oldest first. The directory is listed rather than globbed, as its path may
+// have pattern characters.
+func listChunks(dir, ext string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var chunks []string
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, err := chunkTime(name); err != nil {
+			// not one of our files
+			continue
+		}
+		chunks = append(chunks, filepath.Join(dir, name))
+	}
+
+	sort.Strings(chunks)
+	return chunks, nil
+}
+
+// compressChunk replaces the chunk with a gzip compressed one
+func compressChunk(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	gz := strings.TrimSuffix(path, chunkExt) + gzipExt
+	tmp := gz + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, gz); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,309 @@
+// Package s3archive provides a log driver for archiving container logs to S3
+// compatible object storage, as compressed chunks of messages.
+package s3archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggerutil"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/errdefs"
+	units "github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+)
+
+// Driver name & available keys
+const (
+	DriverName         = "s3archive"
+	EndpointKey        = DriverName + "-endpoint"
+	RegionKey          = DriverName + "-region"
+	BucketKey          = DriverName + "-bucket"
+	PrefixKey          = DriverName + "-prefix"
+	AccessKeyIDKey     = DriverName + "-access-key-id"
+	SecretAccessKeyKey = DriverName + "-secret-access-key"
+	PathStyleKey       = DriverName + "-path-style"
+	ChunkSizeKey       = DriverName + "-chunk-size"
+	ChunkAgeKey        = DriverName + "-chunk-age"
+	BufferDirKey       = DriverName + "-buffer-dir"
+	TimeoutKey         = DriverName + "-timeout"
+	EnvKey             = "env"
+	EnvRegexKey        = "env-regex"
+	LabelsKey          = "labels"
+	LabelsRegexKey     = "labels-regex"
+)
+
+const (
+	defaultRegion    = "us-east-1"
+	defaultChunkSize = 8 * 1024 * 1024
+	defaultChunkAge  = 5 * time.Minute
+	defaultBufferDir = "/var/log/docker-s3archive"
+	defaultTimeout   = time.Minute
+)
+
+// errLoggerClosed is returned when logging after closing the logger
+var errLoggerClosed = errors.New("s3archive: logger is closed")
+
+type archiveLogger struct {
+	cfg      config
+	dir      string
+	uploader *uploader
+	// fields added to every message
+	fields map[string]interface{}
+
+	mu      sync.Mutex
+	closed  bool
+	chunk   *os.File
+	size    int64
+	expires *time.Timer
+}
+
+// New creates an s3archive logger using the configuration passed in on the
+// context.
+func New(info logger.Info) (logger.Logger, error) {
+	cfg, err := parseConfig(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := loggerutil.ContainerFields(info)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, err := newS3(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(cfg.bufferDir, info.ContainerID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error setting up logger dir: %v", err)
+	}
+	// chunks left behind by a crash are sent along with the ones which
+	// couldn't be uploaded before
+	if err := sealChunks(dir); err != nil {
+		return nil, err
+	}
+
+	return &archiveLogger{
+		cfg:      cfg,
+		dir:      dir,
+		uploader: newUploader(svc, cfg, dir, info.Name()),
+		fields:   fields,
+	}, nil
+}
+
+func (l *archiveLogger) Log(msg *logger.Message) error {
+	if len(msg.Line) == 0 {
+		logger.PutMessage(msg)
+		return nil
+	}
+
+	line, err := l.encode(msg)
+	logger.PutMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return errLoggerClosed
+	}
+	if l.chunk == nil {
+		if err := l.openChunk(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.chunk.Write(append(line, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if l.size >= l.cfg.chunkSize {
+		l.sealChunk()
+	}
+	return nil
+}
+
+// encode returns the JSON line of a message
+func (l *archiveLogger) encode(msg *logger.Message) ([]byte, error) {
+	fields := make(map[string]interface{}, len(l.fields)+3)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields["timestamp"] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+	fields["message"] = string(msg.Line)
+	fields["source"] = msg.Source
+	return json.Marshal(fields)
+}
+
+// openChunk opens a new chunk file named after its creation time, which is
+// sealed once it's old enough. It must be called with the lock held.
+func (l *archiveLogger) openChunk() error {
+	name := chunkName(time.Now())
+	f, err := os.OpenFile(filepath.Join(l.dir, name+chunkExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+
+	l.chunk, l.size = f, 0
+	l.expires = time.AfterFunc(l.cfg.chunkAge, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.chunk == f {
+			l.sealChunk()
+		}
+	})
+	return nil
+}
+
+// sealChunk closes the current chunk and hands it to the uploader, which
+// compresses it out of the logging path. It must be called with the lock
+// held.
+func (l *archiveLogger) sealChunk() {
+	l.expires.Stop()
+	path := l.chunk.Name()
+	if err := l.chunk.Close(); err != nil {
+		logrus.WithError(err).WithField("file", path).Error("s3archive: unable to close chunk")
+	}
+	l.chunk = nil
+	l.uploader.seal(path)
+}
+
+// Close seals the current chunk and waits until the pending chunks are
+// uploaded, without retrying failed uploads. The chunks which couldn't be
+// uploaded are kept on disk until the logger is started again.
+func (l *archiveLogger) Close() error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		if l.chunk != nil {
+			l.sealChunk()
+		}
+	}
+	l.mu.Unlock()
+
+	l.uploader.close()
+	return nil
+}
+
+func (l *archiveLogger) Name() string {
+	return DriverName
+}
+
+// ValidateLogOpt looks for s3archive specific log options
+func ValidateLogOpt(cfg map[string]string) error {
+	for key := range cfg {
+		switch key {
+		case EnvKey:
+		case EnvRegexKey:
+		case LabelsKey:
+		case LabelsRegexKey:
+		case EndpointKey:
+		case RegionKey:
+		case BucketKey:
+		case PrefixKey:
+		case AccessKeyIDKey:
+		case SecretAccessKeyKey:
+		case PathStyleKey:
+		case ChunkSizeKey:
+		case ChunkAgeKey:
+		case BufferDirKey:
+		case TimeoutKey:
+		default:
+			return fmt.Errorf("unknown log opt '%s' for s3archive log driver", key)
+		}
+	}
+	_, err := parseConfig(cfg)
+	return err
+}
+
+// config holds the parsed options
+type config struct {
+	endpoint        string
+	region          string
+	bucket          string
+	prefix          string
+	accessKeyID     string
+	secretAccessKey string
+	pathStyle       bool
+	chunkSize       int64
+	chunkAge        time.Duration
+	bufferDir       string
+	timeout         time.Duration
+}
+
+func parseConfig(cfg map[string]string) (c config, err error) {
+	if c.endpoint, err = parseEndpoint(cfg[EndpointKey]); err != nil {
+		return
+	}
+	if c.region = cfg[RegionKey]; c.region == "" {
+		c.region = defaultRegion
+	}
+	if c.bucket = cfg[BucketKey]; c.bucket == "" {
+		return c, errors.New("s3archive bucket is required")
+	}
+	c.prefix = strings.Trim(cfg[PrefixKey], "/")
+
+	c.accessKeyID = cfg[AccessKeyIDKey]
+	c.secretAccessKey = cfg[SecretAccessKeyKey]
+	if (c.accessKeyID == "") != (c.secretAccessKey == "") {
+		return c, errors.New("s3archive access key id and secret access key must be used together")
+	}
+
+	if c.pathStyle, err = loggerutil.ParseBool(cfg, PathStyleKey); err != nil {
+		return
+	}
+
+	c.chunkSize = defaultChunkSize
+	if v := cfg[ChunkSizeKey]; v != "" {
+		if c.chunkSize, err = units.RAMInBytes(v); err != nil {
+			return c, errdefs.InvalidParameter(err)
+		}
+		if c.chunkSize <= 0 {
+			return c, fmt.Errorf("%s must be a positive size", ChunkSizeKey)
+		}
+	}
+	if c.chunkAge, err = loggerutil.ParsePositiveDuration(cfg, ChunkAgeKey, defaultChunkAge); err != nil {
+		return
+	}
+
+	if c.bufferDir = cfg[BufferDirKey]; c.bufferDir == "" {
+		c.bufferDir = defaultBufferDir
+	}
+	if !filepath.IsAbs(c.bufferDir) {
+		return c, fmt.Errorf("s3archive buffer dir %q must be absolute", c.bufferDir)
+	}
+
+	if c.timeout, err = loggerutil.ParsePositiveDuration(cfg, TimeoutKey, defaultTimeout); err != nil {
+		return
+	}
+
+	return c, nil
+}
+
+func parseEndpoint(address string) (string, error) {
+	if address == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", errdefs.InvalidParameter(err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("s3archive endpoint should be in form http[s]://host[:port], got %v", address)
+	}
+	return u.String(), nil
+}
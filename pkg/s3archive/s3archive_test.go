@@ -0,0 +1,90 @@
+package s3archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogOpt(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   map[string]string
+		valid bool
+	}{
+		{"minimal", map[string]string{BucketKey: "logs"}, true},
+		{"full", map[string]string{
+			EndpointKey:        "http://minio:9000",
+			RegionKey:          "eu-west-1",
+			BucketKey:          "logs",
+			PrefixKey:          "/archive/",
+			AccessKeyIDKey:     "minio",
+			SecretAccessKeyKey: "secret",
+			PathStyleKey:       "true",
+			ChunkSizeKey:       "16m",
+			ChunkAgeKey:        "10m",
+			BufferDirKey:       "/var/spool/logs",
+			TimeoutKey:         "30s",
+			LabelsKey:          "team",
+			EnvKey:             "STAGE",
+		}, true},
+		{"no bucket", map[string]string{}, false},
+		{"unknown key", map[string]string{BucketKey: "logs", "s3archive-foo": "bar"}, false},
+		{"invalid endpoint", map[string]string{BucketKey: "logs", EndpointKey: "minio:9000"}, false},
+		{"access key without secret", map[string]string{BucketKey: "logs", AccessKeyIDKey: "minio"}, false},
+		{"secret without access key", map[string]string{BucketKey: "logs", SecretAccessKeyKey: "secret"}, false},
+		{"invalid path style", map[string]string{BucketKey: "logs", PathStyleKey: "maybe"}, false},
+		{"invalid chunk size", map[string]string{BucketKey: "logs", ChunkSizeKey: "big"}, false},
+		{"zero chunk size", map[string]string{BucketKey: "logs", ChunkSizeKey: "0"}, false},
+		{"invalid chunk age", map[string]string{BucketKey: "logs", ChunkAgeKey: "-1m"}, false},
+		{"relative buffer dir", map[string]string{BucketKey: "logs", BufferDirKey: "spool"}, false},
+		{"invalid timeout", map[string]string{BucketKey: "logs", TimeoutKey: "soon"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLogOpt(tc.cfg)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	created := time.Date(2020, time.January, 2, 3, 4, 5, 6, time.UTC)
+	name := chunkName(created) + gzipExt
+
+	assert.Equal(t, "archive/2020-01-02/web/20200102T030405.000000006Z.gz", objectKey("archive", created, "web", name))
+	assert.Equal(t, "2020-01-02/web/20200102T030405.000000006Z.gz", objectKey("", created, "web", name))
+
+	parsed, err := chunkTime(name)
+	assert.Nil(t, err)
+	assert.True(t, created.Equal(parsed))
+}
+
+func TestListChunksWithGlobCharacters(t *testing.T) {
+	parent := tempDir(t)
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "logs[*?]")
+	require.Nil(t, os.Mkdir(dir, 0750))
+
+	created := time.Date(2020, time.January, 2, 3, 4, 5, 6, time.UTC)
+	older, newer := chunkName(created)+gzipExt, chunkName(created.Add(time.Minute))+gzipExt
+	for _, name := range []string{newer, older, chunkName(created) + chunkExt, "other" + gzipExt} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0640))
+	}
+
+	chunks, err := listChunks(dir, gzipExt)
+	require.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, older), filepath.Join(dir, newer)}, chunks)
+
+	chunks, err = listChunks(filepath.Join(parent, "missing"), gzipExt)
+	assert.Nil(t, err)
+	assert.Empty(t, chunks)
+}
@@ -0,0 +1,205 @@
+package s3archive
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+func newS3(cfg config) (s3iface.S3API, error) {
+	awsConfig := aws.NewConfig().
+		WithRegion(cfg.region).
+		WithS3ForcePathStyle(cfg.pathStyle).
+		WithHTTPClient(&http.Client{Timeout: cfg.timeout}).
+		// failed uploads are retried from disk by the uploader
+		WithMaxRetries(0)
+	if cfg.endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(cfg.endpoint)
+	}
+	if cfg.accessKeyID != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(cfg.accessKeyID, cfg.secretAccessKey, ""))
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
+
+// uploader sends the sealed chunks of a directory from a background
+// goroutine, deleting them once they are uploaded.
+type uploader struct {
+	s3        s3iface.S3API
+	bucket    string
+	prefix    string
+	container string
+	dir       string
+	timeout   time.Duration
+
+	mu sync.Mutex
+	// chunks sealed by the logger, waiting to be compressed
+	sealed []string
+
+	wake chan struct{}
+	// closed when the logger is closed, so failed uploads are not retried
+	quit chan struct{}
+	done chan struct{}
+}
+
+func newUploader(svc s3iface.S3API, cfg config, dir, container string) *uploader {
+	u := &uploader{
+		s3:        svc,
+		bucket:    cfg.bucket,
+		prefix:    cfg.prefix,
+		container: container,
+		dir:       dir,
+		timeout:   cfg.timeout,
+		wake:      make(chan struct{}, 1),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go u.run()
+	// there may be chunks left from a previous run
+	u.notify()
+	return u
+}
+
+// seal queues a sealed chunk to be compressed and uploaded
+func (u *uploader) seal(chunk string) {
+	u.mu.Lock()
+	u.sealed = append(u.sealed, chunk)
+	u.mu.Unlock()
+	u.notify()
+}
+
+// notify wakes up the uploader
+func (u *uploader) notify() {
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close makes a last attempt to upload the sealed chunks, and waits until
+// it's done.
+func (u *uploader) close() {
+	select {
+	case <-u.quit:
+	default:
+		close(u.quit)
+	}
+	<-u.done
+}
+
+// run uploads the sealed chunks when woken up, retrying with an exponential
+// backoff after a failure.
+func (u *uploader) run() {
+	defer close(u.done)
+
+	var (
+		backoff = minBackoff
+		retry   <-chan time.Time
+	)
+	for {
+		select {
+		case <-u.wake:
+		case <-retry:
+		case <-u.quit:
+			if err := u.uploadAll(); err != nil {
+				logrus.WithError(err).WithField("dir", u.dir).Error("s3archive: unable to upload chunks on close, they'll be sent on the next start")
+			}
+			return
+		}
+
+		if err := u.uploadAll(); err != nil {
+			logrus.WithError(err).WithField("retry", backoff).Error("s3archive: unable to upload chunk")
+			retry = time.After(backoff)
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		retry, backoff = nil, minBackoff
+	}
+}
+
+// compressSealed compresses the chunks sealed since the last call. The ones
+// which can't be compressed are left for the next start.
+func (u *uploader) compressSealed() {
+	u.mu.Lock()
+	sealed := u.sealed
+	u.sealed = nil
+	u.mu.Unlock()
+
+	for _, chunk := range sealed {
+		if err := compressChunk(chunk); err != nil {
+			logrus.WithError(err).WithField("file", chunk).Error("s3archive: unable to compress chunk, it'll be sent on the next start")
+		}
+	}
+}
+
+// uploadAll compresses the sealed chunks and uploads them, oldest first,
+// until one fails
+func (u *uploader) uploadAll() error {
+	u.compressSealed()
+
+	chunks, err := listChunks(u.dir, gzipExt)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := u.upload(chunk); err != nil {
+			return err
+		}
+		if err := os.Remove(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upload sends a chunk keyed by prefix/date/container/chunk.gz
+func (u *uploader) upload(chunk string) error {
+	created, err := chunkTime(chunk)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadFile(chunk)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), u.timeout)
+	defer cancel()
+
+	_, err = u.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(u.bucket),
+		Key:         aws.String(objectKey(u.prefix, created, u.container, filepath.Base(chunk))),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/gzip"),
+	})
+	return err
+}
+
+func objectKey(prefix string, created time.Time, container, chunk string) string {
+	return path.Join(prefix, created.UTC().Format("2006-01-02"), container, chunk)
+}
@@ -0,0 +1,190 @@
+package s3archive
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allgdante/docker-multilogger-plugin/internal/loggertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type object struct {
+	bucket      string
+	key         string
+	contentType string
+	lines       []string
+}
+
+// startS3Server runs an S3 stand-in accepting path-style uploads, like MinIO,
+// which replies with the given status codes, in order, and then with 200.
+// Every uploaded object is sent to the returned channel, with its lines
+// decompressed. The server must be closed by the caller.
+func startS3Server(t *testing.T, statuses ...int) (*httptest.Server, <-chan object) {
+	var calls int32
+	objects := make(chan object, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int(atomic.AddInt32(&calls, 1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/"))
+
+		zr, err := gzip.NewReader(r.Body)
+		require.Nil(t, err)
+		b, err := ioutil.ReadAll(zr)
+		require.Nil(t, err)
+
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		require.Len(t, parts, 2)
+		objects <- object{
+			bucket:      parts[0],
+			key:         parts[1],
+			contentType: r.Header.Get("Content-Type"),
+			lines:       strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"),
+		}
+	}))
+	return srv, objects
+}
+
+func testConfig(srv *httptest.Server, dir string) map[string]string {
+	return map[string]string{
+		EndpointKey:        srv.URL,
+		BucketKey:          "logs",
+		PrefixKey:          "archive",
+		AccessKeyIDKey:     "minio",
+		SecretAccessKeyKey: "secret",
+		PathStyleKey:       "true",
+		BufferDirKey:       dir,
+	}
+}
+
+func messages(t *testing.T, obj object) []string {
+	var result []string
+	for _, line := range obj.lines {
+		var fields map[string]interface{}
+		require.Nil(t, json.Unmarshal([]byte(line), &fields))
+		assert.Equal(t, "web", fields["container_name"])
+		assert.Equal(t, "stdout", fields["source"])
+		result = append(result, fields["message"].(string))
+	}
+	return result
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "s3archive")
+	require.Nil(t, err)
+	return dir
+}
+
+func TestUploadBySize(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	srv, objects := startS3Server(t)
+	defer srv.Close()
+
+	cfg := testConfig(srv, dir)
+	cfg[ChunkSizeKey] = "1"
+	l := loggertest.New(t, New, cfg)
+
+	loggertest.Log(t, l, "first")
+	loggertest.Log(t, l, "second")
+	require.Nil(l.Close())
+
+	for _, expected := range []string{"first", "second"} {
+		obj := loggertest.Receive(t, objects).(object)
+		assert.Equal("logs", obj.bucket)
+		assert.Equal("application/gzip", obj.contentType)
+		assert.Regexp(`^archive/\d{4}-\d{2}-\d{2}/web/\d{8}T\d{6}\.\d{9}Z\.gz$`, obj.key)
+		assert.Equal([]string{expected}, messages(t, obj))
+	}
+
+	// the uploaded chunks are deleted
+	files, err := ioutil.ReadDir(filepath.Join(dir, loggertest.ContainerID))
+	require.Nil(err)
+	assert.Empty(files)
+}
+
+func TestUploadByAge(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	srv, objects := startS3Server(t)
+	defer srv.Close()
+
+	cfg := testConfig(srv, dir)
+	cfg[ChunkAgeKey] = "50ms"
+	l := loggertest.New(t, New, cfg)
+	defer l.Close()
+
+	loggertest.Log(t, l, "first")
+	loggertest.Log(t, l, "second")
+	assert.Equal(t, []string{"first", "second"}, messages(t, loggertest.Receive(t, objects).(object)))
+}
+
+func TestUploadRetried(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	srv, objects := startS3Server(t, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	cfg := testConfig(srv, dir)
+	cfg[ChunkSizeKey] = "1"
+	l := loggertest.New(t, New, cfg)
+	defer l.Close()
+
+	loggertest.Log(t, l, "hello")
+	assert.Equal(t, []string{"hello"}, messages(t, loggertest.Receive(t, objects).(object)))
+}
+
+func TestUploadOnNextStart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// the chunk can't be uploaded, so it's kept on disk
+	down, _ := startS3Server(t, http.StatusInternalServerError, http.StatusInternalServerError)
+	l := loggertest.New(t, New, testConfig(down, dir))
+	loggertest.Log(t, l, "hello")
+	require.Nil(t, l.Close())
+	down.Close()
+
+	srv, objects := startS3Server(t)
+	defer srv.Close()
+	l = loggertest.New(t, New, testConfig(srv, dir))
+	defer l.Close()
+
+	assert.Equal(t, []string{"hello"}, messages(t, loggertest.Receive(t, objects).(object)))
+}
+
+func TestUnsealedChunkOnStart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// a chunk left behind by a crash
+	chunks := filepath.Join(dir, loggertest.ContainerID)
+	require.Nil(t, os.MkdirAll(chunks, 0755))
+	chunk := filepath.Join(chunks, chunkName(time.Now())+chunkExt)
+	require.Nil(t, ioutil.WriteFile(chunk, []byte(`{"container_name":"web","message":"crashed","source":"stdout"}`+"\n"), 0640))
+
+	srv, objects := startS3Server(t)
+	defer srv.Close()
+	l := loggertest.New(t, New, testConfig(srv, dir))
+	defer l.Close()
+
+	assert.Equal(t, []string{"crashed"}, messages(t, loggertest.Receive(t, objects).(object)))
+}
@@ -0,0 +1,163 @@
+package syslog5424
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	syslog "github.com/allgdante/docker-multilogger-plugin/internal/srslog"
+
+	"github.com/docker/docker/daemon/logger"
+)
+
+// Maximum length of the RFC 5424 header fields
+const (
+	maxHostnameLen = 255
+	maxAppNameLen  = 48
+	maxProcIDLen   = 128
+	maxMSGIDLen    = 32
+)
+
+// nilValue is used for the header fields without a value
+const nilValue = "-"
+
+// rfc5424Formatter provides an RFC 5424 compliant message formatter. The
+// header is computed when the logger is created, except for the timestamp
+// and the MSGID, which are set for every message.
+type rfc5424Formatter struct {
+	timeFormat string
+	utc        bool
+	prefixes   map[syslog.Priority][]byte // "<PRI>1 "
+	fields     []byte                     // " HOSTNAME APP-NAME PROCID "
+	sd         []byte                     // without the NILVALUE
+	buf        []byte
+}
+
+func newRFC5424Formatter(
+	timeFormat string,
+	utc bool,
+	hostname, appName, procID string,
+	facility syslog.Priority,
+	extra map[string]string) *rfc5424Formatter {
+	f := &rfc5424Formatter{
+		timeFormat: timeFormat,
+		utc:        utc,
+		prefixes:   make(map[syslog.Priority][]byte),
+	}
+
+	for _, severity := range []syslog.Priority{syslog.LOG_INFO, syslog.LOG_ERR} {
+		p := (facility & syslog.FacilityMask) | (severity & syslog.SeverityMask)
+		f.prefixes[severity] = []byte(fmt.Sprintf("<%d>1 ", p))
+	}
+
+	f.fields = []byte(fmt.Sprintf(" %s %s %s ",
+		headerField(hostname, maxHostnameLen),
+		headerField(appName, maxAppNameLen),
+		headerField(procID, maxProcIDLen)))
+
+	if len(extra) > 0 {
+		var b strings.Builder
+		b.WriteString("[docker@3071")
+		for k, v := range extra {
+			fmt.Fprintf(&b, " %s=\"%s\"", k, escapeSDParam(v))
+		}
+		b.WriteString("]")
+		f.sd = []byte(b.String())
+	}
+
+	return f
+}
+
+// format returns the formatted message, which is only valid until the next
+// call.
+func (f *rfc5424Formatter) format(timestamp time.Time, p syslog.Priority, msgid string, content []byte) []byte {
+	return f.formatWithSD(timestamp, p, msgid, nil, content)
+}
+
+// formatWithSD is like format, adding an extra SD-ELEMENT to the structured
+// data.
+func (f *rfc5424Formatter) formatWithSD(
+	timestamp time.Time,
+	p syslog.Priority,
+	msgid string,
+	element, content []byte) []byte {
+	if f.utc {
+		timestamp = timestamp.UTC()
+	}
+
+	f.buf = append(f.buf[:0], f.prefixes[p]...)
+	f.buf = timestamp.AppendFormat(f.buf, f.timeFormat)
+	f.buf = append(f.buf, f.fields...)
+	f.buf = append(f.buf, headerField(msgid, maxMSGIDLen)...)
+	f.buf = append(f.buf, ' ')
+	if len(f.sd) == 0 && len(element) == 0 {
+		f.buf = append(f.buf, nilValue...)
+	}
+	f.buf = append(f.buf, f.sd...)
+	f.buf = append(f.buf, element...)
+	f.buf = append(f.buf, ' ')
+	f.buf = append(f.buf, content...)
+	return f.buf
+}
+
+// rawFormatter is the formatter of the writer, as our messages are already
+// formatted.
+func rawFormatter(_ time.Time, _ syslog.Priority, _, _ string, content []byte) []byte {
+	return content
+}
+
+// headerField makes s a valid header field: characters other than printable
+// US-ASCII are replaced, it's truncated to max bytes and empty values become
+// the NILVALUE.
+func headerField(s string, max int) string {
+	if s == "" {
+		return nilValue
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// msgidSelector chooses the MSGID of every message: the match of a regular
+// expression on the message, or a fixed value otherwise.
+type msgidSelector struct {
+	static string
+	regex  *regexp.Regexp
+}
+
+func (m msgidSelector) msgid(msg *logger.Message) string {
+	if m.regex != nil {
+		// the first capture group is used if there is any
+		if match := m.regex.FindSubmatch(msg.Line); match != nil {
+			value := match[0]
+			if len(match) > 1 {
+				value = match[1]
+			}
+			if len(value) > 0 {
+				return string(value)
+			}
+		}
+	}
+
+	return m.static
+}
+
+func parseMSGIDRegex(cfg map[string]string) (*regexp.Regexp, error) {
+	v := cfg[MSGIDRegexKey]
+	if v == "" {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog MSGID regex: %v", err)
+	}
+	return re, nil
+}
@@ -0,0 +1,169 @@
+package syslog5424
+
+import (
+	"bufio"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	syslog "github.com/allgdante/docker-multilogger-plugin/internal/srslog"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRFC5424Formatter(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		timestamp = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		ts        = "2020-01-02T03:04:05Z"
+	)
+
+	f := newRFC5424Formatter(time.RFC3339, false, "host", "app", "", syslog.LOG_DAEMON, nil)
+	assert.Equal("<30>1 "+ts+" host app - id - hello",
+		string(f.format(timestamp, syslog.LOG_INFO, "id", []byte("hello"))))
+	assert.Equal("<27>1 "+ts+" host app - - - oops",
+		string(f.format(timestamp, syslog.LOG_ERR, "", []byte("oops"))))
+
+	f = newRFC5424Formatter(time.RFC3339, false, strings.Repeat("h", 300), strings.Repeat("a", 60),
+		"my proc", syslog.LOG_DAEMON, map[string]string{"foo": `b"r`})
+	assert.Equal("<30>1 "+ts+" "+strings.Repeat("h", 255)+" "+strings.Repeat("a", 48)+
+		` my_proc `+strings.Repeat("m", 32)+` [docker@3071 foo="b\"r"] hello`,
+		string(f.format(timestamp, syslog.LOG_INFO, strings.Repeat("m", 40), []byte("hello"))))
+}
+
+func TestRFC5424FormatterTimestamp(t *testing.T) {
+	var (
+		instant = time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)
+		zones   = []*time.Location{
+			time.UTC,
+			time.FixedZone("CEST", 2*60*60),
+			time.FixedZone("NST", -(3*60*60 + 30*60)),
+		}
+	)
+
+	for _, tc := range []struct {
+		format string
+		utc    bool
+		want   []string // one timestamp per zone
+	}{
+		{RFC3339TimeFormat, false, []string{
+			"2020-01-02T03:04:05Z", "2020-01-02T05:04:05+02:00", "2020-01-01T23:34:05-03:30",
+		}},
+		{RFC3339MilliTimeFormat, false, []string{
+			"2020-01-02T03:04:05.123Z", "2020-01-02T05:04:05.123+02:00", "2020-01-01T23:34:05.123-03:30",
+		}},
+		{RFC3399MicroTimeFormat, false, []string{
+			"2020-01-02T03:04:05.123456Z", "2020-01-02T05:04:05.123456+02:00", "2020-01-01T23:34:05.123456-03:30",
+		}},
+		{RFC3339NanoTimeFormat, false, []string{
+			"2020-01-02T03:04:05.123456789Z", "2020-01-02T05:04:05.123456789+02:00", "2020-01-01T23:34:05.123456789-03:30",
+		}},
+		{RFC3339MilliTimeFormat, true, []string{
+			"2020-01-02T03:04:05.123Z", "2020-01-02T03:04:05.123Z", "2020-01-02T03:04:05.123Z",
+		}},
+	} {
+		layout, err := parseTimeFormat(tc.format)
+		require.Nil(t, err)
+		f := newRFC5424Formatter(layout, tc.utc, "host", "app", "1", syslog.LOG_DAEMON, nil)
+
+		// the same formatter is reused with timestamps of different lengths
+		for i, zone := range zones {
+			assert.Equal(t, "<30>1 "+tc.want[i]+" host app 1 id - hello",
+				string(f.format(instant.In(zone), syslog.LOG_INFO, "id", []byte("hello"))),
+				"format %s, utc %v, zone %s", tc.format, tc.utc, zone)
+		}
+	}
+
+	err := ValidateLogOpt(map[string]string{TimeUTCKey: "maybe"})
+	assert.NotNil(t, err, "Expected error if the UTC option is not a boolean")
+}
+
+func TestMSGIDSelector(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		sel    = msgidSelector{
+			static: "static",
+			regex:  regexp.MustCompile(`^\[(\w+)\]`),
+		}
+	)
+
+	assert.Equal("regex", sel.msgid(&logger.Message{Line: []byte("[regex] hello")}))
+	assert.Equal("static", sel.msgid(&logger.Message{Line: []byte("hello")}))
+
+	err := ValidateLogOpt(map[string]string{MSGIDRegexKey: "("})
+	assert.NotNil(err, "Expected error with an invalid regex")
+}
+
+func TestValidateTemplates(t *testing.T) {
+	assert.Nil(t, ValidateLogOpt(map[string]string{
+		AppNameKey: "{{.ImageName}}",
+		ProcIDKey:  "{{.ID}}",
+	}))
+	for _, key := range []string{HostnameKey, MSGIDKey, AppNameKey, ProcIDKey} {
+		assert.NotNil(t, ValidateLogOpt(map[string]string{key: "{{.ID"}), "Expected error with an unclosed action in %s", key)
+		assert.NotNil(t, ValidateLogOpt(map[string]string{key: "{{.Unknown}}"}), "Expected error with an unknown field in %s", key)
+	}
+}
+
+// startLineServer accepts a single connection and sends every line it
+// receives, without the newline, to the returned channel
+func startLineServer(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	lines := make(chan string, 100)
+	go func() {
+		defer l.Close()
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimSuffix(line, "\n")
+		}
+	}()
+	return "tcp://" + l.Addr().String(), lines
+}
+
+func TestNewHeaderTemplates(t *testing.T) {
+	addr, received := startLineServer(t)
+
+	info := logger.Info{
+		ContainerID:   "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		ContainerName: "/web",
+		Config: map[string]string{
+			AddressKey:       addr,
+			HostnameKey:      "host",
+			AppNameKey:       "{{.Name}}",
+			ProcIDKey:        "{{.ID}}",
+			MSGIDRegexKey:    `^(\w+):`,
+			DisableFramerKey: "true",
+		},
+	}
+
+	s, err := New(info)
+	require.Nil(t, err)
+	defer s.Close()
+
+	require.Nil(t, s.Log(&logger.Message{Line: []byte("GET: /index"), Timestamp: time.Now()}))
+	require.Nil(t, s.Log(&logger.Message{Line: []byte("ready"), Timestamp: time.Now(), Source: "stderr"}))
+
+	fields := strings.SplitN(<-received, " ", 8)
+	assert.Equal(t, []string{"<30>1", "host", "web", "7f0ebc7d0b9a", "GET", "-"},
+		append(fields[:1:1], fields[2:7]...))
+
+	fields = strings.SplitN(<-received, " ", 8)
+	assert.Equal(t, []string{"<27>1", "host", "web", "7f0ebc7d0b9a", "7f0ebc7d0b9a", "-"},
+		append(fields[:1:1], fields[2:7]...))
+}
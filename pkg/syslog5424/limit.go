@@ -0,0 +1,143 @@
+package syslog5424
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	syslog "github.com/allgdante/docker-multilogger-plugin/internal/srslog"
+
+	"github.com/docker/docker/errdefs"
+)
+
+// Available modes for the messages over the maximum size
+const (
+	TruncateMode = "truncate"
+	SplitMode    = "split"
+)
+
+const (
+	// every receiver must accept messages up to this size, see RFC 5424
+	// section 6.1
+	minMessageSize = 480
+
+	truncateMarker = "..."
+
+	// SD-ID of the element which correlates the parts of a split message
+	splitSDID = "split@3071"
+)
+
+// messageLimit holds the maximum size of the formatted messages, including
+// the trailing newline but not the transport framing.
+type messageLimit struct {
+	size  int
+	split bool
+}
+
+func parseMessageLimit(cfg map[string]string) (messageLimit, error) {
+	var limit messageLimit
+
+	if v := cfg[MaxMsgSizeKey]; v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return limit, errdefs.InvalidParameter(err)
+		}
+		if size < minMessageSize {
+			return limit, fmt.Errorf("syslog max message size must be at least %d", minMessageSize)
+		}
+		limit.size = size
+	}
+
+	switch cfg[MaxMsgModeKey] {
+	case "", TruncateMode:
+	case SplitMode:
+		limit.split = true
+	default:
+		return limit, errors.New("invalid syslog max message mode")
+	}
+
+	return limit, nil
+}
+
+// write sends the message, truncated or split in several messages if it's
+// over the limit. The caller must hold the formatter lock.
+func (s *syslogger) write(timestamp time.Time, p syslog.Priority, msgid string, content []byte) error {
+	f := s.formatter
+
+	// the writer adds a newline to every message
+	header := len(f.format(timestamp, p, msgid, nil)) + 1
+	if s.limit.size == 0 || header+len(content) <= s.limit.size {
+		_, err := s.writer.WriteWithTimestampAndPriority(timestamp, p, f.format(timestamp, p, msgid, content))
+		return err
+	}
+
+	if s.limit.split {
+		id := newSplitID()
+		// the sequence numbers can't be longer than the number of bytes
+		overhead := len(f.formatWithSD(timestamp, p, msgid, splitElement(id, len(content), len(content)), nil)) + 1
+		if room := s.limit.size - overhead; room >= utf8.UTFMax {
+			parts := splitUTF8(content, room)
+			for i, part := range parts {
+				line := f.formatWithSD(timestamp, p, msgid, splitElement(id, i+1, len(parts)), part)
+				if _, err := s.writer.WriteWithTimestampAndPriority(timestamp, p, line); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		// the header is too big to split the message, so it's truncated
+	}
+
+	room := s.limit.size - header - len(truncateMarker)
+	if room < 0 {
+		room = 0
+	}
+	line := f.format(timestamp, p, msgid, content[:truncateUTF8(content, room)])
+	line = append(line, truncateMarker...)
+	_, err := s.writer.WriteWithTimestampAndPriority(timestamp, p, line)
+	return err
+}
+
+// splitElement returns the SD-ELEMENT shared by the parts of a split message
+func splitElement(id string, seq, total int) []byte {
+	return []byte(fmt.Sprintf("[%s id=\"%s\" seq=\"%d\" total=\"%d\"]", splitSDID, id, seq, total))
+}
+
+func newSplitID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// truncateUTF8 returns the largest length up to n which doesn't cut a UTF-8
+// encoded character in b.
+func truncateUTF8(b []byte, n int) int {
+	if n >= len(b) {
+		return len(b)
+	}
+	for i := n; i > 0 && n-i < utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			return i
+		}
+	}
+	// not valid UTF-8, so there is nothing to preserve
+	return n
+}
+
+// splitUTF8 splits b in parts of up to n bytes, without cutting any UTF-8
+// encoded character. n must be at least utf8.UTFMax.
+func splitUTF8(b []byte, n int) [][]byte {
+	var parts [][]byte
+	for len(b) > 0 {
+		i := truncateUTF8(b, n)
+		parts = append(parts, b[:i])
+		b = b[i:]
+	}
+	return parts
+}
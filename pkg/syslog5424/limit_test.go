@@ -0,0 +1,107 @@
+package syslog5424
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docker/docker/daemon/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitUTF8(t *testing.T) {
+	assert := assert.New(t)
+
+	parts := splitUTF8([]byte("añoñoño"), 4)
+	assert.Equal([][]byte{[]byte("año"), []byte("ño"), []byte("ño")}, parts)
+	for _, part := range parts {
+		assert.True(utf8.Valid(part))
+	}
+
+	assert.Equal(3, truncateUTF8([]byte("año"), 3))
+	assert.Equal(1, truncateUTF8([]byte("año"), 2))
+	assert.Equal(4, truncateUTF8([]byte("año"), 10))
+}
+
+func TestValidateLogOptMessageLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	limit, err := parseMessageLimit(map[string]string{
+		MaxMsgSizeKey: "2048",
+		MaxMsgModeKey: SplitMode,
+	})
+	assert.Nil(err)
+	assert.Equal(messageLimit{size: 2048, split: true}, limit)
+
+	for key, value := range map[string]string{
+		MaxMsgSizeKey: "100",
+		MaxMsgModeKey: "drop",
+	} {
+		err := ValidateLogOpt(map[string]string{key: value})
+		assert.NotNil(err, "Expected error with %s=%s", key, value)
+	}
+}
+
+func TestMessageLimit(t *testing.T) {
+	line := strings.Repeat("ñ", 1000)
+
+	newLogger := func(mode string) (logger.Logger, <-chan string) {
+		addr, lines := startLineServer(t)
+		s, err := New(logger.Info{
+			ContainerID: "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+			Config: map[string]string{
+				AddressKey:       addr,
+				DisableFramerKey: "true",
+				MaxMsgSizeKey:    "600",
+				MaxMsgModeKey:    mode,
+			},
+		})
+		require.Nil(t, err)
+		return s, lines
+	}
+
+	t.Run("truncate", func(t *testing.T) {
+		s, lines := newLogger(TruncateMode)
+		defer s.Close()
+
+		require.Nil(t, s.Log(&logger.Message{Line: []byte(line), Timestamp: time.Now()}))
+		got := <-lines
+		assert.True(t, len(got)+1 <= 600, "message is %d bytes long", len(got)+1)
+		assert.True(t, strings.HasSuffix(got, "ñ"+truncateMarker))
+		assert.True(t, utf8.ValidString(got))
+	})
+
+	t.Run("split", func(t *testing.T) {
+		s, lines := newLogger(SplitMode)
+		defer s.Close()
+
+		require.Nil(t, s.Log(&logger.Message{Line: []byte(line), Timestamp: time.Now()}))
+
+		var (
+			re       = regexp.MustCompile(`\[split@3071 id="(\w+)" seq="(\d+)" total="(\d+)"\] (.*)$`)
+			ids      = make(map[string]bool)
+			content  strings.Builder
+			seq, end = 0, 1
+		)
+		for seq < end {
+			got := <-lines
+			assert.True(t, len(got)+1 <= 600, "message is %d bytes long", len(got)+1)
+
+			m := re.FindStringSubmatch(got)
+			require.NotNil(t, m, "missing split element in %q", got)
+			ids[m[1]] = true
+			seq++
+			assert.Equal(t, strconv.Itoa(seq), m[2])
+			end, _ = strconv.Atoi(m[3])
+
+			assert.True(t, utf8.ValidString(m[4]))
+			content.WriteString(m[4])
+		}
+		assert.Len(t, ids, 1)
+		assert.Equal(t, line, content.String())
+	})
+}
@@ -9,8 +9,10 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	syslog "github.com/allgdante/docker-multilogger-plugin/internal/srslog"
@@ -20,7 +22,7 @@ import (
 	"github.com/docker/docker/daemon/logger/templates"
 	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/urlutil"
-	"github.com/docker/go-connections/tlsconfig"
+	"github.com/sirupsen/logrus"
 )
 
 // Driver name & available keys
@@ -29,13 +31,35 @@ const (
 	AddressKey       = DriverName + "-address"
 	FacilityKey      = DriverName + "-facility"
 	TimeFormatKey    = DriverName + "-time-format"
+	TimeUTCKey       = DriverName + "-time-utc"
 	TLSCACertKey     = DriverName + "-tls-ca-cert"
 	TLSCertKey       = DriverName + "-tls-cert"
 	TLSKeyKey        = DriverName + "-tls-key"
 	TLSSkipVerifyKey = DriverName + "-tls-skip-verify"
+	TLSMinVersionKey = DriverName + "-tls-min-version"
+	TLSCiphersKey    = DriverName + "-tls-ciphers"
+	TLSServerNameKey = DriverName + "-tls-server-name"
+	TLSPinKey        = DriverName + "-tls-pin-sha256"
 	HostnameKey      = DriverName + "-hostname"
 	MSGIDKey         = DriverName + "-msgid"
+	MSGIDRegexKey    = DriverName + "-msgid-regex"
+	AppNameKey       = DriverName + "-app-name"
+	ProcIDKey        = DriverName + "-procid"
 	DisableFramerKey = DriverName + "-disable-framer"
+	AsyncKey         = DriverName + "-async"
+	BufferSizeKey    = DriverName + "-buffer-size"
+	ConnectOptKey    = DriverName + "-connect-optional"
+	ReconnectMaxKey  = DriverName + "-reconnect-max-delay"
+	DialTimeoutKey   = DriverName + "-dial-timeout"
+	WriteTimeoutKey  = DriverName + "-write-timeout"
+	KeepAliveKey     = DriverName + "-keepalive"
+	BalanceKey       = DriverName + "-balance"
+	MaxLifetimeKey   = DriverName + "-max-conn-lifetime"
+	ResolveKey       = DriverName + "-resolve-interval"
+	RELPWindowKey    = DriverName + "-relp-window"
+	LocalSocketKey   = DriverName + "-local-socket"
+	MaxMsgSizeKey    = DriverName + "-max-message-size"
+	MaxMsgModeKey    = DriverName + "-max-message-mode"
 	EnvKey           = "env"
 	EnvRegexKey      = "env-regex"
 	LabelsKey        = "labels"
@@ -43,14 +67,31 @@ const (
 	TagKey           = "tag"
 )
 
+// Available balancing modes for several syslog servers
+const (
+	RoundRobinBalance = "round-robin"
+	HashBalance       = "hash"
+)
+
 // Available default time formats
 const (
 	RFC3339TimeFormat      = "rfc3339"
+	RFC3339MilliTimeFormat = "rfc3339milli"
 	RFC3399MicroTimeFormat = "rfc3339micro"
+	RFC3339NanoTimeFormat  = "rfc3339nano"
 )
 
 const (
-	secureProto = "tcp+tls"
+	secureProto       = "tcp+tls"
+	relpProto         = "relp"
+	secureRELPProto   = "relp+tls"
+	srvSuffix         = "+srv"
+	defaultPort       = "514"
+	defaultRELPPort   = "20514"
+	defaultBufferSize = 1024
+
+	reconnectDelay           = 500 * time.Millisecond
+	defaultReconnectMaxDelay = 30 * time.Second
 )
 
 var facilities = map[string]syslog.Priority{
@@ -78,6 +119,12 @@ var facilities = map[string]syslog.Priority{
 
 type syslogger struct {
 	writer *syslog.Writer
+
+	// guards the formatter buffer
+	mu        sync.Mutex
+	formatter *rfc5424Formatter
+	msgid     msgidSelector
+	limit     messageLimit
 }
 
 // New creates a syslog logger using the configuration passed in on
@@ -96,7 +143,35 @@ func New(info logger.Info) (logger.Logger, error) {
 		msgid = tag
 	}
 
-	proto, address, err := parseAddress(info.Config[AddressKey])
+	msgidRegex, err := parseMSGIDRegex(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	appName, err := parseOptAsTemplate(info, AppNameKey)
+	if err != nil {
+		return nil, err
+	}
+	if appName == "" {
+		appName = tag
+	}
+
+	procID, err := parseOptAsTemplate(info, ProcIDKey)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := parseAddresses(info.Config[AddressKey])
+	if err != nil {
+		return nil, err
+	}
+	if addr.local() {
+		if addr.address, err = parseLocalSocket(info.Config[LocalSocketKey]); err != nil {
+			return nil, err
+		}
+	}
+
+	balance, err := parseBalance(info.Config[BalanceKey])
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +186,11 @@ func New(info logger.Info) (logger.Logger, error) {
 		return nil, err
 	}
 
+	utc, err := parseBoolOpt(info.Config, TimeUTCKey)
+	if err != nil {
+		return nil, err
+	}
+
 	extra, err := info.ExtraAttributes(nil)
 	if err != nil {
 		return nil, errdefs.InvalidParameter(err)
@@ -120,6 +200,9 @@ func New(info logger.Info) (logger.Logger, error) {
 	if err != nil {
 		return nil, err
 	}
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
 
 	var disableFramer bool
 	if df, ok := info.Config[DisableFramerKey]; ok {
@@ -128,31 +211,110 @@ func New(info logger.Info) (logger.Logger, error) {
 		}
 	}
 
-	var log *syslog.Writer
-	if proto == secureProto {
-		tlsConfig, tlsErr := parseTLSConfig(info.Config)
-		if tlsErr != nil {
-			return nil, tlsErr
+	async, bufferSize, err := parseAsync(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	connectOptional, err := parseBoolOpt(info.Config, ConnectOptKey)
+	if err != nil {
+		return nil, err
+	}
+
+	reconnectMaxDelay, err := parseReconnectMaxDelay(info.Config[ReconnectMaxKey])
+	if err != nil {
+		return nil, err
+	}
+
+	dialTimeout, writeTimeout, keepAlive, err := parseTimeouts(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLifetime, err := parseDurationOpt(info.Config, MaxLifetimeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	resolveInterval, err := parseDurationOpt(info.Config, ResolveKey)
+	if err != nil {
+		return nil, err
+	}
+
+	relpWindow, err := parseRELPWindow(info.Config[RELPWindowKey])
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := parseMessageLimit(info.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if addr.secure() {
+		if tlsConfig, err = parseTLSConfig(info.Config); err != nil {
+			return nil, err
 		}
-		log, err = syslog.DialWithTLSConfig(proto, address, facility, tag, tlsConfig)
-	} else {
-		log, err = syslog.Dial(proto, address, facility, tag)
 	}
+
+	log, err := syslog.NewWriter(addr.proto, addr.address, facility, tag, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	if hostname != "" {
-		log.SetHostname(hostname)
+	switch {
+	case addr.srv != nil:
+		log.SetSRVTargets(addr.srv.Network, addr.srv.Raddr)
+	case addr.targets != nil:
+		log.SetTargets(addr.targets)
+	}
+	if balance == HashBalance {
+		log.SetBalanceKey(info.ContainerID)
 	}
 
-	log.SetFormatter(rfc5424Formatter(timeFormat, hostname, msgid, tag, facility, extra))
-	if !disableFramer {
+	log.SetDialTimeout(dialTimeout)
+	log.SetWriteTimeout(writeTimeout)
+	log.SetKeepAlive(keepAlive)
+	log.SetReconnectBackoff(reconnectDelay, reconnectMaxDelay)
+	log.SetMaxConnLifetime(maxLifetime)
+	log.SetResolveInterval(resolveInterval)
+	if relpWindow > 0 {
+		log.SetRELPWindow(relpWindow)
+	}
+	log.SetRELPRejectHandler(func(msg []byte, err error) {
+		logrus.WithField("id", info.ContainerID).WithError(err).Errorf("syslog5424: dropping message rejected by the RELP server: %s", msg)
+	})
+	if err := log.Connect(); err != nil {
+		if !connectOptional {
+			return nil, err
+		}
+		// The writer will keep trying to connect on every write, honoring the
+		// reconnect backoff, so we just report that we are degraded
+		logrus.WithFields(logrus.Fields{
+			"id":      info.ContainerID,
+			"address": info.Config[AddressKey],
+		}).WithError(err).Warn("syslog5424: degraded, unable to connect to the syslog server")
+	}
+
+	// messages are formatted by the syslogger
+	log.SetFormatter(rawFormatter)
+	// local daemons expect a message per datagram or line
+	if !disableFramer && !addr.local() {
 		log.SetFramer(syslog.RFC5425MessageLengthFramer)
 	}
+	if async {
+		log.SetAsync(bufferSize)
+	}
 
 	return &syslogger{
-		writer: log,
+		writer:    log,
+		formatter: newRFC5424Formatter(timeFormat, utc, hostname, appName, procID, facility, extra),
+		msgid: msgidSelector{
+			static: msgid,
+			regex:  msgidRegex,
+		},
+		limit: limit,
 	}, nil
 }
 
@@ -162,12 +324,14 @@ func (s *syslogger) Log(msg *logger.Message) error {
 		return nil
 	}
 
+	p := syslog.LOG_INFO
 	if msg.Source == "stderr" {
-		_, err := s.writer.WriteWithTimestampAndPriority(msg.Timestamp, syslog.LOG_ERR, msg.Line)
-		logger.PutMessage(msg)
-		return err
+		p = syslog.LOG_ERR
 	}
-	_, err := s.writer.WriteWithTimestampAndPriority(msg.Timestamp, syslog.LOG_INFO, msg.Line)
+
+	s.mu.Lock()
+	err := s.write(msg.Timestamp, p, s.msgid.msgid(msg), msg.Line)
+	s.mu.Unlock()
 	logger.PutMessage(msg)
 	return err
 }
@@ -191,35 +355,199 @@ func ValidateLogOpt(cfg map[string]string) error {
 		case AddressKey:
 		case FacilityKey:
 		case TimeFormatKey:
+		case TimeUTCKey:
 		case TLSCACertKey:
 		case TLSCertKey:
 		case TLSKeyKey:
 		case TLSSkipVerifyKey:
+		case TLSMinVersionKey:
+		case TLSCiphersKey:
+		case TLSServerNameKey:
+		case TLSPinKey:
 		case HostnameKey:
 		case MSGIDKey:
+		case MSGIDRegexKey:
+		case AppNameKey:
+		case ProcIDKey:
 		case DisableFramerKey:
+		case AsyncKey:
+		case BufferSizeKey:
+		case ConnectOptKey:
+		case ReconnectMaxKey:
+		case DialTimeoutKey:
+		case WriteTimeoutKey:
+		case KeepAliveKey:
+		case BalanceKey:
+		case MaxLifetimeKey:
+		case ResolveKey:
+		case RELPWindowKey:
+		case LocalSocketKey:
+		case MaxMsgSizeKey:
+		case MaxMsgModeKey:
 		case TagKey:
 		default:
 			return fmt.Errorf("unknown log opt '%s' for syslog5424 log driver", key)
 		}
 	}
-	if _, _, err := parseAddress(cfg[AddressKey]); err != nil {
+	if _, err := parseAddresses(cfg[AddressKey]); err != nil {
+		return err
+	}
+	if _, err := parseBalance(cfg[BalanceKey]); err != nil {
+		return err
+	}
+	if _, err := parseTLSOptions(cfg); err != nil {
 		return err
 	}
 	if _, err := parseFacility(cfg[FacilityKey]); err != nil {
 		return err
 	}
+	if _, err := parseMSGIDRegex(cfg); err != nil {
+		return err
+	}
+	for _, key := range []string{HostnameKey, MSGIDKey, AppNameKey, ProcIDKey} {
+		if err := validateTemplate(cfg, key); err != nil {
+			return err
+		}
+	}
 	if _, err := parseTimeFormat(cfg[TimeFormatKey]); err != nil {
 		return err
 	}
+	if _, err := parseBoolOpt(cfg, TimeUTCKey); err != nil {
+		return err
+	}
+	if _, _, err := parseAsync(cfg); err != nil {
+		return err
+	}
+	if _, err := parseBoolOpt(cfg, ConnectOptKey); err != nil {
+		return err
+	}
+	if _, err := parseReconnectMaxDelay(cfg[ReconnectMaxKey]); err != nil {
+		return err
+	}
+	if _, _, _, err := parseTimeouts(cfg); err != nil {
+		return err
+	}
+	if _, err := parseDurationOpt(cfg, MaxLifetimeKey); err != nil {
+		return err
+	}
+	if _, err := parseDurationOpt(cfg, ResolveKey); err != nil {
+		return err
+	}
+	if _, err := parseRELPWindow(cfg[RELPWindowKey]); err != nil {
+		return err
+	}
+	if _, err := parseLocalSocket(cfg[LocalSocketKey]); err != nil {
+		return err
+	}
+	if _, err := parseMessageLimit(cfg); err != nil {
+		return err
+	}
 	return nil
 }
 
+// syslogAddress is the parsed address option. Several addresses and DNS SRV
+// names are handled by a writer using the pool network.
+type syslogAddress struct {
+	proto   string
+	address string
+	targets []syslog.Target
+	srv     *syslog.Target
+}
+
+// secure returns true if any of the addresses uses TLS
+func (a syslogAddress) secure() bool {
+	if isSecure(a.proto) {
+		return true
+	}
+	if a.srv != nil && isSecure(a.srv.Network) {
+		return true
+	}
+	for _, t := range a.targets {
+		if isSecure(t.Network) {
+			return true
+		}
+	}
+	return false
+}
+
+// local returns true if messages are sent to the local syslog daemon
+func (a syslogAddress) local() bool {
+	return a.proto == "" && a.targets == nil && a.srv == nil
+}
+
+func isSecure(proto string) bool {
+	return proto == secureProto || proto == secureRELPProto
+}
+
+// parseAddresses parses the address option, which can be a single address, a
+// comma-separated list of addresses or a DNS SRV name with the transport
+// followed by "+srv" as scheme, like tcp+srv://_syslog._tcp.example.com
+func parseAddresses(address string) (syslogAddress, error) {
+	if strings.Contains(address, srvSuffix+"://") {
+		url, err := url.Parse(address)
+		if err != nil {
+			return syslogAddress{}, err
+		}
+		proto := strings.TrimSuffix(url.Scheme, srvSuffix)
+		switch proto {
+		case "tcp", "udp", secureProto:
+		default:
+			return syslogAddress{}, fmt.Errorf("unsupported transport for DNS SRV address %v", address)
+		}
+		if url.Host == "" {
+			return syslogAddress{}, fmt.Errorf("missing DNS SRV name in address %v", address)
+		}
+		return syslogAddress{
+			proto: syslog.PoolNetwork,
+			srv:   &syslog.Target{Network: proto, Raddr: url.Host},
+		}, nil
+	}
+
+	if !strings.Contains(address, ",") {
+		proto, addr, err := parseAddress(address)
+		return syslogAddress{proto: proto, address: addr}, err
+	}
+
+	var targets []syslog.Target
+	for _, a := range strings.Split(address, ",") {
+		proto, addr, err := parseAddress(strings.TrimSpace(a))
+		if err != nil {
+			return syslogAddress{}, err
+		}
+		if proto == "" {
+			return syslogAddress{}, fmt.Errorf("empty address in list %v", address)
+		}
+		targets = append(targets, syslog.Target{Network: proto, Raddr: addr})
+	}
+	return syslogAddress{proto: syslog.PoolNetwork, targets: targets}, nil
+}
+
+// parseLocalSocket parses the path of the local syslog socket, used when
+// there is no address. The usual paths are tried if it's empty.
+func parseLocalSocket(path string) (string, error) {
+	if path != "" && !filepath.IsAbs(path) {
+		return "", fmt.Errorf("syslog local socket must be an absolute path, got %v", path)
+	}
+	return path, nil
+}
+
+func parseBalance(balance string) (string, error) {
+	switch balance {
+	case "", RoundRobinBalance:
+		return RoundRobinBalance, nil
+	case HashBalance:
+		return HashBalance, nil
+	default:
+		return "", errors.New("invalid syslog balance mode")
+	}
+}
+
 func parseAddress(address string) (string, string, error) {
 	if address == "" {
 		return "", "", nil
 	}
-	if !urlutil.IsTransportURL(address) {
+	isRELP := strings.HasPrefix(address, relpProto+"://") || strings.HasPrefix(address, secureRELPProto+"://")
+	if !isRELP && !urlutil.IsTransportURL(address) {
 		return "", "", fmt.Errorf("address should be in form proto://address, got %v", address)
 	}
 	url, err := url.Parse(address)
@@ -235,13 +563,17 @@ func parseAddress(address string) (string, string, error) {
 		return url.Scheme, url.Path, nil
 	}
 
-	// here we process tcp|udp
+	// here we process tcp|udp|relp
 	host := url.Host
 	if _, _, err := net.SplitHostPort(host); err != nil {
 		if !strings.Contains(err.Error(), "missing port in address") {
 			return "", "", err
 		}
-		host = host + ":514"
+		if isRELP {
+			host = host + ":" + defaultRELPPort
+		} else {
+			host = host + ":" + defaultPort
+		}
 	}
 
 	return url.Scheme, host, nil
@@ -268,24 +600,126 @@ func parseTimeFormat(timeFormat string) (string, error) {
 	switch timeFormat {
 	case "", RFC3339TimeFormat:
 		return time.RFC3339, nil
+	case RFC3339MilliTimeFormat:
+		return "2006-01-02T15:04:05.000Z07:00", nil
 	case RFC3399MicroTimeFormat:
 		return "2006-01-02T15:04:05.000000Z07:00", nil
+	case RFC3339NanoTimeFormat:
+		return "2006-01-02T15:04:05.000000000Z07:00", nil
 	default:
 		return "", errors.New("invalid syslog time format")
 	}
 }
 
-func parseTLSConfig(cfg map[string]string) (*tls.Config, error) {
-	_, skipVerify := cfg[TLSSkipVerifyKey]
+func parseAsync(cfg map[string]string) (bool, int, error) {
+	bufferSize := defaultBufferSize
+
+	async, err := parseBoolOpt(cfg, AsyncKey)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if v, ok := cfg[BufferSizeKey]; ok {
+		if bufferSize, err = strconv.Atoi(v); err != nil {
+			return false, 0, errdefs.InvalidParameter(err)
+		}
+		if bufferSize < 1 {
+			return false, 0, errors.New("syslog buffer size must be a positive number")
+		}
+	}
+
+	return async, bufferSize, nil
+}
+
+func parseRELPWindow(window string) (int, error) {
+	if window == "" {
+		return 0, nil
+	}
+
+	size, err := strconv.Atoi(window)
+	if err != nil {
+		return 0, errdefs.InvalidParameter(err)
+	}
+	if size < 1 {
+		return 0, errors.New("syslog RELP window must be a positive number")
+	}
+	return size, nil
+}
 
-	opts := tlsconfig.Options{
-		CAFile:             cfg[TLSCACertKey],
-		CertFile:           cfg[TLSCertKey],
-		KeyFile:            cfg[TLSKeyKey],
-		InsecureSkipVerify: skipVerify,
+func parseReconnectMaxDelay(maxDelay string) (time.Duration, error) {
+	if maxDelay == "" {
+		return defaultReconnectMaxDelay, nil
 	}
 
-	return tlsconfig.Client(opts)
+	d, err := time.ParseDuration(maxDelay)
+	if err != nil {
+		return 0, errdefs.InvalidParameter(err)
+	}
+	if d < reconnectDelay {
+		return 0, fmt.Errorf("syslog reconnect max delay must be at least %v", reconnectDelay)
+	}
+	return d, nil
+}
+
+// parseTimeouts parses the dial and write timeouts and the TCP keep-alive
+// period. Keep-alives use the Go default period when unset, and a zero
+// period disables them.
+func parseTimeouts(cfg map[string]string) (dial, write, keepAlive time.Duration, err error) {
+	if dial, err = parseDurationOpt(cfg, DialTimeoutKey); err != nil {
+		return
+	}
+	if write, err = parseDurationOpt(cfg, WriteTimeoutKey); err != nil {
+		return
+	}
+	if keepAlive, err = parseDurationOpt(cfg, KeepAliveKey); err != nil {
+		return
+	}
+	if v, ok := cfg[KeepAliveKey]; ok && keepAlive == 0 && v != "" {
+		keepAlive = -1
+	}
+	return
+}
+
+// parseDurationOpt parses an optional, non negative duration option
+func parseDurationOpt(cfg map[string]string, key string) (time.Duration, error) {
+	v := cfg[key]
+	if v == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errdefs.InvalidParameter(err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", key)
+	}
+	return d, nil
+}
+
+// parseBoolOpt parses an optional boolean option, which defaults to false
+func parseBoolOpt(cfg map[string]string, key string) (bool, error) {
+	v, ok := cfg[key]
+	if !ok {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errdefs.InvalidParameter(err)
+	}
+	return b, nil
+}
+
+// validateTemplate checks that the option is a template which can be
+// executed with the container info. The container isn't known yet, so a
+// placeholder ID is used, as some of the info methods need one.
+func validateTemplate(cfg map[string]string, key string) error {
+	info := logger.Info{Config: cfg, ContainerID: strings.Repeat("0", 64)}
+	if _, err := parseOptAsTemplate(info, key); err != nil {
+		return fmt.Errorf("invalid template for %s: %v", key, err)
+	}
+	return nil
 }
 
 func parseOptAsTemplate(info logger.Info, key string) (string, error) {
@@ -306,58 +740,6 @@ func parseOptAsTemplate(info logger.Info, key string) (string, error) {
 	return buf.String(), nil
 }
 
-// rfc5424Formatter provides an RFC 5424 compliant message formatter.
-func rfc5424Formatter(
-	timeFormat, hostname, msgid, tag string,
-	facility syslog.Priority,
-	extra map[string]string) syslog.Formatter {
-	type formatRef struct {
-		Offset  int
-		Message []byte
-		Length  int
-	}
-
-	var (
-		pid     = os.Getpid()
-		b       strings.Builder
-		formats = make(map[syslog.Priority]*formatRef)
-	)
-
-	for _, severity := range []syslog.Priority{syslog.LOG_INFO, syslog.LOG_ERR} {
-		p := (facility & syslog.FacilityMask) | (severity & syslog.SeverityMask)
-		ref := &formatRef{
-			Offset: len(strconv.Itoa(int(p))) + 4,
-		}
-		fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s ",
-			p, time.Now().Format(timeFormat), hostname, tag, pid, msgid)
-		if len(extra) > 0 {
-			b.WriteString("[docker@3071")
-			for k, v := range extra {
-				fmt.Fprintf(&b, " %s=\"%s\"", k, escapeSDParam(v))
-			}
-			b.WriteString("]")
-		} else {
-			b.WriteString("-")
-		}
-		b.WriteString(" ")
-		ref.Message = []byte(b.String())
-		b.Reset()
-		ref.Length = len(ref.Message)
-		formats[severity] = ref
-	}
-
-	return func(timestamp time.Time, p syslog.Priority, _, _ string, content []byte) []byte {
-		var (
-			ref     = formats[p]
-			message = ref.Message
-		)
-
-		copy(message[ref.Offset:ref.Offset+len(timeFormat)], []byte(timestamp.Format(timeFormat)))
-		message = append(message[:ref.Length], content...)
-		return message
-	}
-}
-
 // escapeSDParam escapes the sd-param according to rfc5424.
 // Taken from https://github.com/crewjam/rfc5424/blob/master/marshal.go#L39
 func escapeSDParam(s string) string {
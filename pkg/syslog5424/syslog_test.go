@@ -1,8 +1,15 @@
 package syslog5424
 
 import (
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	syslog "github.com/allgdante/docker-multilogger-plugin/internal/srslog"
 
 	"github.com/docker/docker/daemon/logger"
 	"github.com/stretchr/testify/assert"
@@ -56,6 +63,54 @@ func TestParseAddressDefaultPort(t *testing.T) {
 	assert.Equal(t, "514", port, "Expected to default to port 514. It used port ", port)
 }
 
+func TestParseAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, err := parseAddresses("tcp://1.2.3.4")
+	assert.Nil(err)
+	assert.Equal(syslogAddress{proto: "tcp", address: "1.2.3.4:514"}, addr)
+
+	addr, err = parseAddresses("tcp://1.2.3.4, tcp+tls://5.6.7.8:6514")
+	assert.Nil(err)
+	assert.Equal(syslogAddress{
+		proto: syslog.PoolNetwork,
+		targets: []syslog.Target{
+			{Network: "tcp", Raddr: "1.2.3.4:514"},
+			{Network: "tcp+tls", Raddr: "5.6.7.8:6514"},
+		},
+	}, addr)
+	assert.True(addr.secure())
+
+	addr, err = parseAddresses("tcp+srv://_syslog._tcp.example.com")
+	assert.Nil(err)
+	assert.Equal(syslogAddress{
+		proto: syslog.PoolNetwork,
+		srv:   &syslog.Target{Network: "tcp", Raddr: "_syslog._tcp.example.com"},
+	}, addr)
+	assert.False(addr.secure())
+
+	addr, err = parseAddresses("relp+tls://1.2.3.4")
+	assert.Nil(err)
+	assert.Equal(syslogAddress{proto: "relp+tls", address: "1.2.3.4:20514"}, addr)
+	assert.True(addr.secure())
+
+	_, err = parseAddresses("tcp://1.2.3.4,")
+	assert.NotNil(err, "Expected error with an empty address in the list")
+
+	_, err = parseAddresses("unix+srv://_syslog._tcp.example.com")
+	assert.NotNil(err, "Expected error with an unsupported SRV transport")
+
+	err = ValidateLogOpt(map[string]string{
+		BalanceKey: "random",
+	})
+	assert.NotNil(err, "Expected error if balance mode is invalid")
+
+	err = ValidateLogOpt(map[string]string{
+		RELPWindowKey: "0",
+	})
+	assert.NotNil(err, "Expected error if the RELP window is not positive")
+}
+
 func TestValidateSyslogFacility(t *testing.T) {
 	err := ValidateLogOpt(map[string]string{
 		FacilityKey: "Invalid facility",
@@ -70,6 +125,149 @@ func TestValidateLogOptSyslogTimeFormat(t *testing.T) {
 	assert.NotNil(t, err, "Expected error if time format is invalid")
 }
 
+func TestValidateLogOptAsync(t *testing.T) {
+	assert := assert.New(t)
+
+	err := ValidateLogOpt(map[string]string{
+		AsyncKey:      "true",
+		BufferSizeKey: "4096",
+	})
+	assert.Nil(err)
+
+	err = ValidateLogOpt(map[string]string{
+		AsyncKey: "maybe",
+	})
+	assert.NotNil(err, "Expected error if async is not a boolean")
+
+	err = ValidateLogOpt(map[string]string{
+		BufferSizeKey: "0",
+	})
+	assert.NotNil(err, "Expected error if buffer size is not positive")
+}
+
+func TestValidateLogOptReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	err := ValidateLogOpt(map[string]string{
+		ConnectOptKey:   "true",
+		ReconnectMaxKey: "1m",
+	})
+	assert.Nil(err)
+
+	err = ValidateLogOpt(map[string]string{
+		ConnectOptKey: "sometimes",
+	})
+	assert.NotNil(err, "Expected error if connect optional is not a boolean")
+
+	err = ValidateLogOpt(map[string]string{
+		ReconnectMaxKey: "1ms",
+	})
+	assert.NotNil(err, "Expected error if reconnect max delay is too small")
+}
+
+func TestParseTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	dial, write, keepAlive, err := parseTimeouts(map[string]string{})
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), dial)
+	assert.Equal(time.Duration(0), write)
+	assert.Equal(time.Duration(0), keepAlive, "Expected the Go default keep-alive")
+
+	dial, write, keepAlive, err = parseTimeouts(map[string]string{
+		DialTimeoutKey:  "5s",
+		WriteTimeoutKey: "500ms",
+		KeepAliveKey:    "0",
+	})
+	assert.Nil(err)
+	assert.Equal(5*time.Second, dial)
+	assert.Equal(500*time.Millisecond, write)
+	assert.True(keepAlive < 0, "Expected keep-alives to be disabled")
+
+	err = ValidateLogOpt(map[string]string{
+		WriteTimeoutKey: "-1s",
+	})
+	assert.NotNil(err, "Expected error if a timeout is negative")
+
+	err = ValidateLogOpt(map[string]string{
+		DialTimeoutKey: "soon",
+	})
+	assert.NotNil(err, "Expected error if a timeout is not a duration")
+}
+
+func TestValidateLogOptRecycle(t *testing.T) {
+	assert := assert.New(t)
+
+	err := ValidateLogOpt(map[string]string{
+		MaxLifetimeKey: "1h",
+		ResolveKey:     "30s",
+	})
+	assert.Nil(err)
+
+	err = ValidateLogOpt(map[string]string{
+		ResolveKey: "often",
+	})
+	assert.NotNil(err, "Expected error if resolve interval is not a duration")
+}
+
+func TestNewConnectOptional(t *testing.T) {
+	// get an address where nobody is listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := "tcp://" + l.Addr().String()
+	l.Close()
+
+	info := logger.Info{
+		ContainerID: "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		Config: map[string]string{
+			AddressKey: addr,
+		},
+	}
+
+	_, err = New(info)
+	assert.NotNil(t, err, "Expected error if the server is not reachable")
+
+	info.Config[ConnectOptKey] = "true"
+	l2, err := New(info)
+	require.Nil(t, err, "Expected a degraded logger if the connection is optional")
+	assert.Nil(t, l2.Close())
+}
+
+func TestNewLocalSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog5424")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log")
+	l, err := net.ListenPacket("unixgram", path)
+	require.Nil(t, err)
+	defer l.Close()
+
+	s, err := New(logger.Info{
+		ContainerID: "7f0ebc7d0b9a756b16dc6c1c4df31050e6a76fc7b013761df97b79c07bc0336e",
+		Config: map[string]string{
+			LocalSocketKey: path,
+			HostnameKey:    "host",
+		},
+	})
+	require.Nil(t, err)
+	defer s.Close()
+
+	require.Nil(t, s.Log(&logger.Message{Line: []byte("hello"), Timestamp: time.Now()}))
+
+	buf := make([]byte, 4096)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := l.ReadFrom(buf)
+	require.Nil(t, err)
+
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<30>1 "), "Expected an unframed RFC 5424 message, got %q", msg)
+	assert.True(t, strings.HasSuffix(msg, " host 7f0ebc7d0b9a - 7f0ebc7d0b9a - hello\n"), "Unexpected message %q", msg)
+
+	err = ValidateLogOpt(map[string]string{LocalSocketKey: "dev/log"})
+	assert.NotNil(t, err, "Expected error with a relative socket path")
+}
+
 func TestParseOptAsTemplate(t *testing.T) {
 	assert := assert.New(t)
 
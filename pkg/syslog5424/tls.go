@@ -0,0 +1,219 @@
+package syslog5424
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+const pinPrefix = "sha256//"
+
+// Available minimum TLS versions
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsOptions holds the TLS options which don't refer to files, so they can be
+// checked by the validator
+type tlsOptions struct {
+	skipVerify   bool
+	minVersion   uint16
+	cipherSuites []uint16
+	serverName   string
+	pins         [][]byte
+}
+
+func parseTLSOptions(cfg map[string]string) (opts tlsOptions, err error) {
+	if opts.skipVerify, err = parseBoolOpt(cfg, TLSSkipVerifyKey); err != nil {
+		return
+	}
+
+	if v := cfg[TLSMinVersionKey]; v != "" {
+		var ok bool
+		if opts.minVersion, ok = tlsVersions[v]; !ok {
+			return opts, fmt.Errorf("invalid TLS minimum version %q, use 1.2 or 1.3", v)
+		}
+	}
+
+	if v := cfg[TLSCiphersKey]; v != "" {
+		suites := make(map[string]uint16)
+		for _, cs := range tls.CipherSuites() {
+			suites[cs.Name] = cs.ID
+		}
+		for _, name := range strings.Split(v, ",") {
+			id, ok := suites[strings.TrimSpace(name)]
+			if !ok {
+				return opts, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+			}
+			opts.cipherSuites = append(opts.cipherSuites, id)
+		}
+	}
+
+	opts.serverName = cfg[TLSServerNameKey]
+
+	if v := cfg[TLSPinKey]; v != "" {
+		for _, pin := range strings.Split(v, ",") {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), pinPrefix)
+			hash, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(hash) != sha256.Size {
+				return opts, fmt.Errorf("invalid SPKI pin %q, it must be a base64 encoded SHA-256 hash", pin)
+			}
+			opts.pins = append(opts.pins, hash)
+		}
+	}
+
+	return opts, nil
+}
+
+func parseTLSConfig(cfg map[string]string) (*tls.Config, error) {
+	opts, err := parseTLSOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The client certificate is loaded by our reloader instead
+	config, err := tlsconfig.Client(tlsconfig.Options{
+		CAFile:             cfg[TLSCACertKey],
+		InsecureSkipVerify: opts.skipVerify,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.minVersion != 0 {
+		config.MinVersion = opts.minVersion
+	}
+	if opts.cipherSuites != nil {
+		config.CipherSuites = opts.cipherSuites
+	}
+	config.ServerName = opts.serverName
+	if opts.pins != nil {
+		config.VerifyPeerCertificate = verifyPins(opts.pins)
+	}
+
+	certFile, keyFile := cfg[TLSCertKey], cfg[TLSKeyKey]
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("both TLS certificate and key must be provided")
+		}
+		reloader, err := newCertReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = reloader.GetClientCertificate
+	}
+
+	return config, nil
+}
+
+// verifyPins returns a function that checks that the public key of the server
+// certificate matches one of the given SHA-256 hashes. It runs even when
+// verification is skipped, so a pinned self-signed certificate can be used.
+func verifyPins(pins [][]byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("syslog server didn't present any certificate")
+		}
+
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if bytes.Equal(pin, hash[:]) {
+				return nil
+			}
+		}
+		return fmt.Errorf("syslog server public key %s%s is not pinned",
+			pinPrefix, base64.StdEncoding.EncodeToString(hash[:]))
+	}
+}
+
+// certReloader provides the client certificate for every TLS handshake,
+// loading it again whenever the certificate or key files change on disk.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetClientCertificate implements the tls.Config callback. If the files can't
+// be loaded, for example while they are being replaced, the previous
+// certificate is used.
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.changed() {
+		_ = r.reloadLocked()
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloadLocked()
+}
+
+func (r *certReloader) reloadLocked() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load X509 key pair: %v", err)
+	}
+
+	r.cert = &cert
+	r.certTime = certInfo.ModTime()
+	r.keyTime = keyInfo.ModTime()
+	return nil
+}
+
+// changed reports whether any of the files was modified since the last load
+func (r *certReloader) changed() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(r.certTime) || !keyInfo.ModTime().Equal(r.keyTime)
+}
@@ -0,0 +1,166 @@
+package syslog5424
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert generates a self-signed certificate for localhost and writes
+// it, with its key, as PEM files in dir
+func writeTestCert(t *testing.T, dir, name string) (cert tls.Certificate, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	var (
+		certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPEM  = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	)
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	require.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	require.Nil(t, err)
+	return
+}
+
+func spkiPin(t *testing.T, cert tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.Nil(t, err)
+	hash := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func TestParseTLSOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	opts, err := parseTLSOptions(map[string]string{
+		TLSSkipVerifyKey: "false",
+		TLSMinVersionKey: "1.3",
+		TLSCiphersKey:    "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+		TLSServerNameKey: "syslog.example.com",
+		TLSPinKey:        "sha256//47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+	})
+	assert.Nil(err)
+	assert.False(opts.skipVerify, "Expected skip verify to be parsed as a boolean")
+	assert.Equal(uint16(tls.VersionTLS13), opts.minVersion)
+	assert.Equal([]uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	}, opts.cipherSuites)
+	assert.Equal("syslog.example.com", opts.serverName)
+	assert.Len(opts.pins, 1)
+
+	for key, value := range map[string]string{
+		TLSSkipVerifyKey: "nope",
+		TLSMinVersionKey: "1.0",
+		TLSCiphersKey:    "TLS_RSA_WITH_RC4_128_SHA",
+		TLSPinKey:        "sha256//notahash",
+	} {
+		err := ValidateLogOpt(map[string]string{key: value})
+		assert.NotNil(err, "Expected error with %s=%s", key, value)
+	}
+}
+
+func TestTLSPinning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog5424")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		serverCert, _, _ = writeTestCert(t, dir, "server")
+		otherCert, _, _  = writeTestCert(t, dir, "other")
+	)
+
+	handshake := func(pin string) error {
+		config, err := parseTLSConfig(map[string]string{
+			TLSSkipVerifyKey: "true",
+			TLSPinKey:        pin,
+		})
+		require.Nil(t, err)
+
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+		require.Nil(t, err)
+		defer l.Close()
+		go func() {
+			if c, err := l.Accept(); err == nil {
+				c.(*tls.Conn).Handshake()
+				c.Close()
+			}
+		}()
+
+		c, err := tls.Dial("tcp", l.Addr().String(), config)
+		if err == nil {
+			c.Close()
+		}
+		return err
+	}
+
+	assert.Nil(t, handshake(spkiPin(t, serverCert)))
+	assert.NotNil(t, handshake(spkiPin(t, otherCert)), "Expected error with an unknown server key")
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog5424")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	first, certFile, keyFile := writeTestCert(t, dir, "client")
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.Nil(t, err)
+
+	cert, err := reloader.GetClientCertificate(nil)
+	require.Nil(t, err)
+	assert.Equal(t, first.Certificate, cert.Certificate)
+
+	// rotate the certificate, making sure the modification time changes
+	second, _, _ := writeTestCert(t, dir, "client")
+	later := time.Now().Add(time.Minute)
+	require.Nil(t, os.Chtimes(certFile, later, later))
+	require.Nil(t, os.Chtimes(keyFile, later, later))
+
+	cert, err = reloader.GetClientCertificate(nil)
+	require.Nil(t, err)
+	assert.Equal(t, second.Certificate, cert.Certificate)
+
+	// a broken pair keeps the previous certificate
+	require.Nil(t, ioutil.WriteFile(keyFile, []byte("garbage"), 0600))
+	require.Nil(t, os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute)))
+	cert, err = reloader.GetClientCertificate(nil)
+	require.Nil(t, err)
+	assert.Equal(t, second.Certificate, cert.Certificate)
+
+	_, err = parseTLSConfig(map[string]string{TLSCertKey: certFile})
+	assert.NotNil(t, err, "Expected error if the key is missing")
+}